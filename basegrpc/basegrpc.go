@@ -0,0 +1,155 @@
+// Package basegrpc serves instrumented grpc services,
+// on their own address or multiplexed with basehttp.
+package basegrpc
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.seankhliao.com/svcrunner/v3/observability"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
+)
+
+type Config struct {
+	// Address to serve grpc on,
+	// if empty grpc is served with http, which must support http/2.
+	Address    string
+	Reflection bool
+
+	// Message size limits in bytes, using the grpc defaults if 0.
+	MaxRecvMsgSize int
+	MaxSendMsgSize int
+
+	// Connection settings, using the grpc defaults if 0.
+	// They only apply when serving on Address,
+	// with http they're set by the http server.
+	MaxConcurrentStreams  uint
+	MaxConnectionAge      time.Duration
+	MaxConnectionAgeGrace time.Duration
+	// KeepaliveMinTime is the minimum interval clients may send keepalive pings at,
+	// and KeepalivePermitWithoutStream allows pings without active streams,
+	// clients violating either are disconnected.
+	KeepaliveMinTime             time.Duration
+	KeepalivePermitWithoutStream bool
+}
+
+func (c *Config) SetFlags(fset *flag.FlagSet) {
+	fset.StringVar(&c.Address, "grpc.addr", "", "grpc server address, served on the http server if empty")
+	fset.BoolVar(&c.Reflection, "grpc.reflection", false, "serve the grpc reflection service")
+	fset.IntVar(&c.MaxRecvMsgSize, "grpc.max-recv-msg-size", 0, "largest message to receive in bytes, 0 for the default of 4MiB")
+	fset.IntVar(&c.MaxSendMsgSize, "grpc.max-send-msg-size", 0, "largest message to send in bytes, 0 for no limit")
+	fset.UintVar(&c.MaxConcurrentStreams, "grpc.max-concurrent-streams", 0, "maximum concurrent streams per connection, 0 for no limit")
+	fset.DurationVar(&c.MaxConnectionAge, "grpc.max-connection-age", 0, "close connections after this age so clients rebalance, 0 for no limit")
+	fset.DurationVar(&c.MaxConnectionAgeGrace, "grpc.max-connection-age-grace", 0, "time for streams to complete after max connection age, 0 for no limit")
+	fset.DurationVar(&c.KeepaliveMinTime, "grpc.keepalive.min-time", 0, "minimum interval clients may send keepalive pings at, 0 for the default of 5m")
+	fset.BoolVar(&c.KeepalivePermitWithoutStream, "grpc.keepalive.permit-without-stream", false, "allow keepalive pings from clients without active streams")
+}
+
+// serverOptions applies the configured limits.
+func (c *Config) serverOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if c.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(c.MaxRecvMsgSize))
+	}
+	if c.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(c.MaxSendMsgSize))
+	}
+	if c.MaxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(uint32(c.MaxConcurrentStreams)))
+	}
+	if c.MaxConnectionAge > 0 || c.MaxConnectionAgeGrace > 0 {
+		opts = append(opts, grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionAge:      c.MaxConnectionAge,
+			MaxConnectionAgeGrace: c.MaxConnectionAgeGrace,
+		}))
+	}
+	if c.KeepaliveMinTime > 0 || c.KeepalivePermitWithoutStream {
+		opts = append(opts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             c.KeepaliveMinTime,
+			PermitWithoutStream: c.KeepalivePermitWithoutStream,
+		}))
+	}
+	return opts
+}
+
+type GRPC struct {
+	O      *observability.O
+	Server *grpc.Server
+	// Health reports the serving status of services
+	// through the standard grpc health service.
+	Health *health.Server
+
+	conf *Config
+}
+
+func New(ctx context.Context, o *observability.O, c *Config) *GRPC {
+	o = o.Component("basegrpc")
+	server := grpc.NewServer(append(
+		c.serverOptions(),
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+	)...)
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(server, hs)
+	if c.Reflection {
+		reflection.Register(server)
+	}
+	return &GRPC{
+		O:      o,
+		Server: server,
+		Health: hs,
+		conf:   c,
+	}
+}
+
+// Mount routes requests for the registered services on mux to the grpc server,
+// reporting services as not serving once ctx is canceled.
+// It should be called after all services are registered.
+func (g *GRPC) Mount(ctx context.Context, mux *http.ServeMux) {
+	context.AfterFunc(ctx, g.Health.Shutdown)
+	for name := range g.Server.GetServiceInfo() {
+		mux.Handle("POST /"+name+"/", http.HandlerFunc(g.serveHTTP))
+	}
+}
+
+func (g *GRPC) serveHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("content-type"), "application/grpc") {
+		http.Error(rw, "grpc requires http/2 and an application/grpc content type", http.StatusUnsupportedMediaType)
+		return
+	}
+	g.Server.ServeHTTP(rw, r)
+}
+
+// Run serves grpc on the configured address until ctx is canceled.
+func (g *GRPC) Run(ctx context.Context) error {
+	g.O.L.LogAttrs(ctx, slog.LevelInfo, "starting grpc listen", slog.String("address", g.conf.Address))
+	lis, err := net.Listen("tcp", g.conf.Address)
+	if err != nil {
+		return g.O.Err(ctx, "listen grpc", err, slog.String("address", g.conf.Address))
+	}
+
+	go func() {
+		<-ctx.Done()
+		g.O.L.LogAttrs(ctx, slog.LevelInfo, "shutting down grpc server")
+		g.Health.Shutdown()
+		g.Server.GracefulStop()
+	}()
+
+	g.O.L.LogAttrs(ctx, slog.LevelInfo, "starting grpc server",
+		slog.Int("services", len(g.Server.GetServiceInfo())),
+	)
+	err = g.Server.Serve(lis)
+	if err != nil {
+		return g.O.Err(ctx, "error serving grpc", err)
+	}
+	return nil
+}
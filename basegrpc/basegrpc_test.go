@@ -0,0 +1,126 @@
+package basegrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestMount(t *testing.T) {
+	t.Parallel()
+
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g := New(ctx, o, &Config{})
+
+	mux := http.NewServeMux()
+	g.Mount(ctx, mux)
+	srv := httptest.NewUnstartedServer(mux)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	conn, err := grpc.NewClient(strings.TrimPrefix(srv.URL, "https://"),
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	res, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("status = %v, want SERVING", res.Status)
+	}
+
+	// plain http clients are rejected
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/grpc.health.v1.Health/Check", nil)
+	httpClient := srv.Client()
+	httpClient.Transport.(*http.Transport).ForceAttemptHTTP2 = false
+	httpClient.Transport.(*http.Transport).TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	httpRes, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpRes.Body.Close()
+	if httpRes.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("http/1.1 status = %d, want %d", httpRes.StatusCode, http.StatusUnsupportedMediaType)
+	}
+
+	// health is updated asynchronously after cancel
+	cancel()
+	for range 50 {
+		res, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status == healthpb.HealthCheckResponse_NOT_SERVING {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("status after cancel = %v, want NOT_SERVING", res.Status)
+}
+
+func TestMaxRecvMsgSize(t *testing.T) {
+	t.Parallel()
+
+	c := &Config{}
+	fset := flag.NewFlagSet("", flag.ContinueOnError)
+	c.SetFlags(fset)
+	err := fset.Parse([]string{"-grpc.max-recv-msg-size=8", "-grpc.keepalive.permit-without-stream"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(c.serverOptions()); got != 2 {
+		t.Errorf("server options = %d, want 2", got)
+	}
+
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g := New(ctx, o, c)
+
+	mux := http.NewServeMux()
+	g.Mount(ctx, mux)
+	srv := httptest.NewUnstartedServer(mux)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	conn, err := grpc.NewClient(strings.TrimPrefix(srv.URL, "https://"),
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Errorf("small request: %v", err)
+	}
+	_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "a.very.long.service.name"})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("large request: %v, want ResourceExhausted", err)
+	}
+}
@@ -0,0 +1,94 @@
+package basehttp
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.seankhliao.com/svcrunner/v3/observability"
+	"golang.org/x/time/rate"
+)
+
+// APIKey is a named static credential.
+type APIKey struct {
+	Name string
+	Key  string
+	// Rate limits requests per second using this key, unlimited if 0.
+	Rate  float64
+	Burst int
+}
+
+type apiKeyNameKey struct{}
+
+// APIKeyName returns the name of the key that authenticated the request,
+// or the empty string if there is none.
+func APIKeyName(ctx context.Context) string {
+	name, _ := ctx.Value(apiKeyNameKey{}).(string)
+	return name
+}
+
+type apiKey struct {
+	name    string
+	hash    [sha256.Size]byte
+	limiter *rate.Limiter
+}
+
+// APIKeys returns a middleware authenticating requests with one of keys,
+// given as a bearer token in the Authorization header or in X-Api-Key.
+// Rejected requests are logged as client errors, not through O.Err.
+func APIKeys(o *observability.O, keys []APIKey, next http.Handler) http.Handler {
+	hashed := make([]apiKey, 0, len(keys))
+	for _, k := range keys {
+		ak := apiKey{
+			name: k.Name,
+			hash: sha256.Sum256([]byte(k.Key)),
+		}
+		if k.Rate > 0 {
+			ak.limiter = rate.NewLimiter(rate.Limit(k.Rate), max(k.Burst, 1))
+		}
+		hashed = append(hashed, ak)
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			token = r.Header.Get("X-Api-Key")
+		}
+		if token == "" {
+			rw.Header().Set("WWW-Authenticate", "Bearer")
+			clientErr(ctx, o, rw, slog.LevelInfo, http.StatusUnauthorized, "authenticate api key", errors.New("no api key"))
+			return
+		}
+
+		// compare against every key to not leak which keys exist
+		hash := sha256.Sum256([]byte(token))
+		var match *apiKey
+		for i := range hashed {
+			if subtle.ConstantTimeCompare(hash[:], hashed[i].hash[:]) == 1 {
+				match = &hashed[i]
+			}
+		}
+		if match == nil {
+			rw.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			clientErr(ctx, o, rw, slog.LevelWarn, http.StatusUnauthorized, "authenticate api key", errors.New("invalid api key"))
+			return
+		}
+		if match.limiter != nil && !match.limiter.Allow() {
+			rw.Header().Set("Retry-After", "1")
+			clientErr(ctx, o, rw, slog.LevelInfo, http.StatusTooManyRequests, "authenticate api key", errors.New("rate limited"), slog.String("api_key", match.name))
+			return
+		}
+
+		ctx = context.WithValue(ctx, apiKeyNameKey{}, match.name)
+		ctx = observability.WithLogAttrs(ctx, slog.String("api_key", match.name))
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("api_key", match.name))
+		next.ServeHTTP(rw, r.WithContext(ctx))
+	})
+}
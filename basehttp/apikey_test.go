@@ -0,0 +1,111 @@
+package basehttp
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+func TestAPIKeys(t *testing.T) {
+	t.Parallel()
+
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+	h := APIKeys(o, []APIKey{
+		{Name: "alice", Key: "secret-a"},
+		{Name: "bob", Key: "secret-b", Rate: 0.001, Burst: 1},
+	}, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		io.WriteString(rw, APIKeyName(r.Context()))
+	}))
+
+	tcs := []struct {
+		name     string
+		header   string
+		value    string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "no key",
+			wantCode: http.StatusUnauthorized,
+		}, {
+			name:     "bearer",
+			header:   "Authorization",
+			value:    "Bearer secret-a",
+			wantCode: http.StatusOK,
+			wantBody: "alice",
+		}, {
+			name:     "header",
+			header:   "X-Api-Key",
+			value:    "secret-a",
+			wantCode: http.StatusOK,
+			wantBody: "alice",
+		}, {
+			name:     "invalid",
+			header:   "X-Api-Key",
+			value:    "secret-c",
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.header != "" {
+				r.Header.Set(tc.header, tc.value)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			if rec.Code != tc.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantCode)
+			}
+			if tc.wantBody != "" && rec.Body.String() != tc.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tc.wantBody)
+			}
+		})
+	}
+
+	t.Run("rate limit", func(t *testing.T) {
+		t.Parallel()
+
+		codes := make([]int, 2)
+		for i := range codes {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("X-Api-Key", "secret-b")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			codes[i] = rec.Code
+		}
+		if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+			t.Errorf("codes = %v, want [200 429]", codes)
+		}
+	})
+}
+
+func TestAPIKeysClientErrors(t *testing.T) {
+	t.Parallel()
+
+	buf := new(bytes.Buffer)
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: buf})
+	h := APIKeys(o, []APIKey{{Name: "alice", Key: "secret-a"}}, http.NotFoundHandler())
+
+	for _, key := range []string{"", "secret-c"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Api-Key", key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("key %q: status = %d, want %d", key, rec.Code, http.StatusUnauthorized)
+		}
+	}
+	if strings.Contains(buf.String(), `"level":"ERROR"`) {
+		t.Errorf("client errors logged as errors:\n%s", buf)
+	}
+}
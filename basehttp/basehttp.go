@@ -4,10 +4,15 @@ import (
 	"context"
 	"errors"
 	"flag"
+	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	_ "time/tzdata"
 
@@ -19,7 +24,63 @@ import (
 )
 
 type Config struct {
+	// Address is a comma separated list of addresses to listen on,
+	// each a tcp address or unix:// followed by a socket path.
 	Address string
+	// UnixMode sets the permissions of unix socket files, unchanged if 0.
+	UnixMode  os.FileMode
+	Debug     bool
+	AccessLog bool
+
+	TLSCert       string
+	TLSKey        string
+	TLSClientCA   string
+	TLSClientAuth string
+
+	AdminAddress string
+
+	ShutdownTimeout time.Duration
+	// DrainDelay keeps serving after readiness is unset on shutdown,
+	// so load balancers can stop sending new requests first.
+	// It counts towards the framework shutdown timeout.
+	DrainDelay time.Duration
+
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// TrustedProxies may set the client address with forwarding headers.
+	TrustedProxies Prefixes
+	// ProxyProtocol reads PROXY protocol headers from trusted proxies.
+	ProxyProtocol bool
+
+	// H2C serves cleartext HTTP/2 to clients with prior knowledge.
+	H2C bool
+	// HTTP/2 settings, using defaults if 0.
+	H2MaxConcurrentStreams uint
+	H2MaxReadFrameSize     uint
+	H2ConnWindowSize       uint
+	H2StreamWindowSize     uint
+
+	// MaxBodyBytes limits request bodies, disabled if 0.
+	// Routes may lower it with MaxBody.
+	MaxBodyBytes int64
+
+	// CORS is applied to all requests if any origins are allowed.
+	CORS CORS
+
+	// Maintenance starts the server in maintenance mode,
+	// responding with MaintenancePage or a default page.
+	Maintenance     bool
+	MaintenancePage string
+
+	// Retry configures the outgoing http client.
+	Retry Retry
+
+	// Security headers are set on all responses if SecurityHeaders is true.
+	SecurityHeaders bool
+	Security        SecurityHeaders
 }
 
 func (c *Config) SetFlags(fset *flag.FlagSet) {
@@ -27,55 +88,402 @@ func (c *Config) SetFlags(fset *flag.FlagSet) {
 	if port == "" {
 		port = "8080"
 	}
-	fset.StringVar(&c.Address, "http.addr", ":"+port, "http server address")
+	fset.StringVar(&c.Address, "http.addr", ":"+port, "comma separated http server addresses, unix:///path/to.sock for a unix socket")
+	c.UnixMode = 0o660 // default
+	fset.Func("http.unix-mode", "octal permissions for unix socket files (default 0660)", func(s string) error {
+		mode, err := strconv.ParseUint(s, 8, 32)
+		if err != nil {
+			return fmt.Errorf("parse file mode: %w", err)
+		}
+		c.UnixMode = os.FileMode(mode) & os.ModePerm
+		return nil
+	})
+	fset.StringVar(&c.TLSCert, "http.tls.cert", "", "path to tls certificate, enables serving https")
+	fset.StringVar(&c.TLSKey, "http.tls.key", "", "path to tls private key")
+	fset.StringVar(&c.TLSClientCA, "http.tls.client-ca", "", "path to ca bundle for verifying client certificates, requires http.tls.cert and http.tls.key")
+	c.TLSClientAuth = "require" // default
+	fset.Func("http.tls.client-auth", "client certificate policy when a client ca is set: require|optional", func(s string) error {
+		switch s {
+		case "require", "optional":
+		default:
+			return fmt.Errorf("unknown client auth policy: %q", s)
+		}
+		c.TLSClientAuth = s
+		return nil
+	})
+	fset.StringVar(&c.AdminAddress, "http.admin-addr", "", "separate address for health, metrics, and debug endpoints, disabled if empty")
+	fset.DurationVar(&c.ShutdownTimeout, "http.shutdown-timeout", 10*time.Second, "time to wait for requests to complete on shutdown before closing connections")
+	fset.DurationVar(&c.DrainDelay, "http.drain-delay", 0, "time to keep serving after reporting not ready on shutdown, before closing listeners")
+	fset.DurationVar(&c.ReadTimeout, "http.read-timeout", 0, "maximum duration for reading an entire request, 0 for no limit")
+	fset.DurationVar(&c.ReadHeaderTimeout, "http.read-header-timeout", 10*time.Second, "maximum duration for reading request headers")
+	fset.DurationVar(&c.WriteTimeout, "http.write-timeout", 0, "maximum duration for writing a response, 0 for no limit")
+	fset.DurationVar(&c.IdleTimeout, "http.idle-timeout", 0, "maximum duration to keep idle connections open, 0 to use the read timeout")
+	fset.Var(&c.TrustedProxies, "http.trusted-proxies", "comma separated cidrs of proxies trusted to set the client address")
+	fset.BoolVar(&c.ProxyProtocol, "http.proxy-protocol", false, "read PROXY protocol headers from trusted proxies")
+	fset.BoolVar(&c.H2C, "http.h2c", true, "serve cleartext http/2 with prior knowledge")
+	fset.UintVar(&c.H2MaxConcurrentStreams, "http.h2.max-concurrent-streams", 0, "maximum concurrent http/2 streams per connection, 0 for the default")
+	fset.UintVar(&c.H2MaxReadFrameSize, "http.h2.max-read-frame-size", 0, "largest http/2 frame to accept, 0 for the default")
+	fset.UintVar(&c.H2ConnWindowSize, "http.h2.conn-window-size", 0, "http/2 flow control window per connection in bytes, 0 for the default")
+	fset.UintVar(&c.H2StreamWindowSize, "http.h2.stream-window-size", 0, "http/2 flow control window per stream in bytes, 0 for the default")
+	fset.Int64Var(&c.MaxBodyBytes, "http.max-body-bytes", 0, "maximum request body size in bytes, requests declaring larger bodies are rejected with 413, 0 for unlimited")
+	fset.Var((*commaList)(&c.CORS.Origins), "http.cors.origins", "comma separated origins allowed for cross origin requests, * for any")
+	c.CORS.Methods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	fset.Var((*commaList)(&c.CORS.Methods), "http.cors.methods", "comma separated methods allowed for cross origin requests")
+	fset.Var((*commaList)(&c.CORS.Headers), "http.cors.headers", "comma separated headers allowed in cross origin requests")
+	fset.BoolVar(&c.CORS.Credentials, "http.cors.credentials", false, "allow credentials in cross origin requests")
+	fset.DurationVar(&c.CORS.MaxAge, "http.cors.max-age", 0, "how long browsers may cache preflight results")
+	fset.BoolVar(&c.Maintenance, "http.maintenance", false, "start in maintenance mode, toggled by SIGUSR2 or POST /maintenance on the admin server")
+	fset.StringVar(&c.MaintenancePage, "http.maintenance-page", "", "path to html page served in maintenance mode")
+	fset.IntVar(&c.Retry.Attempts, "http.client.attempts", 3, "maximum attempts for idempotent outgoing requests")
+	fset.DurationVar(&c.Retry.Backoff, "http.client.backoff", 100*time.Millisecond, "initial wait between outgoing request attempts")
+	fset.DurationVar(&c.Retry.MaxBackoff, "http.client.max-backoff", 5*time.Second, "maximum wait between outgoing request attempts")
+	fset.DurationVar(&c.Retry.AttemptTimeout, "http.client.attempt-timeout", 0, "timeout for each outgoing request attempt, 0 for no limit")
+	fset.IntVar(&c.Retry.BreakerFailures, "http.client.breaker-failures", 0, "consecutive failures to a host before pausing requests to it, 0 to disable")
+	fset.DurationVar(&c.Retry.BreakerCooldown, "http.client.breaker-cooldown", 30*time.Second, "how long to pause requests to a failing host")
+	fset.BoolVar(&c.SecurityHeaders, "http.security-headers", true, "set security headers on all responses")
+	fset.DurationVar(&c.Security.HSTSMaxAge, "http.hsts-max-age", 365*24*time.Hour, "Strict-Transport-Security max age, 0 to disable")
+	fset.StringVar(&c.Security.ReferrerPolicy, "http.referrer-policy", "strict-origin-when-cross-origin", "Referrer-Policy header value, empty to disable")
+	fset.StringVar(&c.Security.FrameOptions, "http.frame-options", "DENY", "X-Frame-Options header value, empty to disable")
+	fset.StringVar(&c.Security.CSP, "http.csp", "", "Content-Security-Policy header value, {nonce} is replaced by a per request nonce")
+	fset.BoolVar(&c.AccessLog, "http.access-log", false, "log every http request")
+	fset.BoolVar(&c.Debug, "http.debug", false, "serve pprof and runtime debug endpoints under /debug/")
+}
+
+// validate rejects unsafe or inconsistent settings.
+func (c *Config) validate() error {
+	if c.TLSClientCA != "" && (c.TLSCert == "" || c.TLSKey == "") {
+		return errors.New("tls client ca needs a tls cert and key to verify clients")
+	}
+	return c.CORS.Validate()
 }
 
 type HTTP struct {
 	O      *observability.O
 	Mux    *http.ServeMux
 	Server *http.Server
+	// Client retries idempotent requests as configured by Config.Retry.
 	Client *http.Client
+	Health *Health
+	// Readiness is checked by Health,
+	// and unset when the server shuts down.
+	Readiness *Readiness
+
+	// AdminMux and AdminServer serve operational endpoints
+	// if an admin address is set, otherwise they are nil.
+	AdminMux    *http.ServeMux
+	AdminServer *http.Server
+
+	// PreServe is called for each listener after it is bound,
+	// but before the server starts serving.
+	// Use it to discover the actual address when listening on :0.
+	PreServe func(ctx context.Context, lis net.Listener) error
+	// PostListen is called once all listeners are bound,
+	// after PreServe, just before the server starts serving.
+	PostListen func(ctx context.Context) error
+
+	conf        *Config
+	conns       atomic.Int64
+	maintenance *maintenance
+	// cancelBase cancels request contexts,
+	// once the server has shut down so draining requests can complete.
+	cancelBase context.CancelFunc
+	// drained is closed once the server has shut down,
+	// or Run exits without serving.
+	drained   chan struct{}
+	drainOnce sync.Once
 }
 
 func New(ctx context.Context, o *observability.O, c *Config) *HTTP {
 	o = o.Component("basehttp")
 	mux := http.NewServeMux()
-	h2Server := &http2.Server{}
+	maint := &maintenance{page: []byte(defaultMaintenancePage)}
+	maint.on.Store(c.Maintenance)
+	var handler http.Handler = maint.handler(mux)
+	if len(c.CORS.Origins) > 0 {
+		handler = c.CORS.Handler(handler)
+	}
+	if c.SecurityHeaders {
+		handler = c.Security.Handler(handler)
+	}
+	if c.TLSClientCA != "" {
+		handler = clientIdentity(handler)
+	}
+	if c.AccessLog {
+		handler = o.AccessLog(handler)
+	}
+	if len(c.TrustedProxies) > 0 {
+		handler = trustProxies(c.TrustedProxies, handler)
+	}
+	if c.MaxBodyBytes > 0 {
+		handler = maxBody(c.MaxBodyBytes, handler)
+	}
+	handler = requestID(handler)
+	// request contexts outlive ctx until the server has drained
+	baseCtx, cancelBase := context.WithCancel(context.WithoutCancel(ctx))
+	h2Server := &http2.Server{
+		MaxConcurrentStreams:         uint32(c.H2MaxConcurrentStreams),
+		MaxReadFrameSize:             uint32(c.H2MaxReadFrameSize),
+		MaxUploadBufferPerConnection: int32(c.H2ConnWindowSize),
+		MaxUploadBufferPerStream:     int32(c.H2StreamWindowSize),
+	}
+	if c.H2C {
+		handler = h2c.NewHandler(handler, h2Server)
+	}
 	server := &http.Server{
 		Addr:              c.Address,
-		Handler:           otelhttp.NewHandler(h2c.NewHandler(mux, h2Server), "serve http"),
-		ReadHeaderTimeout: 10 * time.Second,
+		Handler:           otelhttp.NewHandler(handler, "serve http"),
+		ReadTimeout:       c.ReadTimeout,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
 		ErrorLog:          slog.NewLogLogger(o.H, slog.LevelWarn),
+		BaseContext: func(net.Listener) context.Context {
+			return baseCtx
+		},
+		TLSConfig: c.tlsConfig(),
+	}
+	if server.TLSConfig != nil {
+		// apply the http/2 settings to negotiated connections
+		err := http2.ConfigureServer(server, h2Server)
+		if err != nil {
+			o.L.LogAttrs(ctx, slog.LevelWarn, "configure http/2", slog.String("error", err.Error()))
+		}
+	}
+	var adminMux *http.ServeMux
+	var adminServer *http.Server
+	opsMux := mux
+	if c.AdminAddress != "" {
+		adminMux = http.NewServeMux()
+		adminServer = &http.Server{
+			Addr:              c.AdminAddress,
+			Handler:           adminMux,
+			ReadHeaderTimeout: 10 * time.Second,
+			ErrorLog:          slog.NewLogLogger(o.H, slog.LevelWarn),
+		}
+		opsMux = adminMux
+	}
+
+	health := newHealth()
+	health.Register(opsMux)
+	readiness := newReadiness()
+	health.AddCheck("readiness", readiness.Check)
+	if c.Debug || adminMux != nil {
+		observability.RegisterDebug(opsMux)
+		o.RegisterTracez(opsMux)
+	}
+	if h := o.MetricsHandler(); h != nil {
+		opsMux.Handle("/metrics", h)
 	}
 	client := &http.Client{
-		Transport: otelhttp.NewTransport(http.DefaultTransport),
+		Transport: newRetryTransport(o, c.Retry, otelhttp.NewTransport(http.DefaultTransport)),
 	}
-	return &HTTP{
+	h := &HTTP{
 		O:      o,
 		Mux:    mux,
 		Server: server,
 		Client: client,
+		Health: health,
+
+		Readiness: readiness,
+
+		AdminMux:    adminMux,
+		AdminServer: adminServer,
+
+		conf:        c,
+		maintenance: maint,
+		cancelBase:  cancelBase,
+		drained:     make(chan struct{}),
+	}
+	server.ConnState = h.connState
+	if adminMux != nil {
+		adminMux.HandleFunc("/maintenance", h.serveMaintenance)
+	}
+	return h
+}
+
+// connState tracks open connections for shutdown reporting.
+func (h *HTTP) connState(c net.Conn, s http.ConnState) {
+	switch s {
+	case http.StateNew:
+		h.conns.Add(1)
+	case http.StateHijacked, http.StateClosed:
+		h.conns.Add(-1)
 	}
+	h.O.ConnState(c, s)
+}
+
+// Init validates the config and loads the files it references.
+// Run calls it before serving,
+// call it before using Server.Handler without Run.
+func (h *HTTP) Init(ctx context.Context) error {
+	err := h.conf.validate()
+	if err != nil {
+		return h.O.Err(ctx, "validate config", err)
+	}
+	if h.Server.TLSConfig != nil {
+		err := h.conf.loadClientCAs(h.Server.TLSConfig)
+		if err != nil {
+			return h.O.Err(ctx, "load client ca", err)
+		}
+	}
+	err = h.loadMaintenancePage()
+	if err != nil {
+		return h.O.Err(ctx, "load maintenance page", err)
+	}
+	return nil
 }
 
 func (h *HTTP) Run(ctx context.Context) error {
-	h.O.L.LogAttrs(ctx, slog.LevelInfo, "starting listen", slog.String("address", h.Server.Addr))
-	lis, err := net.Listen("tcp", h.Server.Addr)
+	defer h.cancelBase()
+	defer h.endDrain()
+	err := h.Init(ctx)
+	if err != nil {
+		return err
+	}
+	h.toggleMaintenanceOnSignal(ctx)
+
+	if h.AdminServer != nil {
+		err := h.runAdmin(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	var listeners []net.Listener
+	closeListeners := func() {
+		for _, lis := range listeners {
+			lis.Close()
+		}
+	}
+	for _, addr := range strings.Split(h.Server.Addr, ",") {
+		h.O.L.LogAttrs(ctx, slog.LevelInfo, "starting listen", slog.String("address", addr))
+		lis, err := h.conf.listen(addr)
+		if err != nil {
+			closeListeners()
+			return h.O.Err(ctx, "listen locally", err, slog.String("address", addr))
+		}
+		if h.conf.ProxyProtocol {
+			lis = &proxyProtoListener{Listener: lis, trusted: h.conf.TrustedProxies}
+		}
+		listeners = append(listeners, lis)
+	}
+	if h.PreServe != nil {
+		for _, lis := range listeners {
+			err := h.PreServe(ctx, lis)
+			if err != nil {
+				closeListeners()
+				return h.O.Err(ctx, "pre serve hook", err)
+			}
+		}
+	}
+	if h.PostListen != nil {
+		err := h.PostListen(ctx)
+		if err != nil {
+			closeListeners()
+			return h.O.Err(ctx, "post listen hook", err)
+		}
+	}
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		h.shutdown(ctx)
+	}()
+
+	useTLS := h.Server.TLSConfig != nil
+	h.O.L.LogAttrs(ctx, slog.LevelInfo, "starting server",
+		slog.Bool("tls", useTLS),
+		slog.Int("listeners", len(listeners)),
+	)
+	serveErr := make(chan error, len(listeners))
+	for _, lis := range listeners {
+		go func() {
+			if useTLS {
+				serveErr <- h.Server.ServeTLS(lis, h.conf.TLSCert, h.conf.TLSKey)
+			} else {
+				serveErr <- h.Server.Serve(lis)
+			}
+		}()
+	}
+	for range listeners {
+		err := <-serveErr
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			// stop serving on the remaining listeners
+			h.Server.Close()
+			return h.O.Err(ctx, "error serving http", err)
+		}
+	}
+	// wait for in flight requests to complete
+	<-shutdownDone
+	return nil
+}
+
+// runAdmin starts the admin server in the background.
+func (h *HTTP) runAdmin(ctx context.Context) error {
+	h.O.L.LogAttrs(ctx, slog.LevelInfo, "starting admin listen", slog.String("address", h.AdminServer.Addr))
+	lis, err := h.conf.listen(h.AdminServer.Addr)
 	if err != nil {
-		return h.O.Err(ctx, "listen locally", err)
+		return h.O.Err(ctx, "listen admin", err)
 	}
+
 	go func() {
 		<-ctx.Done()
-		err := h.Server.Shutdown(context.Background())
+		// keep serving health checks and metrics while the main server drains
+		<-h.drained
+		err := h.AdminServer.Shutdown(context.Background())
 		if err != nil {
-			h.O.Err(ctx, "error closing server", err, slog.String("address", h.Server.Addr))
+			h.O.Err(ctx, "error closing admin server", err, slog.String("address", h.AdminServer.Addr))
+		}
+	}()
+	go func() {
+		err := h.AdminServer.Serve(lis)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			h.O.Err(ctx, "error serving admin http", err)
 		}
 	}()
+	return nil
+}
+
+func (h *HTTP) endDrain() {
+	h.drainOnce.Do(func() { close(h.drained) })
+}
+
+// shutdown reports the server as not ready,
+// waits for the drain delay, then gracefully stops the server,
+// closing any remaining connections after the shutdown timeout.
+// Request contexts are canceled once the server has stopped.
+func (h *HTTP) shutdown(ctx context.Context) {
+	defer h.endDrain()
+	defer h.cancelBase()
 
-	h.O.L.LogAttrs(ctx, slog.LevelInfo, "starting server")
-	err = h.Server.Serve(lis)
-	if err != nil && !errors.Is(err, http.ErrServerClosed) {
-		return h.O.Err(ctx, "error serving http", err)
+	h.Readiness.Unset("shutdown", "draining requests")
+	if h.conf.DrainDelay > 0 {
+		h.O.L.LogAttrs(ctx, slog.LevelInfo, "draining before shutdown",
+			slog.Duration("delay", h.conf.DrainDelay),
+		)
+		time.Sleep(h.conf.DrainDelay)
+	}
+
+	sctx := context.WithoutCancel(ctx)
+	if h.conf.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		sctx, cancel = context.WithTimeout(sctx, h.conf.ShutdownTimeout)
+		defer cancel()
+	}
+	h.O.L.LogAttrs(ctx, slog.LevelInfo, "shutting down server",
+		slog.Int64("connections", h.conns.Load()),
+		slog.Duration("timeout", h.conf.ShutdownTimeout),
+	)
+	err := h.Server.Shutdown(sctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		remaining := h.conns.Load()
+		err = h.Server.Close()
+		h.O.L.LogAttrs(ctx, slog.LevelWarn, "shutdown timed out, force closed connections",
+			slog.Int64("connections", remaining),
+		)
+	}
+	if err != nil {
+		h.O.Err(ctx, "error closing server", err, slog.String("address", h.Server.Addr))
 	}
-	return nil
 }
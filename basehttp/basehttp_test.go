@@ -0,0 +1,145 @@
+package basehttp
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+func TestRunMultipleAddresses(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+	h := New(ctx, o, &Config{Address: "127.0.0.1:0,127.0.0.1:0"})
+	h.Mux.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {})
+
+	var mu sync.Mutex
+	var addrs []string
+	ready := make(chan struct{})
+	h.PreServe = func(ctx context.Context, lis net.Listener) error {
+		mu.Lock()
+		defer mu.Unlock()
+		addrs = append(addrs, lis.Addr().String())
+		if len(addrs) == 2 {
+			close(ready)
+		}
+		return nil
+	}
+
+	done := make(chan error)
+	go func() { done <- h.Run(ctx) }()
+	<-ready
+
+	for _, addr := range addrs {
+		res, err := http.Get("http://" + addr + "/")
+		if err != nil {
+			t.Fatalf("get %s: %v", addr, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("get %s: status = %d", addr, res.StatusCode)
+		}
+	}
+
+	cancel()
+	err := <-done
+	if err != nil {
+		t.Errorf("run: %v", err)
+	}
+}
+
+func TestDrainDelay(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+	h := New(ctx, o, &Config{Address: "127.0.0.1:0", AdminAddress: "127.0.0.1:0", DrainDelay: 500 * time.Millisecond})
+	var reqCtx context.Context
+	h.Mux.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
+		reqCtx = r.Context()
+		if err := r.Context().Err(); err != nil {
+			t.Errorf("request context while draining: %v", err)
+		}
+	})
+
+	var addr string
+	h.PreServe = func(ctx context.Context, lis net.Listener) error {
+		addr = lis.Addr().String()
+		return nil
+	}
+	ready := make(chan struct{})
+	h.PostListen = func(ctx context.Context) error {
+		close(ready)
+		return nil
+	}
+
+	done := make(chan error)
+	go func() { done <- h.Run(ctx) }()
+	<-ready
+
+	cancel()
+	for h.Readiness.Check(ctx) == nil {
+		time.Sleep(time.Millisecond)
+	}
+	res, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatalf("request while draining: %v", err)
+	}
+	res.Body.Close()
+	select {
+	case <-h.drained:
+		t.Errorf("admin server released before the drain ended")
+	default:
+	}
+
+	err = <-done
+	if err != nil {
+		t.Errorf("run: %v", err)
+	}
+	<-h.drained
+	if reqCtx.Err() == nil {
+		t.Errorf("request context not canceled after shutdown")
+	}
+}
+
+func TestRunInvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	tcs := []struct {
+		name string
+		conf Config
+	}{
+		{
+			name: "cors credentials with any origin",
+			conf: Config{CORS: CORS{Origins: []string{"*"}, Credentials: true}},
+		}, {
+			name: "client ca without tls",
+			conf: Config{TLSClientCA: "ca.pem"},
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tc.conf.Address = "127.0.0.1:0"
+			o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+			h := New(context.Background(), o, &tc.conf)
+			err := h.Run(context.Background())
+			if err == nil {
+				t.Errorf("expected config error")
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package basehttp
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// limitedBody limits the size of a request body.
+// The limit can be changed until the first read.
+type limitedBody struct {
+	rw   http.ResponseWriter
+	orig io.ReadCloser
+	n    int64
+	r    io.ReadCloser
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.r == nil {
+		b.r = http.MaxBytesReader(b.rw, b.orig, b.n)
+	}
+	return b.r.Read(p)
+}
+
+func (b *limitedBody) Close() error {
+	return b.orig.Close()
+}
+
+// MaxBody limits request bodies to n bytes,
+// replacing the limit on reads set by the server wide http.max-body-bytes.
+// Requests declaring a larger Content-Length are rejected with 413.
+// Reads past the limit return a *http.MaxBytesError.
+//
+// Requests declaring a Content-Length over the server wide limit
+// are rejected before they're routed,
+// so set it to the largest any route accepts, and lower it with MaxBody.
+func MaxBody(n int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > n {
+			tooLarge(rw, n)
+			return
+		}
+		if lb, ok := r.Body.(*limitedBody); ok && lb.r == nil {
+			lb.n = n
+		} else if r.Body != nil && r.Body != http.NoBody {
+			r.Body = &limitedBody{rw: rw, orig: r.Body, n: n}
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// maxBody applies a server wide body limit,
+// rejecting requests declaring a larger Content-Length,
+// and limiting reads for the rest.
+func maxBody(n int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > n {
+			tooLarge(rw, n)
+			return
+		}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = &limitedBody{rw: rw, orig: r.Body, n: n}
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func tooLarge(rw http.ResponseWriter, n int64) {
+	http.Error(rw, "request body too large, limit "+strconv.FormatInt(n, 10)+" bytes", http.StatusRequestEntityTooLarge)
+}
@@ -0,0 +1,53 @@
+package basehttp
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaxBody(t *testing.T) {
+	t.Parallel()
+
+	read := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(rw, "too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/", read)
+	mux.Handle("/small", MaxBody(4, read))
+	h := maxBody(8, mux)
+
+	tcs := []struct {
+		name     string
+		path     string
+		body     string
+		chunked  bool
+		wantCode int
+	}{
+		{"under server limit", "/", "12345678", false, http.StatusOK},
+		{"declared over server limit", "/", "123456789", false, http.StatusRequestEntityTooLarge},
+		{"chunked over server limit", "/", "123456789", true, http.StatusRequestEntityTooLarge},
+		{"under route limit", "/small", "1234", false, http.StatusOK},
+		{"declared over route limit", "/small", "12345", false, http.StatusRequestEntityTooLarge},
+		{"chunked over route limit", "/small", "12345", true, http.StatusRequestEntityTooLarge},
+	}
+	for _, tc := range tcs {
+		req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+		if tc.chunked {
+			req.ContentLength = -1
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.wantCode {
+			t.Errorf("%s: status = %d, want %d", tc.name, rec.Code, tc.wantCode)
+		}
+	}
+}
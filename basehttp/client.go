@@ -0,0 +1,215 @@
+package basehttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+// ErrCircuitOpen is returned for requests to a host
+// that has failed too many times recently.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// Retry configures retries for requests made by the client.
+type Retry struct {
+	// Attempts is the maximum number of attempts, including the first.
+	Attempts int
+	// Backoff is the initial wait between attempts,
+	// doubling up to MaxBackoff, with jitter.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// AttemptTimeout limits each attempt, disabled if 0.
+	AttemptTimeout time.Duration
+	// BreakerFailures consecutive failed requests to a host
+	// stop requests to it for BreakerCooldown, disabled if 0.
+	BreakerFailures int
+	BreakerCooldown time.Duration
+}
+
+// retryTransport retries idempotent requests that fail with
+// network errors or retryable status codes.
+type retryTransport struct {
+	next  http.RoundTripper
+	retry Retry
+
+	retries  metric.Int64Counter
+	failures metric.Int64Counter
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+type breaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+func newRetryTransport(o *observability.O, retry Retry, next http.RoundTripper) *retryTransport {
+	t := &retryTransport{
+		next:     next,
+		retry:    retry,
+		breakers: make(map[string]*breaker),
+	}
+	t.retries, _ = o.M.Int64Counter("http.client.retries",
+		metric.WithDescription("http client requests retried"),
+	)
+	t.failures, _ = o.M.Int64Counter("http.client.failures",
+		metric.WithDescription("http client requests that failed after all attempts"),
+	)
+	return t
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	host := attribute.String("server.address", req.URL.Host)
+	if !t.allow(req.URL.Host) {
+		t.failures.Add(ctx, 1, metric.WithAttributes(host))
+		return nil, ErrCircuitOpen
+	}
+
+	attempts := 1
+	if retryable(req) {
+		attempts = max(t.retry.Attempts, 1)
+	}
+
+	backoff := t.retry.Backoff
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			t.retries.Add(ctx, 1, metric.WithAttributes(host))
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				req = req.Clone(ctx)
+				req.Body = body
+			}
+		}
+
+		res, err := t.attempt(req)
+		failed := err != nil || retryableStatus(res.StatusCode)
+		if !failed || attempt >= attempts || ctx.Err() != nil {
+			t.record(req.URL.Host, failed)
+			if failed {
+				t.failures.Add(ctx, 1, metric.WithAttributes(host))
+			}
+			return res, err
+		}
+
+		wait := backoff/2 + rand.N(backoff/2+1)
+		if res != nil {
+			if after, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+				wait = max(wait, time.Duration(after)*time.Second)
+			}
+			io.Copy(io.Discard, io.LimitReader(res.Body, 4<<10))
+			res.Body.Close()
+		}
+		if t.retry.MaxBackoff > 0 {
+			wait = min(wait, t.retry.MaxBackoff)
+			backoff = min(backoff*2, t.retry.MaxBackoff)
+		} else {
+			backoff *= 2
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			t.failures.Add(ctx, 1, metric.WithAttributes(host))
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt makes a single request, limited by the attempt timeout.
+func (t *retryTransport) attempt(req *http.Request) (*http.Response, error) {
+	if t.retry.AttemptTimeout <= 0 {
+		return t.next.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.retry.AttemptTimeout)
+	res, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// the timeout covers reading the body
+	res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+func (t *retryTransport) allow(host string) bool {
+	if t.retry.BreakerFailures <= 0 {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.breakers[host]
+	if !ok {
+		return true
+	}
+	if b.failures >= t.retry.BreakerFailures && time.Now().Before(b.openUntil) {
+		return false
+	}
+	return true
+}
+
+func (t *retryTransport) record(host string, failed bool) {
+	if t.retry.BreakerFailures <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !failed {
+		delete(t.breakers, host)
+		return
+	}
+	b, ok := t.breakers[host]
+	if !ok {
+		b = &breaker{}
+		t.breakers[host] = b
+	}
+	b.failures++
+	if b.failures >= t.retry.BreakerFailures {
+		b.openUntil = time.Now().Add(t.retry.BreakerCooldown)
+	}
+}
+
+// retryable reports whether req can safely be sent again.
+func retryable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
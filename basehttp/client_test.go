@@ -0,0 +1,120 @@
+package basehttp
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+func TestRetryTransport(t *testing.T) {
+	t.Parallel()
+
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+	retry := Retry{
+		Attempts:   3,
+		Backoff:    time.Millisecond,
+		MaxBackoff: 5 * time.Millisecond,
+	}
+
+	tcs := []struct {
+		name       string
+		method     string
+		body       io.Reader
+		failures   int32
+		wantCalls  int32
+		wantStatus int
+	}{
+		{
+			name:       "recovers",
+			method:     http.MethodGet,
+			failures:   2,
+			wantCalls:  3,
+			wantStatus: http.StatusOK,
+		}, {
+			name:       "exhausted",
+			method:     http.MethodGet,
+			failures:   5,
+			wantCalls:  3,
+			wantStatus: http.StatusServiceUnavailable,
+		}, {
+			name:       "rewinds body",
+			method:     http.MethodPut,
+			body:       strings.NewReader("data"),
+			failures:   1,
+			wantCalls:  2,
+			wantStatus: http.StatusOK,
+		}, {
+			name:       "not idempotent",
+			method:     http.MethodPost,
+			failures:   1,
+			wantCalls:  1,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				n := calls.Add(1)
+				if b, _ := io.ReadAll(r.Body); tc.body != nil && string(b) != "data" {
+					t.Errorf("attempt %d body = %q", n, b)
+				}
+				if n <= tc.failures {
+					rw.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer srv.Close()
+
+			client := &http.Client{Transport: newRetryTransport(o, retry, http.DefaultTransport)}
+			req, _ := http.NewRequest(tc.method, srv.URL, tc.body)
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			res.Body.Close()
+			if res.StatusCode != tc.wantStatus {
+				t.Errorf("status = %d, want %d", res.StatusCode, tc.wantStatus)
+			}
+			if got := calls.Load(); got != tc.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tc.wantCalls)
+			}
+		})
+	}
+
+	t.Run("circuit breaker", func(t *testing.T) {
+		t.Parallel()
+
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(http.StatusBadGateway)
+		}))
+		defer srv.Close()
+
+		client := &http.Client{Transport: newRetryTransport(o, Retry{
+			Attempts:        1,
+			BreakerFailures: 2,
+			BreakerCooldown: time.Hour,
+		}, http.DefaultTransport)}
+		for range 2 {
+			res, err := client.Get(srv.URL)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			res.Body.Close()
+		}
+		_, err := client.Get(srv.URL)
+		if !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("err = %v, want %v", err, ErrCircuitOpen)
+		}
+	})
+}
@@ -0,0 +1,25 @@
+package basehttp
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+// clientErr rejects a request for a client error,
+// logged at level instead of through O.Err,
+// so anonymous clients can't trigger error reports and alerts.
+func clientErr(ctx context.Context, o *observability.O, rw http.ResponseWriter, level slog.Level, code int, msg string, err error, attrs ...slog.Attr) {
+	o.L.LogAttrs(ctx, level, msg,
+		append(attrs,
+			slog.String("error", err.Error()),
+			slog.Int("http.response.status_code", code),
+		)...,
+	)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.response.status_code", code))
+	http.Error(rw, err.Error(), code)
+}
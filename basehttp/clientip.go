@@ -0,0 +1,137 @@
+package basehttp
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Prefixes is a flag.Value for a comma separated list of CIDRs or addresses.
+type Prefixes []netip.Prefix
+
+func (p *Prefixes) String() string {
+	if p == nil {
+		return ""
+	}
+	var s []string
+	for _, prefix := range *p {
+		s = append(s, prefix.String())
+	}
+	return strings.Join(s, ",")
+}
+
+func (p *Prefixes) Set(s string) error {
+	*p = nil
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(v)
+			if aerr != nil {
+				return fmt.Errorf("parse %q: %w", v, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		*p = append(*p, prefix.Masked())
+	}
+	return nil
+}
+
+func (p Prefixes) contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range p {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client that made the request.
+// Behind trusted proxies, r.RemoteAddr is rewritten by the server
+// to the client address from the forwarding headers.
+func ClientIP(r *http.Request) netip.Addr {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err == nil {
+		return addrPort.Addr().Unmap()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, _ := netip.ParseAddr(host)
+	return addr.Unmap()
+}
+
+// trustProxies rewrites r.RemoteAddr to the client address
+// if the request came through trusted proxies,
+// so that logging and rate limiting see the real client.
+func trustProxies(trusted Prefixes, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		peer := ClientIP(r)
+		if peer.IsValid() && trusted.contains(peer) {
+			if client := forwardedClient(r.Header, trusted); client.IsValid() {
+				r2 := *r
+				r2.RemoteAddr = netip.AddrPortFrom(client, 0).String()
+				r = &r2
+			}
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// forwardedClient walks the forwarding chain from the nearest hop,
+// returning the first address that isn't a trusted proxy.
+func forwardedClient(h http.Header, trusted Prefixes) netip.Addr {
+	hops := forwardedFor(h)
+	var client netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := parseHop(hops[i])
+		if err != nil {
+			// can't trust anything further along the chain
+			return client
+		}
+		client = addr
+		if !trusted.contains(addr) {
+			return client
+		}
+	}
+	return client
+}
+
+// forwardedFor returns the hops from Forwarded, or X-Forwarded-For.
+func forwardedFor(h http.Header) []string {
+	var hops []string
+	for _, line := range h.Values("Forwarded") {
+		for _, elem := range strings.Split(line, ",") {
+			for _, pair := range strings.Split(elem, ";") {
+				k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(k, "for") {
+					hops = append(hops, strings.Trim(v, `"`))
+				}
+			}
+		}
+	}
+	if len(hops) > 0 {
+		return hops
+	}
+	for _, line := range h.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(line, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+func parseHop(hop string) (netip.Addr, error) {
+	if addrPort, err := netip.ParseAddrPort(hop); err == nil {
+		return addrPort.Addr().Unmap(), nil
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]"))
+	return addr.Unmap(), err
+}
@@ -0,0 +1,102 @@
+package basehttp
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTrustProxies(t *testing.T) {
+	t.Parallel()
+
+	var trusted Prefixes
+	err := trusted.Set("10.0.0.0/8,192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		name       string
+		remoteAddr string
+		header     string
+		value      string
+		want       string
+	}{
+		{"direct client", "203.0.113.5:1234", "X-Forwarded-For", "198.51.100.1", "203.0.113.5"},
+		{"trusted proxy", "10.0.0.1:1234", "X-Forwarded-For", "198.51.100.1", "198.51.100.1"},
+		{"proxy chain", "10.0.0.1:1234", "X-Forwarded-For", "6.6.6.6, 198.51.100.1, 192.0.2.1", "198.51.100.1"},
+		{"all trusted", "10.0.0.1:1234", "X-Forwarded-For", "10.1.1.1, 10.2.2.2", "10.1.1.1"},
+		{"forwarded", "10.0.0.1:1234", "Forwarded", `for="[2001:db8::1]:80";proto=https, for=10.3.3.3`, "2001:db8::1"},
+		{"garbage", "10.0.0.1:1234", "X-Forwarded-For", "nope, 198.51.100.1", "198.51.100.1"},
+		{"no header", "10.0.0.1:1234", "", "", "10.0.0.1"},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got string
+			h := trustProxies(trusted, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				got = ClientIP(r).String()
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tc.remoteAddr
+			if tc.header != "" {
+				r.Header.Set(tc.header, tc.value)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			if got != tc.want {
+				t.Errorf("client ip = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	t.Parallel()
+
+	v2 := string(proxyV2Sig) + "\x21\x11\x00\x0c" + // v2 proxy, tcp4, 12 bytes
+		"\xc6\x33\x64\x01" + "\x0a\x00\x00\x01" + "\x04\xd2" + "\x00\x50"
+
+	tcs := []struct {
+		name    string
+		header  string
+		want    string
+		wantErr bool
+	}{
+		{"v1", "PROXY TCP4 198.51.100.1 10.0.0.1 1234 80\r\n", "198.51.100.1:1234", false},
+		{"v1 unknown", "PROXY UNKNOWN\r\n", "", false},
+		{"v2", v2, "198.51.100.1:1234", false},
+		{"missing", "GET / HTTP/1.1\r\n", "", true},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := bufio.NewReader(strings.NewReader(tc.header + "rest"))
+			addr, err := readProxyHeader(r)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			var got string
+			if addr != nil {
+				got = addr.String()
+			}
+			if got != tc.want {
+				t.Errorf("addr = %q, want %q", got, tc.want)
+			}
+			rest, _ := r.ReadString(0)
+			if rest != "rest" {
+				t.Errorf("remaining = %q", rest)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package basehttp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NotModified sets the ETag and Last-Modified response headers
+// and reports whether the client's cached copy is still valid,
+// in which case it responds with 304 Not Modified.
+// Either etag or modTime may be empty.
+// Use it to skip generating content when its version is cheap to determine.
+func NotModified(rw http.ResponseWriter, r *http.Request, etag string, modTime time.Time) bool {
+	if etag != "" {
+		rw.Header().Set("ETag", etag)
+	}
+	if !modTime.IsZero() {
+		rw.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etag == "" || !etagMatch(inm, etag) {
+			return false
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modTime.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err != nil || modTime.Truncate(time.Second).After(t) {
+			return false
+		}
+	} else {
+		return false
+	}
+
+	h := rw.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	rw.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatch compares etags in an If-None-Match header with weak comparison.
+func etagMatch(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Conditional buffers successful GET and HEAD responses from next,
+// adding a content hash ETag if next didn't set one,
+// and responding with 304 Not Modified if the client has a current copy.
+// HEAD requests are served by next as GET,
+// so they get the same ETag without a body.
+// The ETag includes the values of the request headers listed in Vary,
+// responses shouldn't vary by anything else.
+func Conditional(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		get := r
+		if r.Method == http.MethodHead {
+			get = r.Clone(r.Context())
+			get.Method = http.MethodGet
+		}
+		buf := &bufferedResponse{header: rw.Header(), code: http.StatusOK}
+		next.ServeHTTP(buf, get)
+
+		if buf.code != http.StatusOK {
+			buf.writeTo(rw, r)
+			return
+		}
+
+		etag := rw.Header().Get("ETag")
+		if etag == "" {
+			etag = contentETag(rw.Header(), r, buf.body.Bytes())
+		}
+		var modTime time.Time
+		if lm := rw.Header().Get("Last-Modified"); lm != "" {
+			modTime, _ = http.ParseTime(lm)
+		}
+		if NotModified(rw, r, etag, modTime) {
+			return
+		}
+		buf.writeTo(rw, r)
+	})
+}
+
+// contentETag hashes the body with the values of the request headers
+// the response varies by,
+// so differently negotiated representations get different etags.
+func contentETag(h http.Header, r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write(body)
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			fmt.Fprintf(hash, "\x00%s:%s", http.CanonicalHeaderKey(name), strings.Join(r.Header.Values(name), ","))
+		}
+	}
+	return `"` + base64.RawURLEncoding.EncodeToString(hash.Sum(nil)[:18]) + `"`
+}
+
+// bufferedResponse holds a response until it's complete,
+// sharing headers with the underlying ResponseWriter.
+type bufferedResponse struct {
+	header      http.Header
+	code        int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	if b.wroteHeader {
+		return
+	}
+	b.wroteHeader = true
+	b.code = code
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+// writeTo writes the buffered response,
+// only the length of the body for HEAD requests.
+func (b *bufferedResponse) writeTo(rw http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodHead {
+		if rw.Header().Get("Content-Length") == "" {
+			rw.Header().Set("Content-Length", strconv.Itoa(b.body.Len()))
+		}
+		rw.WriteHeader(b.code)
+		return
+	}
+	rw.WriteHeader(b.code)
+	rw.Write(b.body.Bytes())
+}
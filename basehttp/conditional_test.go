@@ -0,0 +1,100 @@
+package basehttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConditional(t *testing.T) {
+	t.Parallel()
+
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := Conditional(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/modtime" {
+			rw.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+		}
+		io.WriteString(rw, "hello")
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" || etag == "" {
+		t.Fatalf("initial response: %d %q etag=%q", rec.Code, rec.Body, etag)
+	}
+
+	tcs := []struct {
+		name     string
+		path     string
+		header   string
+		value    string
+		wantCode int
+	}{
+		{"matching etag", "/", "If-None-Match", etag, http.StatusNotModified},
+		{"weak etag", "/", "If-None-Match", `"other", W/` + etag, http.StatusNotModified},
+		{"stale etag", "/", "If-None-Match", `"other"`, http.StatusOK},
+		{"not modified since", "/modtime", "If-Modified-Since", modTime.Add(time.Hour).Format(http.TimeFormat), http.StatusNotModified},
+		{"modified since", "/modtime", "If-Modified-Since", modTime.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			r.Header.Set(tc.header, tc.value)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			if rec.Code != tc.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantCode)
+			}
+			if tc.wantCode == http.StatusNotModified && rec.Body.Len() != 0 {
+				t.Errorf("body in not modified response: %q", rec.Body)
+			}
+		})
+	}
+}
+
+func TestConditionalHeadVary(t *testing.T) {
+	t.Parallel()
+
+	h := Conditional(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Vary", "Accept-Language")
+		if r.Header.Get("Accept-Language") == "fr" {
+			io.WriteString(rw, "bonjour")
+			return
+		}
+		io.WriteString(rw, "hello")
+	}))
+	serve := func(method, lang string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/", nil)
+		if lang != "" {
+			r.Header.Set("Accept-Language", lang)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	get := serve(http.MethodGet, "")
+	head := serve(http.MethodHead, "")
+	if head.Header().Get("ETag") != get.Header().Get("ETag") {
+		t.Errorf("head etag = %q, get etag = %q", head.Header().Get("ETag"), get.Header().Get("ETag"))
+	}
+	if head.Body.Len() != 0 || head.Header().Get("Content-Length") != "5" {
+		t.Errorf("head response: body %q content-length %q", head.Body, head.Header().Get("Content-Length"))
+	}
+
+	// the same body negotiated by different headers
+	h = Conditional(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Vary", "Accept-Language")
+		io.WriteString(rw, "hello")
+	}))
+	if serve(http.MethodGet, "en").Header().Get("ETag") == serve(http.MethodGet, "de").Header().Get("ETag") {
+		t.Errorf("same etag for different Vary header values")
+	}
+}
@@ -0,0 +1,140 @@
+package basehttp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrInvalidCookie is returned for cookies that fail to decrypt or have expired.
+var ErrInvalidCookie = errors.New("invalid cookie")
+
+// Cookies encrypts and authenticates cookie values.
+// Values are encoded with the first key,
+// and decoded with any key to allow rotation.
+type Cookies struct {
+	// Path, Domain, Secure, and SameSite are applied to all cookies set.
+	Path     string
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+
+	aeads []cipher.AEAD
+}
+
+// NewCookies returns a cookie codec with secure defaults,
+// using keys of any length, newest first.
+func NewCookies(keys ...[]byte) (*Cookies, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no cookie keys")
+	}
+	c := &Cookies{
+		Path:     "/",
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	for _, key := range keys {
+		k := sha256.Sum256(key)
+		block, err := aes.NewCipher(k[:])
+		if err != nil {
+			return nil, fmt.Errorf("create cipher: %w", err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("create aead: %w", err)
+		}
+		c.aeads = append(c.aeads, aead)
+	}
+	return c, nil
+}
+
+// Set encodes v as json into the named cookie,
+// valid for maxAge or the browser session if 0.
+func (c *Cookies) Set(rw http.ResponseWriter, name string, v any, maxAge time.Duration) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode cookie %s: %w", name, err)
+	}
+	var expires time.Time
+	if maxAge != 0 {
+		expires = time.Now().Add(maxAge)
+	}
+
+	// plaintext is the expiry in unix seconds followed by the value
+	plain := binary.BigEndian.AppendUint64(nil, uint64(max(expires.Unix(), 0)))
+	plain = append(plain, b...)
+
+	aead := c.aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	rand.Read(nonce)
+	sealed := aead.Seal(nonce, nonce, plain, []byte(name))
+
+	http.SetCookie(rw, c.cookie(name, base64.RawURLEncoding.EncodeToString(sealed), expires))
+	return nil
+}
+
+// Get decodes the named cookie into v.
+// It returns http.ErrNoCookie if the cookie isn't present,
+// or ErrInvalidCookie if it can't be decoded.
+func (c *Cookies) Get(r *http.Request, name string, v any) error {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return ErrInvalidCookie
+	}
+
+	var plain []byte
+	for _, aead := range c.aeads {
+		if len(sealed) < aead.NonceSize() {
+			continue
+		}
+		plain, err = aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(name))
+		if err == nil {
+			break
+		}
+	}
+	if plain == nil || len(plain) < 8 {
+		return ErrInvalidCookie
+	}
+
+	expires := int64(binary.BigEndian.Uint64(plain))
+	if expires != 0 && time.Now().Unix() > expires {
+		return ErrInvalidCookie
+	}
+	err = json.Unmarshal(plain[8:], v)
+	if err != nil {
+		return fmt.Errorf("decode cookie %s: %w", name, err)
+	}
+	return nil
+}
+
+// Delete removes the named cookie.
+func (c *Cookies) Delete(rw http.ResponseWriter, name string) {
+	cookie := c.cookie(name, "", time.Time{})
+	cookie.MaxAge = -1
+	http.SetCookie(rw, cookie)
+}
+
+func (c *Cookies) cookie(name, value string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     c.Path,
+		Domain:   c.Domain,
+		Expires:  expires,
+		Secure:   c.Secure,
+		HttpOnly: true,
+		SameSite: c.SameSite,
+	}
+}
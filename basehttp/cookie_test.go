@@ -0,0 +1,89 @@
+package basehttp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCookies(t *testing.T) {
+	t.Parallel()
+
+	type session struct {
+		User string
+	}
+
+	oldKeys, _ := NewCookies([]byte("old"))
+	rotated, _ := NewCookies([]byte("new"), []byte("old"))
+	other, _ := NewCookies([]byte("other"))
+
+	tcs := []struct {
+		name    string
+		set     *Cookies
+		get     *Cookies
+		maxAge  time.Duration
+		setName string
+		wantErr error
+	}{
+		{
+			name:   "roundtrip",
+			set:    rotated,
+			get:    rotated,
+			maxAge: time.Hour,
+		}, {
+			name: "rotated key",
+			set:  oldKeys,
+			get:  rotated,
+		}, {
+			name:    "unknown key",
+			set:     other,
+			get:     rotated,
+			wantErr: ErrInvalidCookie,
+		}, {
+			name:    "expired",
+			set:     rotated,
+			get:     rotated,
+			maxAge:  -time.Hour,
+			wantErr: ErrInvalidCookie,
+		}, {
+			name:    "swapped name",
+			set:     rotated,
+			get:     rotated,
+			setName: "other",
+			wantErr: ErrInvalidCookie,
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			err := tc.set.Set(rec, "session", session{User: "alice"}, tc.maxAge)
+			if err != nil {
+				t.Fatalf("set: %v", err)
+			}
+			cookie := rec.Result().Cookies()[0]
+			if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode {
+				t.Errorf("insecure cookie: %v", cookie)
+			}
+			if tc.setName != "" {
+				cookie.Name = tc.setName
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.AddCookie(cookie)
+			var got session
+			err = tc.get.Get(r, cookie.Name, &got)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("get: err = %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantErr == nil && got.User != "alice" {
+				t.Errorf("got = %+v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package basehttp
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS configures cross origin resource sharing.
+type CORS struct {
+	// Origins allowed to make requests, "*" allows any origin
+	// but can't be used with Credentials.
+	Origins []string
+	// Methods allowed in addition to simple methods.
+	Methods []string
+	// Headers allowed in requests.
+	Headers []string
+	// Credentials allows cookies and auth headers.
+	Credentials bool
+	// MaxAge is how long preflight results may be cached.
+	MaxAge time.Duration
+}
+
+// Validate rejects allowing credentials from any origin,
+// which would let any site make authenticated requests.
+func (c *CORS) Validate() error {
+	if c.Credentials && slices.Contains(c.Origins, "*") {
+		return errors.New("cors credentials can't be allowed for any origin")
+	}
+	return nil
+}
+
+func (c *CORS) allowOrigin(origin string) bool {
+	return slices.Contains(c.Origins, "*") || slices.Contains(c.Origins, origin)
+}
+
+// Handler wraps next with cors headers and preflight handling.
+// Credentials are never allowed with the "*" origin, see Validate.
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	wildcard := slices.Contains(c.Origins, "*")
+	credentials := c.Credentials && !wildcard
+	methods := strings.Join(c.Methods, ", ")
+	headers := strings.Join(c.Headers, ", ")
+	maxAge := strconv.Itoa(int(c.MaxAge.Seconds()))
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		rw.Header().Add("Vary", "Origin")
+		if origin == "" || !c.allowOrigin(origin) {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		if wildcard {
+			rw.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			rw.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if credentials {
+			rw.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if !preflight {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		rw.Header().Add("Vary", "Access-Control-Request-Method")
+		rw.Header().Add("Vary", "Access-Control-Request-Headers")
+		if methods != "" {
+			rw.Header().Set("Access-Control-Allow-Methods", methods)
+		}
+		if headers != "" {
+			rw.Header().Set("Access-Control-Allow-Headers", headers)
+		}
+		if c.MaxAge > 0 {
+			rw.Header().Set("Access-Control-Max-Age", maxAge)
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// commaList is a flag of comma separated values.
+type commaList []string
+
+func (l *commaList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *commaList) Set(s string) error {
+	*l = nil
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package basehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	t.Parallel()
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+	})
+
+	tcs := []struct {
+		name       string
+		cors       CORS
+		method     string
+		headers    map[string]string
+		wantStatus int
+		wantHeader map[string]string
+	}{
+		{
+			name:       "no origin",
+			cors:       CORS{Origins: []string{"https://a.example"}},
+			method:     http.MethodGet,
+			wantStatus: http.StatusTeapot,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": ""},
+		}, {
+			name:       "disallowed origin",
+			cors:       CORS{Origins: []string{"https://a.example"}},
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://b.example"},
+			wantStatus: http.StatusTeapot,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": ""},
+		}, {
+			name:       "allowed origin",
+			cors:       CORS{Origins: []string{"https://a.example"}},
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://a.example"},
+			wantStatus: http.StatusTeapot,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": "https://a.example"},
+		}, {
+			name:       "wildcard",
+			cors:       CORS{Origins: []string{"*"}},
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://b.example"},
+			wantStatus: http.StatusTeapot,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": "*"},
+		}, {
+			name:       "wildcard ignores credentials",
+			cors:       CORS{Origins: []string{"*"}, Credentials: true},
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://b.example"},
+			wantStatus: http.StatusTeapot,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Credentials": "",
+			},
+		}, {
+			name: "preflight",
+			cors: CORS{
+				Origins: []string{"https://a.example"},
+				Methods: []string{http.MethodPut},
+				Headers: []string{"Content-Type"},
+				MaxAge:  time.Hour,
+			},
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        "https://a.example",
+				"Access-Control-Request-Method": http.MethodPut,
+			},
+			wantStatus: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":  "https://a.example",
+				"Access-Control-Allow-Methods": "PUT",
+				"Access-Control-Allow-Headers": "Content-Type",
+				"Access-Control-Max-Age":       "3600",
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tc.method, "/", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			tc.cors.Handler(next).ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+			for k, v := range tc.wantHeader {
+				if got := rec.Header().Get(k); got != v {
+					t.Errorf("header %s = %q, want %q", k, got, v)
+				}
+			}
+		})
+	}
+}
+
+func TestCORSValidate(t *testing.T) {
+	t.Parallel()
+
+	err := (&CORS{Origins: []string{"*"}, Credentials: true}).Validate()
+	if err == nil {
+		t.Errorf("expected error for credentials with any origin")
+	}
+	err = (&CORS{Origins: []string{"https://a.example"}, Credentials: true}).Validate()
+	if err != nil {
+		t.Errorf("credentials with listed origins: %v", err)
+	}
+}
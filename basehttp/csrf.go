@@ -0,0 +1,78 @@
+package basehttp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+const (
+	csrfCookie = "csrf"
+	csrfHeader = "X-Csrf-Token"
+	// CSRFField is the form field checked for the csrf token.
+	CSRFField = "csrf_token"
+)
+
+type csrfTokenKey struct{}
+
+// CSRFToken returns the token to submit with requests that change state,
+// in the X-Csrf-Token header or the CSRFField form field.
+func CSRFToken(ctx context.Context) string {
+	token, _ := ctx.Value(csrfTokenKey{}).(string)
+	return token
+}
+
+// CSRF protects unsafe requests against cross site request forgery.
+// Requests the browser marks as same origin through Sec-Fetch-Site are allowed,
+// otherwise they must submit the token from a cookie set by this middleware,
+// available to handlers and templates through CSRFToken.
+func CSRF(o *observability.O, cookies *Cookies, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		var token string
+		err := cookies.Get(r, csrfCookie, &token)
+		if err != nil || token == "" {
+			token = newCSRFToken()
+			err = cookies.Set(rw, csrfCookie, token, 0)
+			if err != nil {
+				o.HTTPErr(ctx, "set csrf cookie", err, rw, http.StatusInternalServerError)
+				return
+			}
+		}
+		r = r.WithContext(context.WithValue(ctx, csrfTokenKey{}, token))
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(rw, r)
+			return
+		}
+		rw.Header().Add("Vary", "Sec-Fetch-Site")
+		switch r.Header.Get("Sec-Fetch-Site") {
+		case "same-origin", "none":
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		submitted := r.Header.Get(csrfHeader)
+		if submitted == "" {
+			submitted = r.PostFormValue(CSRFField)
+		}
+		if subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) != 1 {
+			clientErr(ctx, o, rw, slog.LevelWarn, http.StatusForbidden, "verify csrf token", errors.New("csrf token mismatch"))
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func newCSRFToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,111 @@
+package basehttp
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+func TestCSRF(t *testing.T) {
+	t.Parallel()
+
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+	cookies, _ := NewCookies([]byte("key"))
+	h := CSRF(o, cookies, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		io.WriteString(rw, CSRFToken(r.Context()))
+	}))
+
+	// issue a token
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	token := rec.Body.String()
+	cookie := rec.Result().Cookies()[0]
+	if token == "" {
+		t.Fatalf("no token issued")
+	}
+
+	tcs := []struct {
+		name      string
+		fetchSite string
+		header    string
+		form      string
+		wantCode  int
+	}{
+		{
+			name:     "missing token",
+			wantCode: http.StatusForbidden,
+		}, {
+			name:     "wrong token",
+			header:   "nope",
+			wantCode: http.StatusForbidden,
+		}, {
+			name:     "header token",
+			header:   token,
+			wantCode: http.StatusOK,
+		}, {
+			name:     "form token",
+			form:     token,
+			wantCode: http.StatusOK,
+		}, {
+			name:      "same origin",
+			fetchSite: "same-origin",
+			wantCode:  http.StatusOK,
+		}, {
+			name:      "cross site",
+			fetchSite: "cross-site",
+			wantCode:  http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			form := url.Values{}
+			if tc.form != "" {
+				form.Set(CSRFField, tc.form)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.AddCookie(cookie)
+			if tc.header != "" {
+				r.Header.Set(csrfHeader, tc.header)
+			}
+			if tc.fetchSite != "" {
+				r.Header.Set("Sec-Fetch-Site", tc.fetchSite)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			if rec.Code != tc.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantCode)
+			}
+		})
+	}
+}
+
+func TestCSRFClientError(t *testing.T) {
+	t.Parallel()
+
+	buf := new(bytes.Buffer)
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: buf})
+	cookies, _ := NewCookies([]byte("key"))
+	h := CSRF(o, cookies, http.NotFoundHandler())
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("Sec-Fetch-Site", "cross-site")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if strings.Contains(buf.String(), `"level":"ERROR"`) {
+		t.Errorf("csrf mismatch logged as an error:\n%s", buf)
+	}
+}
@@ -0,0 +1,110 @@
+package basehttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Health serves liveness and readiness probes.
+type Health struct {
+	// Timeout limits how long all readiness checks may take.
+	Timeout time.Duration
+
+	mu     sync.Mutex
+	checks map[string]func(context.Context) error
+}
+
+func newHealth() *Health {
+	return &Health{
+		Timeout: 5 * time.Second,
+		checks:  make(map[string]func(context.Context) error),
+	}
+}
+
+// AddCheck registers a named readiness check,
+// the service is not ready while any check returns an error.
+func (h *Health) AddCheck(name string, check func(context.Context) error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = check
+}
+
+// RemoveCheck removes a named readiness check.
+func (h *Health) RemoveCheck(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.checks, name)
+}
+
+// Ready runs all readiness checks concurrently,
+// returning the errors of failing checks by name.
+func (h *Health) Ready(ctx context.Context) map[string]error {
+	h.mu.Lock()
+	checks := make(map[string]func(context.Context) error, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	h.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]error, len(checks))
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := check(ctx)
+			mu.Lock()
+			defer mu.Unlock()
+			results[name] = err
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// Register mounts /healthz and /readyz on mux.
+func (h *Health) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", h.serveLive)
+	mux.HandleFunc("GET /readyz", h.serveReady)
+}
+
+func (h *Health) serveLive(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("content-type", "text/plain; charset=utf-8")
+	fmt.Fprintln(rw, "ok")
+}
+
+func (h *Health) serveReady(rw http.ResponseWriter, r *http.Request) {
+	results := h.Ready(r.Context())
+	names := make([]string, 0, len(results))
+	status := http.StatusOK
+	for name, err := range results {
+		names = append(names, name)
+		if err != nil {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	sort.Strings(names)
+
+	rw.Header().Set("content-type", "text/plain; charset=utf-8")
+	rw.WriteHeader(status)
+	for _, name := range names {
+		if err := results[name]; err != nil {
+			fmt.Fprintf(rw, "[-] %s: %v\n", name, err)
+		} else {
+			fmt.Fprintf(rw, "[+] %s: ok\n", name)
+		}
+	}
+	if status == http.StatusOK {
+		fmt.Fprintln(rw, "ready")
+	} else {
+		fmt.Fprintln(rw, "not ready")
+	}
+}
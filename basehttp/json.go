@@ -0,0 +1,134 @@
+package basehttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+// Problem is an RFC 9457 problem details response,
+// usable as an error to respond with.
+type Problem struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// RequestID is set from the request when responding.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+func newProblem(status int, detail string) *Problem {
+	return &Problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// DecodeJSON decodes a json request body of at most limit bytes into a T,
+// unlimited if limit is 0.
+// Unknown fields and trailing data are rejected.
+// Errors are returned as a *Problem for RespondError.
+func DecodeJSON[T any](r *http.Request, limit int64) (T, error) {
+	var v T
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil || (mt != "application/json" && !strings.HasSuffix(mt, "+json")) {
+			return v, newProblem(http.StatusUnsupportedMediaType, fmt.Sprintf("unsupported content type %q", ct))
+		}
+	}
+
+	body := io.Reader(r.Body)
+	if limit > 0 {
+		body = io.LimitReader(r.Body, limit+1)
+	}
+	lr := &countingReader{r: body}
+	dec := json.NewDecoder(lr)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&v)
+	more := err == nil && dec.More()
+	var maxErr *http.MaxBytesError
+	if limit > 0 && lr.n > limit {
+		return v, newProblem(http.StatusRequestEntityTooLarge, fmt.Sprintf("body exceeds %d bytes", limit))
+	} else if errors.As(err, &maxErr) {
+		return v, newProblem(http.StatusRequestEntityTooLarge, fmt.Sprintf("body exceeds %d bytes", maxErr.Limit))
+	} else if err != nil {
+		return v, newProblem(http.StatusBadRequest, "decode json: "+err.Error())
+	} else if more {
+		return v, newProblem(http.StatusBadRequest, "decode json: unexpected data after value")
+	}
+	return v, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// RespondJSON writes v as json with the given status code.
+// v is encoded fully before anything is written,
+// responding with an internal server error if encoding fails.
+func RespondJSON(rw http.ResponseWriter, status int, v any) error {
+	return respondJSON(rw, "application/json", status, v)
+}
+
+func respondJSON(rw http.ResponseWriter, contentType string, status int, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(newProblem(http.StatusInternalServerError, ""))
+		contentType = "application/problem+json"
+		status = http.StatusInternalServerError
+	}
+	rw.Header().Set("Content-Type", contentType)
+	rw.WriteHeader(status)
+	rw.Write(append(b, '\n'))
+	return err
+}
+
+// RespondError logs err and responds with problem+json.
+// A *Problem in err's chain is returned as is,
+// other errors are reported as internal server errors without details.
+// Only server errors are logged through o.Err,
+// client errors are logged at info level.
+func RespondError(o *observability.O, rw http.ResponseWriter, r *http.Request, err error) {
+	ctx := r.Context()
+	p := *newProblem(http.StatusInternalServerError, "")
+	var problem *Problem
+	if errors.As(err, &problem) {
+		// copied as it may be shared between requests
+		p = *problem
+	}
+	if p.RequestID == "" {
+		p.RequestID = RequestID(ctx)
+	}
+	if p.Status >= 500 {
+		o.Err(ctx, "respond with error", err, slog.Int("http.response.status_code", p.Status))
+	} else {
+		o.L.LogAttrs(ctx, slog.LevelInfo, "respond with error",
+			slog.String("error", err.Error()),
+			slog.Int("http.response.status_code", p.Status),
+		)
+	}
+	respondJSON(rw, "application/problem+json", p.Status, &p)
+}
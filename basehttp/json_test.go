@@ -0,0 +1,164 @@
+package basehttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	t.Parallel()
+
+	type req struct {
+		Name string `json:"name"`
+	}
+
+	tcs := []struct {
+		name        string
+		contentType string
+		body        string
+		limit       int64
+		wantStatus  int
+	}{
+		{
+			name:        "ok",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"name": "a"}`,
+		}, {
+			name:        "suffix type",
+			contentType: "application/merge-patch+json",
+			body:        `{"name": "a"}`,
+		}, {
+			name:        "wrong type",
+			contentType: "text/plain",
+			body:        `{"name": "a"}`,
+			wantStatus:  http.StatusUnsupportedMediaType,
+		}, {
+			name:       "unknown field",
+			body:       `{"name": "a", "age": 1}`,
+			wantStatus: http.StatusBadRequest,
+		}, {
+			name:       "trailing data",
+			body:       `{"name": "a"} {}`,
+			wantStatus: http.StatusBadRequest,
+		}, {
+			name:       "too large",
+			body:       `{"name": "` + strings.Repeat("a", 100) + `"}`,
+			limit:      64,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				r.Header.Set("Content-Type", tc.contentType)
+			}
+			got, err := DecodeJSON[req](r, tc.limit)
+			if tc.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				if got.Name != "a" {
+					t.Errorf("got = %+v", got)
+				}
+				return
+			}
+			var p *Problem
+			if !errors.As(err, &p) || p.Status != tc.wantStatus {
+				t.Errorf("err = %v, want status %d", err, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRespondError(t *testing.T) {
+	t.Parallel()
+
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+
+	tcs := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantDetail string
+	}{
+		{
+			name:       "problem",
+			err:        newProblem(http.StatusNotFound, "no such thing"),
+			wantStatus: http.StatusNotFound,
+			wantDetail: "no such thing",
+		}, {
+			name:       "internal",
+			err:        errors.New("database password is hunter2"),
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			RespondError(o, rec, httptest.NewRequest(http.MethodGet, "/", nil), tc.err)
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("content-type = %q", ct)
+			}
+			var p Problem
+			err := json.Unmarshal(rec.Body.Bytes(), &p)
+			if err != nil {
+				t.Fatalf("unmarshal problem: %v", err)
+			}
+			if p.Status != tc.wantStatus || p.Detail != tc.wantDetail {
+				t.Errorf("problem = %+v", p)
+			}
+		})
+	}
+}
+
+func TestRespondErrorShared(t *testing.T) {
+	t.Parallel()
+
+	buf := new(bytes.Buffer)
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: buf})
+	errNotFound := &Problem{Title: "Not Found", Status: http.StatusNotFound}
+
+	for _, id := range []string{"first", "second"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+		rec := httptest.NewRecorder()
+		RespondError(o, rec, r, fmt.Errorf("lookup: %w", errNotFound))
+
+		var p Problem
+		err := json.Unmarshal(rec.Body.Bytes(), &p)
+		if err != nil {
+			t.Fatalf("unmarshal problem: %v", err)
+		}
+		if p.RequestID != id {
+			t.Errorf("request id = %q, want %q", p.RequestID, id)
+		}
+	}
+	if errNotFound.RequestID != "" {
+		t.Errorf("shared problem modified: %+v", errNotFound)
+	}
+	if strings.Contains(buf.String(), `"level":"ERROR"`) {
+		t.Errorf("client error logged as an error:\n%s", buf)
+	}
+}
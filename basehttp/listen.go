@@ -0,0 +1,65 @@
+package basehttp
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+)
+
+const unixPrefix = "unix://"
+
+// listen listens on a tcp address,
+// or a unix socket path if addr starts with unix://.
+// Abstract unix sockets start with @, as in unix://@name.
+func (c *Config) listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, unixPrefix)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if strings.HasPrefix(path, "@") {
+		return net.Listen("unix", path)
+	}
+
+	err := removeStaleSocket(path)
+	if err != nil {
+		return nil, err
+	}
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if c.UnixMode != 0 {
+		err = os.Chmod(path, c.UnixMode)
+		if err != nil {
+			lis.Close()
+			return nil, fmt.Errorf("set socket permissions: %w", err)
+		}
+	}
+	return lis, nil
+}
+
+// removeStaleSocket removes a socket file left behind by a previous process,
+// refusing to remove other files or sockets that are still in use.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fi.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use", path)
+	} else if !errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("check socket %s: %w", path, err)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,54 @@
+package basehttp
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	c := &Config{UnixMode: 0o600}
+
+	t.Run("stale socket", func(t *testing.T) {
+		path := filepath.Join(dir, "stale.sock")
+		lis, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lis.(*net.UnixListener).SetUnlinkOnClose(false)
+		lis.Close()
+
+		lis, err = c.listen(unixPrefix + path)
+		if err != nil {
+			t.Fatalf("listen over stale socket: %v", err)
+		}
+		defer lis.Close()
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != 0o600 {
+			t.Errorf("mode = %v, want %v", fi.Mode().Perm(), os.FileMode(0o600))
+		}
+
+		_, err = c.listen(unixPrefix + path)
+		if err == nil {
+			t.Errorf("listen on socket in use: expected error")
+		}
+	})
+	t.Run("not a socket", func(t *testing.T) {
+		path := filepath.Join(dir, "file")
+		err := os.WriteFile(path, nil, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = c.listen(unixPrefix + path)
+		if err == nil {
+			t.Errorf("listen over regular file: expected error")
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package basehttp
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+)
+
+const defaultMaintenancePage = `<!doctype html>
+<title>maintenance</title>
+<h1>down for maintenance</h1>
+<p>please try again later</p>
+`
+
+// maintenance responds to all requests except health checks
+// with a maintenance page while enabled.
+type maintenance struct {
+	on   atomic.Bool
+	page []byte
+}
+
+func (m *maintenance) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !m.on.Load() || r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(rw, r)
+			return
+		}
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		rw.Header().Set("Cache-Control", "no-store")
+		rw.Header().Set("Retry-After", "60")
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		rw.Write(m.page)
+	})
+}
+
+// SetMaintenance turns maintenance mode on or off.
+func (h *HTTP) SetMaintenance(ctx context.Context, on bool) {
+	if h.maintenance.on.Swap(on) != on {
+		h.O.L.LogAttrs(ctx, slog.LevelWarn, "maintenance mode changed", slog.Bool("enabled", on))
+	}
+}
+
+// InMaintenance reports whether maintenance mode is on.
+func (h *HTTP) InMaintenance() bool {
+	return h.maintenance.on.Load()
+}
+
+// loadMaintenancePage reads the configured page,
+// replacing the default.
+func (h *HTTP) loadMaintenancePage() error {
+	if h.conf.MaintenancePage == "" {
+		return nil
+	}
+	page, err := os.ReadFile(h.conf.MaintenancePage)
+	if err != nil {
+		return err
+	}
+	h.maintenance.page = page
+	return nil
+}
+
+// toggleMaintenanceOnSignal flips maintenance mode on SIGUSR2 until ctx is done.
+func (h *HTTP) toggleMaintenanceOnSignal(ctx context.Context) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR2)
+	go func() {
+		defer signal.Stop(sig)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sig:
+				h.SetMaintenance(ctx, !h.InMaintenance())
+			}
+		}
+	}()
+}
+
+// serveMaintenance reports maintenance mode on GET,
+// and changes it on POST with enabled=true|false.
+func (h *HTTP) serveMaintenance(rw http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		on, err := strconv.ParseBool(r.FormValue("enabled"))
+		if err != nil {
+			clientErr(r.Context(), h.O, rw, slog.LevelWarn, http.StatusBadRequest, "parse maintenance mode", err)
+			return
+		}
+		h.SetMaintenance(r.Context(), on)
+	}
+	rw.Write([]byte(strconv.FormatBool(h.InMaintenance()) + "\n"))
+}
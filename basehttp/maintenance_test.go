@@ -0,0 +1,72 @@
+package basehttp
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+func TestMaintenance(t *testing.T) {
+	t.Parallel()
+
+	m := &maintenance{page: []byte("down")}
+	m.on.Store(true)
+	h := m.handler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+
+	tcs := []struct {
+		path     string
+		wantCode int
+	}{
+		{"/", http.StatusServiceUnavailable},
+		{"/api/thing", http.StatusServiceUnavailable},
+		{"/healthz", http.StatusOK},
+		{"/readyz", http.StatusOK},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.path, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if rec.Code != tc.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantCode)
+			}
+		})
+	}
+}
+
+func TestServeMaintenance(t *testing.T) {
+	t.Parallel()
+
+	buf := new(bytes.Buffer)
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: buf})
+	h := New(context.Background(), o, &Config{AdminAddress: "127.0.0.1:0"})
+
+	post := func(enabled string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/maintenance", strings.NewReader(url.Values{"enabled": {enabled}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		h.AdminMux.ServeHTTP(rec, r)
+		return rec
+	}
+
+	rec := post("true")
+	if rec.Code != http.StatusOK || !h.InMaintenance() {
+		t.Errorf("enable: status = %d, maintenance = %v", rec.Code, h.InMaintenance())
+	}
+	rec = post("maybe")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if strings.Contains(buf.String(), `"level":"ERROR"`) {
+		t.Errorf("client error logged as error:\n%s", buf)
+	}
+}
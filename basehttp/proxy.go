@@ -0,0 +1,64 @@
+package basehttp
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+// Proxy configures a reverse proxy to a single upstream.
+type Proxy struct {
+	// Target is the upstream base url,
+	// request paths are joined to its path.
+	Target *url.URL
+	// Timeout limits the wait for upstream response headers, disabled if 0.
+	Timeout time.Duration
+	// SetHeaders are set on requests sent upstream.
+	SetHeaders http.Header
+	// RemoveHeaders are removed from requests sent upstream.
+	RemoveHeaders []string
+	// PreserveHost sends the incoming Host header upstream
+	// instead of the target's host.
+	PreserveHost bool
+}
+
+// NewReverseProxy returns a reverse proxy with an instrumented transport,
+// setting X-Forwarded-* headers and reporting upstream errors through o.
+func NewReverseProxy(o *observability.O, p Proxy) *httputil.ReverseProxy {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = p.Timeout
+
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(p.Target)
+			pr.SetXForwarded()
+			if p.PreserveHost {
+				pr.Out.Host = pr.In.Host
+			}
+			for _, k := range p.RemoveHeaders {
+				pr.Out.Header.Del(k)
+			}
+			for k, v := range p.SetHeaders {
+				pr.Out.Header[http.CanonicalHeaderKey(k)] = v
+			}
+		},
+		Transport: otelhttp.NewTransport(transport),
+		ErrorLog:  slog.NewLogLogger(o.H, slog.LevelWarn),
+		ErrorHandler: func(rw http.ResponseWriter, r *http.Request, err error) {
+			code := http.StatusBadGateway
+			var netErr net.Error
+			if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+				code = http.StatusGatewayTimeout
+			}
+			o.HTTPErr(r.Context(), "proxy upstream", err, rw, code, slog.String("upstream", p.Target.Host))
+		},
+	}
+}
@@ -0,0 +1,86 @@
+package basehttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+func TestReverseProxy(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/base/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		rw.Header().Set("x-path", r.URL.Path)
+		rw.Header().Set("x-added", r.Header.Get("x-added"))
+		rw.Header().Set("x-removed", r.Header.Get("x-removed"))
+		rw.Header().Set("x-forwarded-host", r.Header.Get("x-forwarded-host"))
+	}))
+	t.Cleanup(upstream.Close)
+	target, _ := url.Parse(upstream.URL + "/base")
+	closed, _ := url.Parse("http://127.0.0.1:1")
+
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+
+	tcs := []struct {
+		name       string
+		proxy      Proxy
+		path       string
+		wantCode   int
+		wantHeader map[string]string
+	}{
+		{
+			name: "rewrite",
+			proxy: Proxy{
+				Target:        target,
+				SetHeaders:    http.Header{"x-added": {"yes"}},
+				RemoveHeaders: []string{"x-removed"},
+			},
+			path:     "/a",
+			wantCode: http.StatusOK,
+			wantHeader: map[string]string{
+				"x-path":           "/base/a",
+				"x-added":          "yes",
+				"x-removed":        "",
+				"x-forwarded-host": "example.com",
+			},
+		}, {
+			name:     "timeout",
+			proxy:    Proxy{Target: target, Timeout: 50 * time.Millisecond},
+			path:     "/slow",
+			wantCode: http.StatusGatewayTimeout,
+		}, {
+			name:     "unreachable",
+			proxy:    Proxy{Target: closed},
+			path:     "/",
+			wantCode: http.StatusBadGateway,
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			r.Header.Set("x-removed", "no")
+			rec := httptest.NewRecorder()
+			NewReverseProxy(o, tc.proxy).ServeHTTP(rec, r)
+			if rec.Code != tc.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantCode)
+			}
+			for k, v := range tc.wantHeader {
+				if got := rec.Header().Get(k); got != v {
+					t.Errorf("header %s = %q, want %q", k, got, v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package basehttp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+var proxyV2Sig = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyProtoListener reads PROXY protocol v1 or v2 headers
+// from connections made by trusted proxies.
+type proxyProtoListener struct {
+	net.Listener
+	trusted Prefixes
+}
+
+func (l *proxyProtoListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	addrPort, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+	if err != nil || !l.trusted.contains(addrPort.Addr()) {
+		return conn, nil
+	}
+	return &proxyProtoConn{Conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+// proxyProtoConn parses the header on first use,
+// from the connection's own goroutine instead of the accept loop.
+type proxyProtoConn struct {
+	net.Conn
+	r *bufio.Reader
+
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+func (c *proxyProtoConn) init() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		c.remote, c.err = readProxyHeader(c.r)
+		c.Conn.SetReadDeadline(time.Time{})
+		if c.err != nil {
+			c.Conn.Close()
+		}
+	})
+}
+
+func (c *proxyProtoConn) Read(p []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(p)
+}
+
+func (c *proxyProtoConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader returns the client address from a PROXY protocol header,
+// or nil if the proxy didn't provide one.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	peek, err := r.Peek(len(proxyV2Sig))
+	if err != nil {
+		return nil, fmt.Errorf("read proxy header: %w", err)
+	}
+	if bytes.Equal(peek, proxyV2Sig) {
+		return readProxyV2(r)
+	}
+	if bytes.HasPrefix(peek, []byte("PROXY ")) {
+		return readProxyV1(r)
+	}
+	return nil, errors.New("missing proxy header")
+}
+
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil || len(line) > 107 {
+		return nil, errors.New("invalid proxy v1 header")
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 {
+		return nil, errors.New("invalid proxy v1 header")
+	}
+	addrPort, err := netip.ParseAddrPort(net.JoinHostPort(fields[2], fields[4]))
+	if err != nil {
+		return nil, fmt.Errorf("parse proxy v1 source: %w", err)
+	}
+	return net.TCPAddrFromAddrPort(addrPort), nil
+}
+
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	hdr := make([]byte, 16)
+	_, err := io.ReadFull(r, hdr)
+	if err != nil {
+		return nil, fmt.Errorf("read proxy v2 header: %w", err)
+	}
+	if hdr[12]>>4 != 2 {
+		return nil, errors.New("unsupported proxy protocol version")
+	}
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	_, err = io.ReadFull(r, body)
+	if err != nil {
+		return nil, fmt.Errorf("read proxy v2 addresses: %w", err)
+	}
+
+	// LOCAL connections are from the proxy itself
+	if hdr[12]&0xf == 0 {
+		return nil, nil
+	}
+	switch hdr[13] >> 4 {
+	case 1: // AF_INET
+		if len(body) < 12 {
+			return nil, errors.New("short proxy v2 ipv4 addresses")
+		}
+		addr := netip.AddrFrom4([4]byte(body[0:4]))
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, binary.BigEndian.Uint16(body[8:10]))), nil
+	case 2: // AF_INET6
+		if len(body) < 36 {
+			return nil, errors.New("short proxy v2 ipv6 addresses")
+		}
+		addr := netip.AddrFrom16([16]byte(body[0:16]))
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, binary.BigEndian.Uint16(body[32:34]))), nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,54 @@
+package basehttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Readiness tracks conditions the application sets as it becomes ready,
+// and unsets with a reason when it stops being ready,
+// such as when a dependency is unavailable.
+// It is registered as the "readiness" check of Health.
+type Readiness struct {
+	mu       sync.Mutex
+	notReady map[string]string
+}
+
+func newReadiness() *Readiness {
+	return &Readiness{
+		notReady: make(map[string]string),
+	}
+}
+
+// Set marks the condition as ready.
+func (r *Readiness) Set(condition string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.notReady, condition)
+}
+
+// Unset marks the condition as not ready for reason.
+func (r *Readiness) Unset(condition, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notReady[condition] = reason
+}
+
+// Check returns an error describing the conditions that are not ready.
+func (r *Readiness) Check(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conditions := make([]string, 0, len(r.notReady))
+	for condition := range r.notReady {
+		conditions = append(conditions, condition)
+	}
+	sort.Strings(conditions)
+	var errs []error
+	for _, condition := range conditions {
+		errs = append(errs, fmt.Errorf("%s: %s", condition, r.notReady[condition]))
+	}
+	return errors.Join(errs...)
+}
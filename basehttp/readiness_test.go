@@ -0,0 +1,29 @@
+package basehttp
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReadiness(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	r := newReadiness()
+	if err := r.Check(ctx); err != nil {
+		t.Errorf("initial check = %v, want nil", err)
+	}
+
+	r.Unset("db", "connecting")
+	r.Unset("cache", "loading")
+	err := r.Check(ctx)
+	if want := "cache: loading\ndb: connecting"; err == nil || err.Error() != want {
+		t.Errorf("check = %v, want %q", err, want)
+	}
+
+	r.Set("cache")
+	r.Set("db")
+	if err := r.Check(ctx); err != nil {
+		t.Errorf("check after set = %v, want nil", err)
+	}
+}
@@ -0,0 +1,62 @@
+package basehttp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+const requestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// RequestID returns the id of the request being handled,
+// or the empty string if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestID accepts or generates a request id,
+// recording it in the response, logs, and trace.
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		ctx := r.Context()
+		ctx = context.WithValue(ctx, requestIDKey{}, id)
+		ctx = observability.WithLogAttrs(ctx, slog.String("request_id", id))
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("http.request_id", id))
+		rw.Header().Set(requestIDHeader, id)
+
+		next.ServeHTTP(rw, r.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID limits accepted ids to a reasonable length of visible ascii.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,28 @@
+package basehttp
+
+import (
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Route registers handler on mux for pattern,
+// naming spans and labeling metrics and access logs with the route
+// instead of grouping all requests together.
+func Route(mux *http.ServeMux, pattern string, handler http.Handler) {
+	route := pattern
+	if _, path, ok := strings.Cut(route, " "); ok {
+		route = strings.TrimLeft(path, " \t")
+	}
+	if i := strings.IndexByte(route, '/'); i > 0 {
+		route = route[i:] // drop host
+	}
+
+	tagged := otelhttp.WithRouteTag(route, handler)
+	mux.Handle(pattern, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		trace.SpanFromContext(r.Context()).SetName(r.Method + " " + route)
+		tagged.ServeHTTP(rw, r)
+	}))
+}
@@ -0,0 +1,49 @@
+package basehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+func TestRoute(t *testing.T) {
+	t.Parallel()
+
+	tcs := []struct {
+		pattern   string
+		method    string
+		url       string
+		wantRoute string
+	}{
+		{"/items/{id}", http.MethodGet, "/items/1", "/items/{id}"},
+		{"GET /items/{id}", http.MethodGet, "/items/2", "/items/{id}"},
+		{"POST example.com/things/", http.MethodPost, "http://example.com/things/a", "/things/"},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.pattern, func(t *testing.T) {
+			t.Parallel()
+
+			mux := http.NewServeMux()
+			Route(mux, tc.pattern, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+
+			labeler := &otelhttp.Labeler{}
+			r := httptest.NewRequest(tc.method, tc.url, nil)
+			r = r.WithContext(otelhttp.ContextWithLabeler(r.Context(), labeler))
+			mux.ServeHTTP(httptest.NewRecorder(), r)
+
+			var got string
+			for _, attr := range labeler.Get() {
+				if attr.Key == "http.route" {
+					got = attr.Value.AsString()
+				}
+			}
+			if got != tc.wantRoute {
+				t.Errorf("route = %q, want %q", got, tc.wantRoute)
+			}
+		})
+	}
+}
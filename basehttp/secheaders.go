@@ -0,0 +1,66 @@
+package basehttp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SecurityHeaders configures security related response headers.
+type SecurityHeaders struct {
+	// HSTSMaxAge is how long browsers should only use https, disabled if 0.
+	HSTSMaxAge time.Duration
+	// ReferrerPolicy sets Referrer-Policy, disabled if empty.
+	ReferrerPolicy string
+	// FrameOptions sets X-Frame-Options, disabled if empty.
+	FrameOptions string
+	// CSP sets Content-Security-Policy, disabled if empty.
+	// {nonce} is replaced by a per request nonce, available from CSPNonce.
+	CSP string
+}
+
+type cspNonceKey struct{}
+
+// CSPNonce returns the nonce allowed by the request's Content-Security-Policy,
+// or the empty string if there is none.
+func CSPNonce(ctx context.Context) string {
+	nonce, _ := ctx.Value(cspNonceKey{}).(string)
+	return nonce
+}
+
+// Handler wraps next, setting security headers on all responses.
+func (s *SecurityHeaders) Handler(next http.Handler) http.Handler {
+	hsts := "max-age=" + strconv.Itoa(int(s.HSTSMaxAge.Seconds())) + "; includeSubDomains"
+	useNonce := strings.Contains(s.CSP, "{nonce}")
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		h := rw.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		if s.HSTSMaxAge > 0 {
+			h.Set("Strict-Transport-Security", hsts)
+		}
+		if s.ReferrerPolicy != "" {
+			h.Set("Referrer-Policy", s.ReferrerPolicy)
+		}
+		if s.FrameOptions != "" {
+			h.Set("X-Frame-Options", s.FrameOptions)
+		}
+		if useNonce {
+			nonce := newNonce()
+			h.Set("Content-Security-Policy", strings.ReplaceAll(s.CSP, "{nonce}", nonce))
+			r = r.WithContext(context.WithValue(r.Context(), cspNonceKey{}, nonce))
+		} else if s.CSP != "" {
+			h.Set("Content-Security-Policy", s.CSP)
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,50 @@
+package basehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	t.Parallel()
+
+	s := &SecurityHeaders{
+		HSTSMaxAge:     time.Hour,
+		ReferrerPolicy: "no-referrer",
+		FrameOptions:   "DENY",
+		CSP:            "script-src 'nonce-{nonce}'",
+	}
+	var nonce string
+	h := s.Handler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		nonce = CSPNonce(r.Context())
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if nonce == "" {
+		t.Fatalf("no nonce in request context")
+	}
+	want := map[string]string{
+		"X-Content-Type-Options":    "nosniff",
+		"Strict-Transport-Security": "max-age=3600; includeSubDomains",
+		"Referrer-Policy":           "no-referrer",
+		"X-Frame-Options":           "DENY",
+		"Content-Security-Policy":   "script-src 'nonce-" + nonce + "'",
+	}
+	for k, v := range want {
+		if got := rec.Header().Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+
+	first := nonce
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if strings.Contains(rec.Header().Get("Content-Security-Policy"), first) {
+		t.Errorf("nonce reused across requests")
+	}
+}
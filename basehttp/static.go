@@ -0,0 +1,134 @@
+package basehttp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fingerprinted matches file names containing a content hash,
+// such as app.3f2a9c1d.js or app-3f2a9c1d.css.
+var fingerprinted = regexp.MustCompile(`[.-][0-9a-fA-F]{8,}\.[^./]+$`)
+
+// Static serves files from an fs.FS, such as an embed.FS.
+type Static struct {
+	FS fs.FS
+	// Index serves index.html for directories,
+	// otherwise requests for directories are not found.
+	Index bool
+	// MaxAge is how long clients may cache files without a fingerprint in their name.
+	// Fingerprinted files are cached for a year and marked immutable.
+	MaxAge time.Duration
+
+	etags sync.Map // etagKey -> string
+}
+
+type etagKey struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (s *Static) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "."
+	}
+
+	f, fi, err := s.open(name)
+	if err != nil {
+		s.error(rw, err)
+		return
+	}
+	defer f.Close()
+
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			http.Error(rw, "read file", http.StatusInternalServerError)
+			return
+		}
+		rs = strings.NewReader(string(b))
+	}
+
+	etag, err := s.etag(name, fi, rs)
+	if err != nil {
+		http.Error(rw, "hash file", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("etag", etag)
+
+	switch {
+	case fingerprinted.MatchString(fi.Name()):
+		rw.Header().Set("cache-control", "public, max-age=31536000, immutable")
+	case s.MaxAge > 0:
+		rw.Header().Set("cache-control", "public, max-age="+strconv.Itoa(int(s.MaxAge.Seconds())))
+	default:
+		rw.Header().Set("cache-control", "no-cache")
+	}
+
+	http.ServeContent(rw, r, fi.Name(), fi.ModTime(), rs)
+}
+
+// open opens a file, resolving directories to their index.
+func (s *Static) open(name string) (fs.File, fs.FileInfo, error) {
+	f, err := s.FS.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if !fi.IsDir() {
+		return f, fi, nil
+	}
+	f.Close()
+	if !s.Index {
+		return nil, nil, fs.ErrNotExist
+	}
+	return s.open(path.Join(name, "index.html"))
+}
+
+// etag returns a strong etag from the file contents,
+// cached by the file's name, size, and modification time.
+func (s *Static) etag(name string, fi fs.FileInfo, rs io.ReadSeeker) (string, error) {
+	key := etagKey{name, fi.Size(), fi.ModTime()}
+	if etag, ok := s.etags.Load(key); ok {
+		return etag.(string), nil
+	}
+	h := sha256.New()
+	_, err := io.Copy(h, rs)
+	if err != nil {
+		return "", err
+	}
+	_, err = rs.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+	s.etags.Store(key, etag)
+	return etag, nil
+}
+
+func (s *Static) error(rw http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(rw, "not found", http.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(rw, "forbidden", http.StatusForbidden)
+	default:
+		http.Error(rw, "open file", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,100 @@
+package basehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestStatic(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"index.html":         {Data: []byte("<h1>home</h1>")},
+		"app.0123abcd.js":    {Data: []byte("console.log(1)")},
+		"style.css":          {Data: []byte("body{}")},
+		"sub/index.html":     {Data: []byte("<h1>sub</h1>")},
+		"noindex/readme.txt": {Data: []byte("hi")},
+	}
+
+	tcs := []struct {
+		name      string
+		static    *Static
+		path      string
+		wantCode  int
+		wantType  string
+		wantCache string
+	}{
+		{
+			name:      "index",
+			static:    &Static{FS: fsys, Index: true},
+			path:      "/",
+			wantCode:  http.StatusOK,
+			wantType:  "text/html; charset=utf-8",
+			wantCache: "no-cache",
+		}, {
+			name:     "index disabled",
+			static:   &Static{FS: fsys},
+			path:     "/sub/",
+			wantCode: http.StatusNotFound,
+		}, {
+			name:     "no index file",
+			static:   &Static{FS: fsys, Index: true},
+			path:     "/noindex/",
+			wantCode: http.StatusNotFound,
+		}, {
+			name:      "fingerprinted",
+			static:    &Static{FS: fsys},
+			path:      "/app.0123abcd.js",
+			wantCode:  http.StatusOK,
+			wantType:  "text/javascript; charset=utf-8",
+			wantCache: "public, max-age=31536000, immutable",
+		}, {
+			name:      "max age",
+			static:    &Static{FS: fsys, MaxAge: time.Hour},
+			path:      "/style.css",
+			wantCode:  http.StatusOK,
+			wantType:  "text/css; charset=utf-8",
+			wantCache: "public, max-age=3600",
+		}, {
+			name:     "missing",
+			static:   &Static{FS: fsys},
+			path:     "/nope.txt",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			tc.static.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if rec.Code != tc.wantCode {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.wantCode)
+			}
+			if tc.wantCode != http.StatusOK {
+				return
+			}
+			if got := rec.Header().Get("content-type"); got != tc.wantType {
+				t.Errorf("content-type = %q, want %q", got, tc.wantType)
+			}
+			if got := rec.Header().Get("cache-control"); got != tc.wantCache {
+				t.Errorf("cache-control = %q, want %q", got, tc.wantCache)
+			}
+
+			// revalidate
+			etag := rec.Header().Get("etag")
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			req.Header.Set("if-none-match", etag)
+			rec = httptest.NewRecorder()
+			tc.static.ServeHTTP(rec, req)
+			if rec.Code != http.StatusNotModified {
+				t.Errorf("conditional status = %d, want %d", rec.Code, http.StatusNotModified)
+			}
+		})
+	}
+}
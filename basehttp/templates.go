@@ -0,0 +1,161 @@
+package basehttp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+// TemplateData is passed to templates during rendering.
+type TemplateData struct {
+	Request   *http.Request
+	RequestID string
+	// Nonce should be set on inline script and style elements.
+	Nonce string
+	// CSRFToken should be submitted with forms in the csrf_token field.
+	CSRFToken string
+	Data      any
+}
+
+// Templates renders html templates loaded from an fs.FS.
+//
+// Each file under pages/ is parsed together with all files under
+// layouts/ and partials/, and executed by its file name.
+// A page may use a layout as:
+//
+//	{{template "layout" .}}
+//	{{define "content"}}...{{end}}
+type Templates struct {
+	// Reload reparses templates on every render, for use during development.
+	// Render errors are also shown in full.
+	Reload bool
+
+	o     *observability.O
+	fsys  fs.FS
+	funcs template.FuncMap
+	pages map[string]*template.Template
+}
+
+// NewTemplates parses templates from fsys,
+// with additional functions from funcs.
+func NewTemplates(o *observability.O, fsys fs.FS, funcs template.FuncMap) (*Templates, error) {
+	t := &Templates{
+		o:     o,
+		fsys:  fsys,
+		funcs: funcs,
+	}
+	pages, err := t.parse()
+	if err != nil {
+		return nil, err
+	}
+	t.pages = pages
+	return t, nil
+}
+
+func (t *Templates) parse() (map[string]*template.Template, error) {
+	var shared []string
+	for _, pattern := range []string{"layouts/*.html", "partials/*.html"} {
+		matches, err := fs.Glob(t.fsys, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("match %s: %w", pattern, err)
+		}
+		shared = append(shared, matches...)
+	}
+	base := template.New("").Funcs(t.funcs)
+	if len(shared) > 0 {
+		var err error
+		base, err = base.ParseFS(t.fsys, shared...)
+		if err != nil {
+			return nil, fmt.Errorf("parse shared templates: %w", err)
+		}
+	}
+
+	files, err := fs.Glob(t.fsys, "pages/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("match pages: %w", err)
+	}
+	pages := make(map[string]*template.Template, len(files))
+	for _, file := range files {
+		tpl, err := base.Clone()
+		if err != nil {
+			return nil, fmt.Errorf("clone shared templates: %w", err)
+		}
+		tpl, err = tpl.ParseFS(t.fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", file, err)
+		}
+		pages[path.Base(file)] = tpl
+	}
+	return pages, nil
+}
+
+// Render executes the named page with data, writing it with the given status code.
+// The page is rendered fully before anything is written,
+// so errors result in a clean error response.
+func (t *Templates) Render(rw http.ResponseWriter, r *http.Request, code int, name string, data any) {
+	ctx := r.Context()
+
+	pages := t.pages
+	if t.Reload {
+		var err error
+		pages, err = t.parse()
+		if err != nil {
+			t.renderErr(ctx, rw, "parse templates", err, name)
+			return
+		}
+	}
+
+	tpl, ok := pages[name]
+	if !ok {
+		t.renderErr(ctx, rw, "render template", fmt.Errorf("no page %q", name), name)
+		return
+	}
+
+	var buf bytes.Buffer
+	err := tpl.ExecuteTemplate(&buf, name, TemplateData{
+		Request:   r,
+		RequestID: RequestID(ctx),
+		Nonce:     CSPNonce(ctx),
+		CSRFToken: CSRFToken(ctx),
+		Data:      data,
+	})
+	if err != nil {
+		t.renderErr(ctx, rw, "render template", err, name)
+		return
+	}
+
+	rw.Header().Set("content-type", "text/html; charset=utf-8")
+	rw.WriteHeader(code)
+	rw.Write(buf.Bytes())
+}
+
+// renderErr logs a render error and responds with an error page.
+func (t *Templates) renderErr(ctx context.Context, rw http.ResponseWriter, msg string, err error, name string) {
+	if !t.Reload {
+		t.o.HTTPErr(ctx, msg, err, rw, http.StatusInternalServerError, slog.String("template", name))
+		return
+	}
+
+	err = t.o.Err(ctx, msg, err, slog.String("template", name))
+	rw.Header().Set("content-type", "text/html; charset=utf-8")
+	rw.WriteHeader(http.StatusInternalServerError)
+	errorPage.Execute(rw, map[string]string{
+		"Template":  name,
+		"Error":     err.Error(),
+		"RequestID": RequestID(ctx),
+	})
+}
+
+var errorPage = template.Must(template.New("error").Parse(`<!doctype html>
+<title>template error</title>
+<h1>error rendering {{.Template}}</h1>
+<pre>{{.Error}}</pre>
+{{with .RequestID}}<p>request id: {{.}}</p>{{end}}
+`))
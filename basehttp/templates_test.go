@@ -0,0 +1,78 @@
+package basehttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+func TestTemplates(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"layouts/base.html":   {Data: []byte(`{{define "layout"}}<main>{{block "content" .}}{{end}}</main>{{end}}`)},
+		"partials/greet.html": {Data: []byte(`{{define "greet"}}hello {{.}}{{end}}`)},
+		"pages/index.html":    {Data: []byte(`{{template "layout" .}}{{define "content"}}{{template "greet" .Data}} {{.RequestID}}{{end}}`)},
+		"pages/broken.html":   {Data: []byte(`{{.Data.Missing}}`)},
+	}
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+
+	tcs := []struct {
+		name     string
+		reload   bool
+		page     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "layout and partial",
+			page:     "index.html",
+			wantCode: http.StatusOK,
+			wantBody: "<main>hello world req1</main>",
+		}, {
+			name:     "missing page",
+			page:     "nope.html",
+			wantCode: http.StatusInternalServerError,
+		}, {
+			name:     "exec error",
+			page:     "broken.html",
+			wantCode: http.StatusInternalServerError,
+		}, {
+			name:     "reload error page",
+			reload:   true,
+			page:     "broken.html",
+			wantCode: http.StatusInternalServerError,
+			wantBody: "error rendering broken.html",
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tpls, err := NewTemplates(o, fsys, nil)
+			if err != nil {
+				t.Fatalf("parse templates: %v", err)
+			}
+			tpls.Reload = tc.reload
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, "req1"))
+			rec := httptest.NewRecorder()
+			tpls.Render(rec, r, http.StatusOK, tc.page, "world")
+			if rec.Code != tc.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantCode)
+			}
+			if !strings.Contains(rec.Body.String(), tc.wantBody) {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tc.wantBody)
+			}
+		})
+	}
+}
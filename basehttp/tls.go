@@ -0,0 +1,90 @@
+package basehttp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// tlsConfig returns the base server tls config,
+// or nil if tls is not enabled.
+func (c *Config) tlsConfig() *tls.Config {
+	if c.TLSCert == "" && c.TLSKey == "" {
+		return nil
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// only used for TLS 1.2, TLS 1.3 suites are not configurable
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+}
+
+// loadClientCAs configures client certificate verification on cfg.
+func (c *Config) loadClientCAs(cfg *tls.Config) error {
+	if c.TLSClientCA == "" {
+		return nil
+	}
+	b, err := os.ReadFile(c.TLSClientCA)
+	if err != nil {
+		return fmt.Errorf("read client ca bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return fmt.Errorf("no certificates found in client ca bundle %s", c.TLSClientCA)
+	}
+	cfg.ClientCAs = pool
+	switch c.TLSClientAuth {
+	case "optional":
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return nil
+}
+
+// ClientIdentity is the verified identity of a client presenting a certificate.
+type ClientIdentity struct {
+	CommonName     string
+	DNSNames       []string
+	EmailAddresses []string
+	URIs           []string
+}
+
+type clientIdentityKey struct{}
+
+// ClientIdentityFromContext returns the identity of the client
+// if it presented a verified certificate.
+func ClientIdentityFromContext(ctx context.Context) (ClientIdentity, bool) {
+	id, ok := ctx.Value(clientIdentityKey{}).(ClientIdentity)
+	return id, ok
+}
+
+// clientIdentity adds verified client certificate identities to the request context.
+func clientIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			cert := r.TLS.VerifiedChains[0][0]
+			id := ClientIdentity{
+				CommonName:     cert.Subject.CommonName,
+				DNSNames:       cert.DNSNames,
+				EmailAddresses: cert.EmailAddresses,
+			}
+			for _, u := range cert.URIs {
+				id.URIs = append(id.URIs, u.String())
+			}
+			r = r.WithContext(context.WithValue(r.Context(), clientIdentityKey{}, id))
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
@@ -0,0 +1,67 @@
+package basehttp
+
+import (
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WellKnown configures commonly requested files.
+type WellKnown struct {
+	// Robots is served as /robots.txt, allowing all crawlers if empty.
+	Robots string
+	// Favicon is served as /favicon.ico, responding with no content if empty.
+	Favicon []byte
+	// SecurityContacts are URIs (mailto:, https:) listed in /.well-known/security.txt,
+	// which is only served if there are any.
+	SecurityContacts []string
+	// SecurityExpires is when security.txt should be considered stale,
+	// defaulting to a year from registration.
+	SecurityExpires time.Time
+	// Files are served under /.well-known/.
+	Files fs.FS
+}
+
+// Register serves the well known files on mux.
+func (w *WellKnown) Register(mux *http.ServeMux) {
+	robots := w.Robots
+	if robots == "" {
+		robots = "User-agent: *\nAllow: /\n"
+	}
+	mux.HandleFunc("GET /robots.txt", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		rw.Write([]byte(robots))
+	})
+
+	mux.HandleFunc("GET /favicon.ico", func(rw http.ResponseWriter, r *http.Request) {
+		if len(w.Favicon) == 0 {
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+		rw.Header().Set("Content-Type", http.DetectContentType(w.Favicon))
+		rw.Header().Set("Cache-Control", "public, max-age=86400")
+		rw.Write(w.Favicon)
+	})
+
+	if len(w.SecurityContacts) > 0 {
+		expires := w.SecurityExpires
+		if expires.IsZero() {
+			expires = time.Now().AddDate(1, 0, 0)
+		}
+		var b strings.Builder
+		for _, contact := range w.SecurityContacts {
+			b.WriteString("Contact: " + contact + "\n")
+		}
+		b.WriteString("Expires: " + expires.UTC().Format(time.RFC3339) + "\n")
+		securityTxt := b.String()
+		mux.HandleFunc("GET /.well-known/security.txt", func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			rw.Write([]byte(securityTxt))
+		})
+	}
+
+	if w.Files != nil {
+		mux.Handle("GET /.well-known/", http.StripPrefix("/.well-known", &Static{FS: w.Files}))
+	}
+}
@@ -0,0 +1,52 @@
+package basehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestWellKnown(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	w := &WellKnown{
+		SecurityContacts: []string{"mailto:security@example.com"},
+		SecurityExpires:  time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		Files: fstest.MapFS{
+			"assetlinks.json": {Data: []byte(`[]`)},
+		},
+	}
+	w.Register(mux)
+
+	tcs := []struct {
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"/robots.txt", http.StatusOK, "User-agent: *"},
+		{"/favicon.ico", http.StatusNoContent, ""},
+		{"/.well-known/security.txt", http.StatusOK, "Contact: mailto:security@example.com\nExpires: 2030-01-01T00:00:00Z\n"},
+		{"/.well-known/assetlinks.json", http.StatusOK, "[]"},
+		{"/.well-known/missing", http.StatusNotFound, ""},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.path, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if rec.Code != tc.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantCode)
+			}
+			if !strings.Contains(rec.Body.String(), tc.wantBody) {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tc.wantBody)
+			}
+		})
+	}
+}
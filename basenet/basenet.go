@@ -0,0 +1,254 @@
+// Package basenet serves custom protocols on stream listeners,
+// such as tcp or unix sockets,
+// for services that aren't http or grpc.
+//
+// A Listener runs as a framework worker or runnable:
+//
+//	l := basenet.New(ctx, o, conf, func(ctx context.Context, conn net.Conn) error {
+//		// speak the protocol on conn
+//	})
+//	return []func(context.Context) error{l.Run}, nil, nil
+package basenet
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+type Config struct {
+	// Network is a stream network: tcp, tcp4, tcp6, or unix.
+	Network string
+	Address string
+	// MaxConns limits concurrent connections,
+	// pausing accepts while at the limit, unlimited if 0.
+	MaxConns int
+	// ShutdownTimeout is how long connections may drain on shutdown
+	// before they're closed, 0 for no limit.
+	ShutdownTimeout time.Duration
+}
+
+func (c *Config) SetFlags(fset *flag.FlagSet) {
+	fset.StringVar(&c.Network, "net.network", "tcp", "network to listen on: tcp, tcp4, tcp6, or unix")
+	fset.StringVar(&c.Address, "net.addr", "", "address to listen on, a socket path for unix")
+	fset.IntVar(&c.MaxConns, "net.max-conns", 0, "maximum concurrent connections, 0 for no limit")
+	fset.DurationVar(&c.ShutdownTimeout, "net.shutdown-timeout", 10*time.Second, "time to wait for connections to complete on shutdown before closing them")
+}
+
+// Handler serves a connection,
+// which is closed after it returns.
+// Returned errors are logged as warnings,
+// as they're often caused by clients,
+// use O.Err for server errors.
+type Handler func(ctx context.Context, conn net.Conn) error
+
+type Listener struct {
+	O *observability.O
+
+	// PreServe is called after the listener is bound,
+	// but before accepting connections.
+	// Use it to discover the actual address when listening on :0.
+	PreServe func(ctx context.Context, lis net.Listener) error
+
+	handler     Handler
+	conf        *Config
+	attrs       metric.MeasurementOption
+	connections metric.Int64UpDownCounter
+	accepted    metric.Int64Counter
+	active      atomic.Int64
+}
+
+func New(ctx context.Context, o *observability.O, c *Config, h Handler) *Listener {
+	o = o.Component("basenet")
+	l := &Listener{
+		O:       o,
+		handler: h,
+		conf:    c,
+		attrs: metric.WithAttributes(
+			attribute.String("network.transport", c.Network),
+			attribute.String("server.address", c.Address),
+		),
+	}
+	l.connections, _ = o.M.Int64UpDownCounter("net.connections",
+		metric.WithDescription("open connections"),
+	)
+	l.accepted, _ = o.M.Int64Counter("net.connections.accepted",
+		metric.WithDescription("accepted connections"),
+	)
+	return l
+}
+
+type drainingKey struct{}
+
+// Draining returns a channel that's closed when the listener starts shutting down,
+// so handlers of long lived connections can stop at a convenient point.
+// Handler contexts are only canceled when the shutdown timeout expires.
+func Draining(ctx context.Context) <-chan struct{} {
+	ch, _ := ctx.Value(drainingKey{}).(<-chan struct{})
+	return ch
+}
+
+// Run accepts connections until ctx is canceled,
+// serving each with the handler in its own goroutine.
+// On shutdown it stops accepting, waits for open connections to complete,
+// and closes any remaining after the shutdown timeout.
+func (l *Listener) Run(ctx context.Context) error {
+	l.O.L.LogAttrs(ctx, slog.LevelInfo, "starting listen",
+		slog.String("network", l.conf.Network),
+		slog.String("address", l.conf.Address),
+	)
+	lis, err := net.Listen(l.conf.Network, l.conf.Address)
+	if err != nil {
+		return l.O.Err(ctx, "listen", err, slog.String("address", l.conf.Address))
+	}
+	if l.PreServe != nil {
+		err := l.PreServe(ctx, lis)
+		if err != nil {
+			lis.Close()
+			return l.O.Err(ctx, "pre serve hook", err)
+		}
+	}
+
+	// handler contexts outlive ctx until connections have drained
+	connCtx, cancelConns := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelConns()
+	connCtx = context.WithValue(connCtx, drainingKey{}, ctx.Done())
+	stop := context.AfterFunc(ctx, func() { lis.Close() })
+	defer stop()
+
+	var wg sync.WaitGroup
+	var conns sync.Map
+	var sem chan struct{}
+	if l.conf.MaxConns > 0 {
+		sem = make(chan struct{}, l.conf.MaxConns)
+	}
+	var serveErr error
+	var backoff time.Duration
+	for {
+		if sem != nil {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		conn, err := lis.Accept()
+		if err != nil {
+			if sem != nil {
+				<-sem
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			if te, ok := err.(interface{ Temporary() bool }); ok && te.Temporary() {
+				// such as running out of file descriptors
+				backoff = min(max(2*backoff, 5*time.Millisecond), time.Second)
+				l.O.L.LogAttrs(ctx, slog.LevelWarn, "accept connection, retrying",
+					slog.String("error", err.Error()),
+					slog.Duration("backoff", backoff),
+				)
+				time.Sleep(backoff)
+				continue
+			}
+			serveErr = l.O.Err(ctx, "accept connection", err)
+			break
+		}
+		backoff = 0
+		conns.Store(conn, struct{}{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.serve(connCtx, conn)
+			conns.Delete(conn)
+			if sem != nil {
+				<-sem
+			}
+		}()
+	}
+	lis.Close()
+
+	l.O.L.LogAttrs(ctx, slog.LevelInfo, "draining connections",
+		slog.Int64("connections", l.active.Load()),
+		slog.Duration("timeout", l.conf.ShutdownTimeout),
+	)
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	var timeout <-chan time.Time
+	if l.conf.ShutdownTimeout > 0 {
+		timer := time.NewTimer(l.conf.ShutdownTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-done:
+	case <-timeout:
+		remaining := l.active.Load()
+		cancelConns()
+		conns.Range(func(c, _ any) bool {
+			c.(net.Conn).Close()
+			return true
+		})
+		l.O.L.LogAttrs(ctx, slog.LevelWarn, "shutdown timed out, force closed connections",
+			slog.Int64("connections", remaining),
+		)
+		<-done
+	}
+	return serveErr
+}
+
+// serve runs the handler for conn, closing it after.
+func (l *Listener) serve(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	l.active.Add(1)
+	defer l.active.Add(-1)
+	l.accepted.Add(ctx, 1, l.attrs)
+	l.connections.Add(ctx, 1, l.attrs)
+	defer l.connections.Add(ctx, -1, l.attrs)
+
+	ctx, span := l.O.T.Start(ctx, "serve connection",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("network.transport", l.conf.Network),
+			attribute.String("network.peer.address", conn.RemoteAddr().String()),
+			attribute.String("server.address", l.conf.Address),
+		),
+	)
+	defer span.End()
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		l.O.Err(ctx, "recovered panic serving connection", fmt.Errorf("panic: %v", v),
+			slog.String("stack", string(debug.Stack())),
+		)
+	}()
+
+	err := l.handler(ctx, conn)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		l.O.L.LogAttrs(ctx, slog.LevelWarn, "serve connection",
+			slog.String("error", err.Error()),
+			slog.String("remote", conn.RemoteAddr().String()),
+		)
+	}
+}
@@ -0,0 +1,162 @@
+package basenet
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+// start runs l until the returned cancel is called,
+// returning the listening address.
+func start(t *testing.T, l *Listener) (string, context.CancelFunc, <-chan error) {
+	t.Helper()
+	addr := make(chan string, 1)
+	l.PreServe = func(ctx context.Context, lis net.Listener) error {
+		addr <- lis.Addr().String()
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	done := make(chan error, 1)
+	go func() { done <- l.Run(ctx) }()
+	return <-addr, cancel, done
+}
+
+func TestListener(t *testing.T) {
+	t.Parallel()
+
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+	l := New(context.Background(), o, &Config{Network: "tcp", Address: "127.0.0.1:0", ShutdownTimeout: 10 * time.Second},
+		func(ctx context.Context, conn net.Conn) error {
+			// echo lines until the client is done or the listener drains
+			sc := bufio.NewScanner(conn)
+			for sc.Scan() {
+				io.WriteString(conn, sc.Text()+"\n")
+				select {
+				case <-Draining(ctx):
+					if ctx.Err() != nil {
+						t.Errorf("handler context canceled while draining: %v", ctx.Err())
+					}
+					return nil
+				default:
+				}
+			}
+			return sc.Err()
+		},
+	)
+	addr, cancel, done := start(t, l)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	io.WriteString(conn, "hello\n")
+	line, err := r.ReadString('\n')
+	if err != nil || line != "hello\n" {
+		t.Fatalf("echo = %q, %v", line, err)
+	}
+
+	// the open connection finishes its current exchange after shutdown starts
+	cancel()
+	for {
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		c.Close()
+		time.Sleep(time.Millisecond)
+	}
+	io.WriteString(conn, "bye\n")
+	line, err = r.ReadString('\n')
+	if err != nil || line != "bye\n" {
+		t.Errorf("echo while draining = %q, %v", line, err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("run: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("run didn't return after connections drained")
+	}
+}
+
+func TestListenerShutdownTimeout(t *testing.T) {
+	t.Parallel()
+
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+	l := New(context.Background(), o, &Config{Network: "tcp", Address: "127.0.0.1:0", ShutdownTimeout: 10 * time.Millisecond},
+		func(ctx context.Context, conn net.Conn) error {
+			// ignore draining
+			_, err := io.Copy(io.Discard, conn)
+			return err
+		},
+	)
+	addr, cancel, done := start(t, l)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for l.active.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("run: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("connections not closed after shutdown timeout")
+	}
+	if n := l.active.Load(); n != 0 {
+		t.Errorf("active connections = %d after shutdown", n)
+	}
+}
+
+func TestListenerMaxConns(t *testing.T) {
+	t.Parallel()
+
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+	release := make(chan struct{})
+	l := New(context.Background(), o, &Config{Network: "tcp", Address: "127.0.0.1:0", MaxConns: 1},
+		func(ctx context.Context, conn net.Conn) error {
+			io.WriteString(conn, "hi\n")
+			<-release
+			return nil
+		},
+	)
+	addr, _, _ := start(t, l)
+	defer close(release)
+
+	first, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	bufio.NewReader(first).ReadString('\n')
+
+	// queued in the backlog, but not served while at the limit
+	second, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err = bufio.NewReader(second).ReadString('\n')
+	if err == nil {
+		t.Errorf("second connection served over the limit")
+	}
+	if n := l.active.Load(); n != 1 {
+		t.Errorf("active connections = %d, want 1", n)
+	}
+}
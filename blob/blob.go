@@ -0,0 +1,292 @@
+// Package blob reads and writes objects in a bucket,
+// on the local filesystem, Google Cloud Storage, or S3,
+// selected by a url.
+package blob
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+// ErrNotFound is returned when reading a key that doesn't exist.
+var ErrNotFound = errors.New("blob not found")
+
+type Config struct {
+	// URL selects the bucket:
+	//
+	//	file:///path/to/dir
+	//	gs://bucket?access-id=signer@project.iam.gserviceaccount.com
+	//	s3://bucket?region=us-east-1&endpoint=https://minio.example
+	//
+	// access-id is the service account that signs gcs urls.
+	// endpoint is for s3 compatible stores, using path style requests.
+	URL string
+	// SignedURLExpiry is the default validity of signed urls.
+	SignedURLExpiry time.Duration
+}
+
+func (c *Config) SetFlags(fset *flag.FlagSet) {
+	fset.StringVar(&c.URL, "blob.url", "", "bucket url: file:///path, gs://bucket, or s3://bucket?region=...")
+	fset.DurationVar(&c.SignedURLExpiry, "blob.signed-url-expiry", 15*time.Minute, "default validity of signed urls")
+}
+
+// Writer streams an object to a bucket.
+// Close commits the object,
+// CloseWithError abandons the write,
+// leaving any previous object at the key in place.
+type Writer interface {
+	io.WriteCloser
+	CloseWithError(err error) error
+}
+
+// driver implements storage for a url scheme.
+// Deleting a missing key isn't an error.
+type driver interface {
+	read(ctx context.Context, key string) (io.ReadCloser, error)
+	write(ctx context.Context, key, contentType string) (Writer, error)
+	delete(ctx context.Context, key string) error
+	signedURL(ctx context.Context, key, method string, expiry time.Duration) (string, error)
+}
+
+type Bucket struct {
+	O *observability.O
+
+	driver driver
+	attrs  []attribute.KeyValue
+	conf   *Config
+}
+
+func New(ctx context.Context, o *observability.O, c *Config) (*Bucket, error) {
+	o = o.Component("blob")
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, o.Err(ctx, "parse bucket url", err)
+	}
+	var d driver
+	switch u.Scheme {
+	case "file":
+		d, err = newFileDriver(u)
+	case "gs":
+		d, err = newGCSDriver(ctx, u)
+	case "s3":
+		d, err = newS3Driver(ctx, u)
+	default:
+		err = fmt.Errorf("unsupported scheme: %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, o.Err(ctx, "open bucket", err, slog.String("url", c.URL))
+	}
+
+	return &Bucket{
+		O:      o,
+		driver: d,
+		attrs: []attribute.KeyValue{
+			attribute.String("blob.scheme", u.Scheme),
+			attribute.String("blob.bucket", u.Host+u.Path),
+		},
+		conf: c,
+	}, nil
+}
+
+// span starts a span for an operation on key.
+func (b *Bucket) span(ctx context.Context, op, key string) (context.Context, trace.Span) {
+	return b.O.T.Start(ctx, "blob."+op, trace.WithAttributes(
+		append(b.attrs, attribute.String("blob.key", key))...,
+	))
+}
+
+// endSpan records err, if any, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func validKey(key string) error {
+	if !fs.ValidPath(key) || key == "." {
+		return fmt.Errorf("invalid key: %q", key)
+	}
+	return nil
+}
+
+// escapeKey escapes each segment of a key for use in a url path.
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// NewReader opens key for streaming reads.
+// The read span ends when the reader is closed.
+func (b *Bucket) NewReader(ctx context.Context, key string) (io.ReadCloser, error) {
+	ctx, span := b.span(ctx, "read", key)
+	err := validKey(key)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	r, err := b.driver.read(ctx, key)
+	if err != nil {
+		endSpan(span, err)
+		return nil, fmt.Errorf("read %s: %w", key, err)
+	}
+	return &spanReader{r: r, span: span}, nil
+}
+
+// NewWriter opens key for streaming writes,
+// the object is only complete once Close returns without error.
+// Use CloseWithError to abandon a failed write.
+// The write span ends when the writer is closed.
+func (b *Bucket) NewWriter(ctx context.Context, key, contentType string) (Writer, error) {
+	ctx, span := b.span(ctx, "write", key)
+	err := validKey(key)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	w, err := b.driver.write(ctx, key, contentType)
+	if err != nil {
+		endSpan(span, err)
+		return nil, fmt.Errorf("write %s: %w", key, err)
+	}
+	return &spanWriter{w: w, span: span}, nil
+}
+
+// ReadAll reads the entire object at key.
+func (b *Bucket) ReadAll(ctx context.Context, key string) ([]byte, error) {
+	r, err := b.NewReader(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// WriteAll writes data as the object at key.
+func (b *Bucket) WriteAll(ctx context.Context, key, contentType string, data []byte) error {
+	w, err := b.NewWriter(ctx, key, contentType)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	if err != nil {
+		w.CloseWithError(err)
+		return err
+	}
+	return w.Close()
+}
+
+// Delete removes key, missing keys aren't an error.
+func (b *Bucket) Delete(ctx context.Context, key string) (err error) {
+	ctx, span := b.span(ctx, "delete", key)
+	defer func() { endSpan(span, err) }()
+	err = validKey(key)
+	if err != nil {
+		return err
+	}
+	err = b.driver.delete(ctx, key)
+	if err != nil {
+		return fmt.Errorf("delete %s: %w", key, err)
+	}
+	return nil
+}
+
+// SignedURL returns a url that allows clients to use method
+// (http.MethodGet or http.MethodPut) on key without credentials,
+// valid for expiry, or the configured default if 0.
+// file buckets don't support signed urls.
+func (b *Bucket) SignedURL(ctx context.Context, key, method string, expiry time.Duration) (u string, err error) {
+	ctx, span := b.span(ctx, "sign", key)
+	defer func() { endSpan(span, err) }()
+	err = validKey(key)
+	if err != nil {
+		return "", err
+	}
+	switch method {
+	case http.MethodGet, http.MethodPut:
+	default:
+		return "", fmt.Errorf("unsupported method for signed url: %q", method)
+	}
+	if expiry <= 0 {
+		expiry = b.conf.SignedURLExpiry
+	}
+	u, err = b.driver.signedURL(ctx, key, method, expiry)
+	if err != nil {
+		return "", fmt.Errorf("sign url for %s: %w", key, err)
+	}
+	return u, nil
+}
+
+// spanReader ends its span on close.
+type spanReader struct {
+	r    io.ReadCloser
+	span trace.Span
+	n    int64
+	err  error
+}
+
+func (r *spanReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *spanReader) Close() error {
+	err := r.r.Close()
+	r.span.SetAttributes(attribute.Int64("blob.bytes", r.n))
+	endSpan(r.span, errors.Join(r.err, err))
+	return err
+}
+
+// spanWriter ends its span on close.
+type spanWriter struct {
+	w    Writer
+	span trace.Span
+	n    int64
+	err  error
+}
+
+func (w *spanWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+func (w *spanWriter) Close() error {
+	err := w.w.Close()
+	w.span.SetAttributes(attribute.Int64("blob.bytes", w.n))
+	endSpan(w.span, errors.Join(w.err, err))
+	return err
+}
+
+func (w *spanWriter) CloseWithError(err error) error {
+	cerr := w.w.CloseWithError(err)
+	w.span.SetAttributes(attribute.Int64("blob.bytes", w.n))
+	endSpan(w.span, errors.Join(err, cerr))
+	return cerr
+}
@@ -0,0 +1,111 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+func TestFileBucket(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+	b, err := New(ctx, o, &Config{URL: "file://" + t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.WriteAll(ctx, "a/b.txt", "text/plain", []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.ReadAll(ctx, "a/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello" {
+		t.Errorf("read = %q, want hello", got)
+	}
+
+	err = b.Delete(ctx, "a/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.ReadAll(ctx, "a/b.txt")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("read deleted = %v, want %v", err, ErrNotFound)
+	}
+	err = b.Delete(ctx, "a/b.txt")
+	if err != nil {
+		t.Errorf("delete missing = %v, want nil", err)
+	}
+
+	for _, key := range []string{"", ".", "../escape", "/abs", "a//b"} {
+		_, err := b.NewReader(ctx, key)
+		if err == nil {
+			t.Errorf("read %q: expected invalid key error", key)
+		}
+	}
+
+	_, err = b.SignedURL(ctx, "a/b.txt", http.MethodGet, 0)
+	if !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("signed url = %v, want %v", err, errors.ErrUnsupported)
+	}
+}
+
+func TestNewUnsupported(t *testing.T) {
+	t.Parallel()
+
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+	_, err := New(context.Background(), o, &Config{URL: "ftp://bucket"})
+	if err == nil {
+		t.Errorf("expected error for unsupported scheme")
+	}
+}
+
+func TestFileBucketAbort(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+	dir := t.TempDir()
+	b, err := New(ctx, o, &Config{URL: "file://" + dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.WriteAll(ctx, "a.txt", "text/plain", []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := b.NewWriter(ctx, "a.txt", "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "partial")
+	err = w.CloseWithError(errors.New("source failed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := b.ReadAll(ctx, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello" {
+		t.Errorf("read = %q, want previous object hello", got)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("files = %v, want only a.txt", entries)
+	}
+}
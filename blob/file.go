@@ -0,0 +1,97 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fileDriver stores objects as files under a directory.
+type fileDriver struct {
+	root string
+}
+
+func newFileDriver(u *url.URL) (*fileDriver, error) {
+	root := filepath.FromSlash(u.Path)
+	if root == "" {
+		return nil, errors.New("file url needs a path")
+	}
+	err := os.MkdirAll(root, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &fileDriver{root: root}, nil
+}
+
+func (d *fileDriver) path(key string) string {
+	return filepath.Join(d.root, filepath.FromSlash(key))
+}
+
+func (d *fileDriver) read(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(d.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (d *fileDriver) write(ctx context.Context, key, contentType string) (Writer, error) {
+	p := d.path(key)
+	err := os.MkdirAll(filepath.Dir(p), 0o755)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-"+filepath.Base(p)+"-*")
+	if err != nil {
+		return nil, err
+	}
+	return &fileWriter{f: f, path: p}, nil
+}
+
+// fileWriter writes to a temporary file,
+// renamed into place on close so readers never see partial objects,
+// or removed if the write is abandoned.
+type fileWriter struct {
+	f    *os.File
+	path string
+}
+
+func (w *fileWriter) Write(p []byte) (int, error) {
+	return w.f.Write(p)
+}
+
+func (w *fileWriter) Close() error {
+	err := w.f.Close()
+	if err != nil {
+		os.Remove(w.f.Name())
+		return err
+	}
+	err = os.Rename(w.f.Name(), w.path)
+	if err != nil {
+		os.Remove(w.f.Name())
+		return err
+	}
+	return nil
+}
+
+func (w *fileWriter) CloseWithError(err error) error {
+	return errors.Join(w.f.Close(), os.Remove(w.f.Name()))
+}
+
+func (d *fileDriver) delete(ctx context.Context, key string) error {
+	err := os.Remove(d.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (d *fileDriver) signedURL(ctx context.Context, key, method string, expiry time.Duration) (string, error) {
+	return "", fmt.Errorf("file buckets: %w", errors.ErrUnsupported)
+}
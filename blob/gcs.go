@@ -0,0 +1,167 @@
+package blob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iamcredentials/v1"
+	"google.golang.org/api/storage/v1"
+)
+
+// gcsDriver stores objects in Google Cloud Storage,
+// signing urls through the IAM credentials api.
+type gcsDriver struct {
+	bucket   string
+	accessID string
+	storage  *storage.Service
+	iam      *iamcredentials.Service
+}
+
+func newGCSDriver(ctx context.Context, u *url.URL) (*gcsDriver, error) {
+	if u.Host == "" {
+		return nil, errors.New("gs url needs a bucket")
+	}
+	svc, err := storage.NewService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create storage client: %w", err)
+	}
+	d := &gcsDriver{
+		bucket:   u.Host,
+		accessID: u.Query().Get("access-id"),
+		storage:  svc,
+	}
+	if d.accessID != "" {
+		d.iam, err = iamcredentials.NewService(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("create iam credentials client: %w", err)
+		}
+	}
+	return d, nil
+}
+
+func isNotFound(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusNotFound
+}
+
+func (d *gcsDriver) read(ctx context.Context, key string) (io.ReadCloser, error) {
+	res, err := d.storage.Objects.Get(d.bucket, key).Context(ctx).Download()
+	if isNotFound(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (d *gcsDriver) write(ctx context.Context, key, contentType string) (Writer, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	pr, pw := io.Pipe()
+	w := &pipeWriter{pw: pw, cancel: cancel, done: make(chan struct{})}
+	obj := &storage.Object{Name: key, ContentType: contentType}
+	go func() {
+		defer close(w.done)
+		defer cancel(nil)
+		_, w.err = d.storage.Objects.Insert(d.bucket, obj).
+			Media(pr, googleapi.ContentType(contentType)).
+			Context(ctx).
+			Do()
+		pr.CloseWithError(w.err)
+	}()
+	return w, nil
+}
+
+// pipeWriter streams writes to an upload running in the background,
+// returning its result on close.
+// Abandoned writes cancel the upload so it isn't committed.
+type pipeWriter struct {
+	pw     *io.PipeWriter
+	cancel context.CancelCauseFunc
+	done   chan struct{}
+	err    error
+}
+
+func (w *pipeWriter) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+func (w *pipeWriter) Close() error {
+	w.pw.Close()
+	<-w.done
+	return w.err
+}
+
+func (w *pipeWriter) CloseWithError(err error) error {
+	w.cancel(err)
+	w.pw.CloseWithError(err)
+	<-w.done
+	return nil
+}
+
+func (d *gcsDriver) delete(ctx context.Context, key string) error {
+	err := d.storage.Objects.Delete(d.bucket, key).Context(ctx).Do()
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// signedURL creates a V4 signed url,
+// see https://cloud.google.com/storage/docs/access-control/signing-urls-manually
+func (d *gcsDriver) signedURL(ctx context.Context, key, method string, expiry time.Duration) (string, error) {
+	if d.iam == nil {
+		return "", errors.New("gs url needs an access-id to sign urls")
+	}
+	const host = "storage.googleapis.com"
+	now := time.Now().UTC()
+	datetime := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/auto/storage/goog4_request"
+	path := "/" + d.bucket + "/" + escapeKey(key)
+
+	q := url.Values{}
+	q.Set("X-Goog-Algorithm", "GOOG4-RSA-SHA256")
+	q.Set("X-Goog-Credential", d.accessID+"/"+scope)
+	q.Set("X-Goog-Date", datetime)
+	q.Set("X-Goog-Expires", fmt.Sprint(int(expiry.Seconds())))
+	q.Set("X-Goog-SignedHeaders", "host")
+	query := strings.ReplaceAll(q.Encode(), "+", "%20")
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		path,
+		query,
+		"host:" + host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"GOOG4-RSA-SHA256",
+		datetime,
+		scope,
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	res, err := d.iam.Projects.ServiceAccounts.SignBlob(
+		"projects/-/serviceAccounts/"+d.accessID,
+		&iamcredentials.SignBlobRequest{Payload: base64.StdEncoding.EncodeToString([]byte(stringToSign))},
+	).Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("sign blob: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(res.SignedBlob)
+	if err != nil {
+		return "", fmt.Errorf("decode signature: %w", err)
+	}
+	return "https://" + host + path + "?" + query + "&X-Goog-Signature=" + hex.EncodeToString(sig), nil
+}
@@ -0,0 +1,359 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// emptyHash is the sha256 of an empty payload.
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3PartSize is the size of multipart upload parts,
+// s3 requires at least 5MiB for all but the last part.
+const s3PartSize = 8 << 20
+
+// s3Driver stores objects in S3 or compatible stores
+// through the rest api, with requests signed by SigV4.
+type s3Driver struct {
+	bucket string
+	region string
+	// endpoint is the base url for objects, ending in /.
+	endpoint string
+	// partSize is the amount of data buffered for each upload part.
+	partSize int
+	creds    aws.CredentialsProvider
+	signer   *v4.Signer
+	client   *http.Client
+}
+
+func newS3Driver(ctx context.Context, u *url.URL) (*s3Driver, error) {
+	if u.Host == "" {
+		return nil, errors.New("s3 url needs a bucket")
+	}
+	q := u.Query()
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(q.Get("region")))
+	if err != nil {
+		return nil, fmt.Errorf("load aws config: %w", err)
+	}
+	if cfg.Region == "" {
+		return nil, errors.New("s3 url needs a region")
+	}
+	return newS3(u.Host, cfg.Region, q.Get("endpoint"), cfg.Credentials), nil
+}
+
+func newS3(bucket, region, endpoint string, creds aws.CredentialsProvider) *s3Driver {
+	if endpoint == "" {
+		endpoint = "https://" + bucket + ".s3." + region + ".amazonaws.com/"
+	} else {
+		// path style for s3 compatible stores
+		endpoint = strings.TrimSuffix(endpoint, "/") + "/" + bucket + "/"
+	}
+	return &s3Driver{
+		bucket:   bucket,
+		region:   region,
+		endpoint: endpoint,
+		partSize: s3PartSize,
+		creds:    creds,
+		signer:   v4.NewSigner(),
+		client:   &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)},
+	}
+}
+
+// do signs and sends a request for key.
+func (d *s3Driver) do(ctx context.Context, method, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	u := d.endpoint + escapeKey(key)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	payloadHash := emptyHash
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	creds, err := d.creds.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("retrieve credentials: %w", err)
+	}
+	err = d.signer.SignHTTP(ctx, creds, req, payloadHash, "s3", d.region, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("sign request: %w", err)
+	}
+	return d.client.Do(req)
+}
+
+// checkStatus returns an error for unsuccessful responses,
+// closing their body.
+func checkStatus(res *http.Response) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("unexpected status %s: %s", res.Status, msg)
+}
+
+func (d *s3Driver) read(ctx context.Context, key string) (io.ReadCloser, error) {
+	res, err := d.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = checkStatus(res)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// write buffers up to a part of the object in memory,
+// as s3 needs the length and hash of each request body before it starts.
+// Objects larger than a part are streamed as a multipart upload.
+func (d *s3Driver) write(ctx context.Context, key, contentType string) (Writer, error) {
+	return &s3Writer{ctx: ctx, d: d, key: key, contentType: contentType}, nil
+}
+
+type s3Writer struct {
+	ctx         context.Context
+	d           *s3Driver
+	key         string
+	contentType string
+	buf         []byte
+
+	// uploadID is set once the first part is uploaded.
+	uploadID string
+	parts    []s3Part
+	err      error
+}
+
+type s3Part struct {
+	PartNumber int
+	ETag       string
+}
+
+func (w *s3Writer) header() http.Header {
+	header := http.Header{}
+	if w.contentType != "" {
+		header.Set("Content-Type", w.contentType)
+	}
+	return header
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		c := min(len(p), w.d.partSize-len(w.buf))
+		w.buf = append(w.buf, p[:c]...)
+		p = p[c:]
+		if len(w.buf) == w.d.partSize {
+			w.err = w.uploadPart()
+			if w.err != nil {
+				w.abort()
+				return n - len(p), w.err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (w *s3Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.uploadID == "" {
+		// small objects fit in a single request
+		res, err := w.d.do(w.ctx, http.MethodPut, w.key, nil, w.buf, w.header())
+		if err != nil {
+			return err
+		}
+		err = checkStatus(res)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		return nil
+	}
+
+	err := w.complete()
+	if err != nil {
+		w.abort()
+		return err
+	}
+	return nil
+}
+
+func (w *s3Writer) CloseWithError(err error) error {
+	w.buf = nil
+	if w.err == nil {
+		w.err = err
+		return w.abort()
+	}
+	return nil
+}
+
+// uploadPart uploads the buffered data as the next part,
+// starting a multipart upload if needed.
+func (w *s3Writer) uploadPart() error {
+	if w.uploadID == "" {
+		res, err := w.d.do(w.ctx, http.MethodPost, w.key, url.Values{"uploads": {""}}, nil, w.header())
+		if err != nil {
+			return err
+		}
+		err = checkStatus(res)
+		if err != nil {
+			return fmt.Errorf("create multipart upload: %w", err)
+		}
+		defer res.Body.Close()
+		var result struct {
+			UploadID string `xml:"UploadId"`
+		}
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		if err != nil {
+			return fmt.Errorf("decode multipart upload: %w", err)
+		}
+		w.uploadID = result.UploadID
+	}
+
+	part := len(w.parts) + 1
+	res, err := w.d.do(w.ctx, http.MethodPut, w.key, url.Values{
+		"partNumber": {strconv.Itoa(part)},
+		"uploadId":   {w.uploadID},
+	}, w.buf, nil)
+	if err != nil {
+		return err
+	}
+	err = checkStatus(res)
+	if err != nil {
+		return fmt.Errorf("upload part %d: %w", part, err)
+	}
+	res.Body.Close()
+	w.parts = append(w.parts, s3Part{PartNumber: part, ETag: res.Header.Get("ETag")})
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// complete uploads any remaining data and commits the multipart upload.
+func (w *s3Writer) complete() error {
+	if len(w.buf) > 0 {
+		err := w.uploadPart()
+		if err != nil {
+			return err
+		}
+	}
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: w.parts})
+	if err != nil {
+		return err
+	}
+	res, err := w.d.do(w.ctx, http.MethodPost, w.key, url.Values{"uploadId": {w.uploadID}}, body, nil)
+	if err != nil {
+		return err
+	}
+	err = checkStatus(res)
+	if err != nil {
+		return fmt.Errorf("complete multipart upload: %w", err)
+	}
+	defer res.Body.Close()
+	// errors may be reported after a 200 status
+	var result struct {
+		XMLName xml.Name
+		Code    string
+		Message string
+	}
+	err = xml.NewDecoder(res.Body).Decode(&result)
+	if err != nil {
+		return fmt.Errorf("decode complete multipart upload: %w", err)
+	}
+	if result.XMLName.Local == "Error" {
+		return fmt.Errorf("complete multipart upload: %s: %s", result.Code, result.Message)
+	}
+	return nil
+}
+
+// abort discards any uploaded parts.
+func (w *s3Writer) abort() error {
+	if w.uploadID == "" {
+		return nil
+	}
+	// use a fresh context as the write may have failed from cancellation
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(w.ctx), 30*time.Second)
+	defer cancel()
+	res, err := w.d.do(ctx, http.MethodDelete, w.key, url.Values{"uploadId": {w.uploadID}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	err = checkStatus(res)
+	if err != nil {
+		return fmt.Errorf("abort multipart upload: %w", err)
+	}
+	res.Body.Close()
+	return nil
+}
+
+func (d *s3Driver) delete(ctx context.Context, key string) error {
+	res, err := d.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	err = checkStatus(res)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+func (d *s3Driver) signedURL(ctx context.Context, key, method string, expiry time.Duration) (string, error) {
+	u, err := url.Parse(d.endpoint + escapeKey(key))
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("X-Amz-Expires", fmt.Sprint(int(expiry.Seconds())))
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	creds, err := d.creds.Retrieve(ctx)
+	if err != nil {
+		return "", fmt.Errorf("retrieve credentials: %w", err)
+	}
+	signed, _, err := d.signer.PresignHTTP(ctx, creds, req, "UNSIGNED-PAYLOAD", "s3", d.region, time.Now())
+	if err != nil {
+		return "", err
+	}
+	return signed, nil
+}
@@ -0,0 +1,189 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// fakeS3 stores objects put with signed requests,
+// directly or as multipart uploads.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]string
+	uploads map[string][]string
+}
+
+func (f *fakeS3) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+		http.Error(rw, "unsigned", http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	q := r.URL.Query()
+	uploadID := q.Get("uploadId")
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		uploadID = strconv.Itoa(len(f.uploads))
+		f.uploads[uploadID] = nil
+		fmt.Fprintf(rw, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", uploadID)
+		return
+	case uploadID != "":
+		parts, ok := f.uploads[uploadID]
+		if !ok {
+			http.NotFound(rw, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			b, _ := io.ReadAll(r.Body)
+			rw.Header().Set("ETag", fmt.Sprintf(`"%d"`, len(parts)))
+			f.uploads[uploadID] = append(parts, string(b))
+		case http.MethodPost:
+			f.objects[r.URL.Path] = strings.Join(parts, "")
+			delete(f.uploads, uploadID)
+			io.WriteString(rw, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+		case http.MethodDelete:
+			delete(f.uploads, uploadID)
+			rw.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		b, _ := io.ReadAll(r.Body)
+		f.objects[r.URL.Path] = string(b)
+	case http.MethodGet:
+		v, ok := f.objects[r.URL.Path]
+		if !ok {
+			http.NotFound(rw, r)
+			return
+		}
+		io.WriteString(rw, v)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	fake := &fakeS3{objects: make(map[string]string), uploads: make(map[string][]string)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	creds := aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+	})
+	d := newS3("bucket", "us-east-1", srv.URL, creds)
+
+	w, err := d.write(ctx, "dir/a b.txt", "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "hello")
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.objects["/bucket/dir/a b.txt"]; got != "hello" {
+		t.Errorf("stored = %q, want hello", got)
+	}
+
+	r, err := d.read(ctx, "dir/a b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(r)
+	r.Close()
+	if string(b) != "hello" {
+		t.Errorf("read = %q, want hello", b)
+	}
+
+	err = d.delete(ctx, "dir/a b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.read(ctx, "dir/a b.txt")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("read deleted = %v, want %v", err, ErrNotFound)
+	}
+
+	signed, err := d.signedURL(ctx, "dir/a b.txt", http.MethodGet, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("X-Amz-Expires") != "60" || q.Get("X-Amz-Signature") == "" {
+		t.Errorf("signed url missing expiry or signature: %s", signed)
+	}
+	if !strings.HasPrefix(signed, srv.URL+"/bucket/dir/a%20b.txt?") {
+		t.Errorf("signed url = %s", signed)
+	}
+}
+
+func TestS3Multipart(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	fake := &fakeS3{objects: make(map[string]string), uploads: make(map[string][]string)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	creds := aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+	})
+	d := newS3("bucket", "us-east-1", srv.URL, creds)
+	d.partSize = 4
+
+	w, err := d.write(ctx, "big", "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "hello ")
+	io.WriteString(w, "world")
+	if len(fake.uploads["0"]) != 2 {
+		t.Errorf("uploaded parts = %q, want 2 parts before close", fake.uploads["0"])
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.objects["/bucket/big"]; got != "hello world" {
+		t.Errorf("stored = %q, want hello world", got)
+	}
+
+	w, err = d.write(ctx, "aborted", "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "partial data")
+	err = w.CloseWithError(errors.New("source failed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.objects["/bucket/aborted"]; ok {
+		t.Errorf("aborted upload was stored")
+	}
+	if len(fake.uploads) != 0 {
+		t.Errorf("pending uploads = %v, want none", fake.uploads)
+	}
+}
@@ -0,0 +1,265 @@
+// Package cron runs jobs on cron schedules,
+// optionally locking each run so only one replica runs it.
+package cron
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+// CatchUp is the policy for runs missed while the process was down,
+// or while a previous run was still running.
+type CatchUp int
+
+const (
+	// SkipMissed waits for the next scheduled time.
+	SkipMissed CatchUp = iota
+	// RunMissedOnce runs once immediately for all missed runs.
+	// Runs missed while the process was down are only known with a Locker
+	// that implements LastRunner.
+	RunMissedOnce
+)
+
+// Job is a function run on a schedule.
+type Job struct {
+	Name string
+	// Schedule is a cron spec, see Scheduler.Add.
+	Schedule string
+	// Timeout limits each run, 0 for no limit.
+	Timeout time.Duration
+	CatchUp CatchUp
+	Run     func(ctx context.Context, o *observability.O) error
+}
+
+// Locker coordinates replicas so each scheduled run happens once.
+type Locker interface {
+	// TryLock claims the run of job scheduled at t,
+	// returning false if another replica already claimed it.
+	TryLock(ctx context.Context, job string, t time.Time) (bool, error)
+}
+
+// LastRunner is optionally implemented by a Locker
+// to catch up on runs missed while no replica was running.
+type LastRunner interface {
+	// LastRun returns the scheduled time of the last claimed run of job,
+	// or the zero time if there is none.
+	LastRun(ctx context.Context, job string) (time.Time, error)
+}
+
+type Config struct {
+	// Location is the time zone schedules are interpreted in.
+	Location string
+}
+
+func (c *Config) SetFlags(fset *flag.FlagSet) {
+	fset.StringVar(&c.Location, "cron.timezone", "UTC", "time zone for cron schedules")
+}
+
+type Scheduler struct {
+	O *observability.O
+	// Locker, if set, ensures only one replica runs each scheduled run.
+	Locker Locker
+
+	loc      *time.Location
+	now      func() time.Time
+	runs     metric.Int64Counter
+	duration metric.Float64Histogram
+
+	mu   sync.Mutex
+	jobs []*job
+}
+
+type job struct {
+	Job
+	schedule schedule
+}
+
+func New(ctx context.Context, o *observability.O, c *Config) (*Scheduler, error) {
+	o = o.Component("cron")
+
+	loc, err := time.LoadLocation(c.Location)
+	if err != nil {
+		return nil, o.Err(ctx, "load cron time zone", err, slog.String("location", c.Location))
+	}
+	s := &Scheduler{
+		O:   o,
+		loc: loc,
+		now: time.Now,
+	}
+	s.runs, _ = o.M.Int64Counter("cron.runs",
+		metric.WithDescription("job runs, by job and result: success|error|skipped"),
+	)
+	s.duration, _ = o.M.Float64Histogram("cron.run.duration",
+		metric.WithDescription("time spent running jobs"),
+		metric.WithUnit("s"),
+	)
+	return s, nil
+}
+
+// Add adds a job to be run by Run.
+// Schedule is a standard 5 field cron spec:
+// minute, hour, day of month, month, and day of week,
+// each * or a comma separated list of values, ranges a-b, and steps */n or a-b/n,
+// or one of @yearly, @monthly, @weekly, @daily, @hourly, or @every <duration>.
+// @every runs at multiples of the duration since the zero time,
+// so intervals dividing a day start at midnight UTC.
+func (s *Scheduler) Add(j Job) error {
+	if j.Name == "" || j.Run == nil {
+		return errors.New("job needs a name and run function")
+	}
+	sched, err := parse(j.Schedule)
+	if err != nil {
+		return fmt.Errorf("job %s: parse schedule: %w", j.Name, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, &job{Job: j, schedule: sched})
+	return nil
+}
+
+// Run runs the jobs on their schedules until ctx is canceled,
+// for use as a framework worker.
+// Runs of a job don't overlap.
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.mu.Lock()
+	jobs := s.jobs
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(ctx, j)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// loop runs a job on its schedule until ctx is canceled.
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	last := s.lastRun(ctx, j)
+	for {
+		next := j.schedule.next(last)
+		if next.IsZero() {
+			s.O.L.LogAttrs(ctx, slog.LevelWarn, "job has no future runs", slog.String("job", j.Name))
+			return
+		}
+
+		now := s.now().In(s.loc)
+		if next.Before(now) {
+			// missed runs, find the most recent
+			missed := next
+			for n := j.schedule.next(missed); !n.IsZero() && !n.After(now); n = j.schedule.next(n) {
+				missed = n
+			}
+			if j.CatchUp == RunMissedOnce {
+				s.run(ctx, j, missed)
+			} else {
+				s.O.L.LogAttrs(ctx, slog.LevelWarn, "skipping missed runs",
+					slog.String("job", j.Name),
+					slog.Time("last_missed", missed),
+				)
+			}
+			last = missed
+			continue
+		}
+
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.run(ctx, j, next)
+		last = next
+	}
+}
+
+// lastRun is the time to schedule j from:
+// the last run known to the Locker when catching up, or now.
+func (s *Scheduler) lastRun(ctx context.Context, j *job) time.Time {
+	now := s.now().In(s.loc)
+	lr, ok := s.Locker.(LastRunner)
+	if j.CatchUp != RunMissedOnce || !ok {
+		return now
+	}
+	last, err := lr.LastRun(ctx, j.Name)
+	if err != nil {
+		s.O.Err(ctx, "get last job run", err, slog.String("job", j.Name))
+		return now
+	}
+	if last.IsZero() || last.After(now) {
+		return now
+	}
+	return last.In(s.loc)
+}
+
+// run runs j for the time it was scheduled at,
+// if it can claim the run.
+func (s *Scheduler) run(ctx context.Context, j *job, scheduled time.Time) {
+	ctx, span := s.O.T.Start(ctx, "cron.run")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("job", j.Name),
+		attribute.String("scheduled", scheduled.Format(time.RFC3339)),
+	)
+	result := "success"
+	defer func() {
+		s.runs.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("job", j.Name),
+			attribute.String("result", result),
+		))
+	}()
+
+	if s.Locker != nil {
+		ok, err := s.Locker.TryLock(ctx, j.Name, scheduled)
+		if err != nil {
+			result = "error"
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "lock job run")
+			s.O.Err(ctx, "lock job run", err, slog.String("job", j.Name))
+			return
+		} else if !ok {
+			result = "skipped"
+			span.SetAttributes(attribute.Bool("skipped", true))
+			return
+		}
+	}
+
+	if j.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.Timeout)
+		defer cancel()
+	}
+	t0 := time.Now()
+	err := j.Run(ctx, s.O)
+	s.duration.Record(ctx, time.Since(t0).Seconds(), metric.WithAttributes(attribute.String("job", j.Name)))
+	if err != nil {
+		result = "error"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "run job")
+		s.O.Err(ctx, "run job", err,
+			slog.String("job", j.Name),
+			slog.Time("scheduled", scheduled),
+		)
+		return
+	}
+	s.O.L.LogAttrs(ctx, slog.LevelInfo, "ran job",
+		slog.String("job", j.Name),
+		slog.Time("scheduled", scheduled),
+		slog.Duration("duration", time.Since(t0)),
+	)
+}
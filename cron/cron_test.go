@@ -0,0 +1,133 @@
+package cron
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+// fakeLocker records claimed runs in memory.
+type fakeLocker struct {
+	mu      sync.Mutex
+	claimed map[string]bool
+	last    time.Time
+}
+
+func (l *fakeLocker) TryLock(ctx context.Context, job string, t time.Time) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := job + t.Format(time.RFC3339)
+	if l.claimed[key] {
+		return false, nil
+	}
+	l.claimed[key] = true
+	return true, nil
+}
+
+func (l *fakeLocker) LastRun(ctx context.Context, job string) (time.Time, error) {
+	return l.last, nil
+}
+
+func TestCatchUp(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+	s, err := New(ctx, o, &Config{Location: "UTC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	locker := &fakeLocker{claimed: make(map[string]bool), last: now.Add(-3 * time.Hour)}
+	s.Locker = locker
+
+	var mu sync.Mutex
+	var runs []time.Time
+	var deadline bool
+	err = s.Add(Job{
+		Name:     "report",
+		Schedule: "@hourly",
+		Timeout:  time.Minute,
+		CatchUp:  RunMissedOnce,
+		Run: func(ctx context.Context, o *observability.O) error {
+			mu.Lock()
+			defer mu.Unlock()
+			_, deadline = ctx.Deadline()
+			runs = append(runs, time.Now())
+			cancel()
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(runs) != 1 {
+		t.Fatalf("runs = %d, want 1 catch up run", len(runs))
+	}
+	if !deadline {
+		t.Errorf("run had no deadline from the job timeout")
+	}
+	// the claimed run is the most recent missed hour
+	want := now.Truncate(time.Hour)
+	if !locker.claimed["report"+want.Format(time.RFC3339)] {
+		t.Errorf("claimed = %v, want run at %v", locker.claimed, want)
+	}
+}
+
+func TestLocked(t *testing.T) {
+	t.Parallel()
+
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+	s, err := New(context.Background(), o, &Config{Location: "UTC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduled := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.Locker = &fakeLocker{claimed: map[string]bool{"job" + scheduled.Format(time.RFC3339): true}}
+
+	var ran bool
+	j := &job{Job: Job{
+		Name: "job",
+		Run: func(ctx context.Context, o *observability.O) error {
+			ran = true
+			return nil
+		},
+	}}
+	s.run(context.Background(), j, scheduled)
+	if ran {
+		t.Errorf("ran a run claimed by another replica")
+	}
+	s.run(context.Background(), j, scheduled.Add(time.Hour))
+	if !ran {
+		t.Errorf("didn't run an unclaimed run")
+	}
+}
+
+func TestAddInvalid(t *testing.T) {
+	t.Parallel()
+
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+	s, err := New(context.Background(), o, &Config{Location: "UTC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(ctx context.Context, o *observability.O) error { return nil }
+	for _, j := range []Job{
+		{Name: "", Schedule: "@daily", Run: run},
+		{Name: "a", Schedule: "@daily"},
+		{Name: "a", Schedule: "not a spec", Run: run},
+	} {
+		if err := s.Add(j); err == nil {
+			t.Errorf("add %+v: expected error", j)
+		}
+	}
+}
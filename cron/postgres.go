@@ -0,0 +1,61 @@
+package cron
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresLocker records claimed runs in a postgres table
+// shared by all replicas.
+type PostgresLocker struct {
+	Pool *pgxpool.Pool
+	// Retain is how long claimed runs are kept, 7 days if 0.
+	Retain time.Duration
+}
+
+// NewPostgresLocker creates the cron_runs table if it doesn't exist.
+func NewPostgresLocker(ctx context.Context, pool *pgxpool.Pool) (*PostgresLocker, error) {
+	_, err := pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS cron_runs (
+	job    TEXT        NOT NULL,
+	run_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (job, run_at)
+)`)
+	if err != nil {
+		return nil, fmt.Errorf("create cron_runs table: %w", err)
+	}
+	return &PostgresLocker{Pool: pool}, nil
+}
+
+func (l *PostgresLocker) TryLock(ctx context.Context, job string, t time.Time) (bool, error) {
+	retain := l.Retain
+	if retain <= 0 {
+		retain = 7 * 24 * time.Hour
+	}
+	_, err := l.Pool.Exec(ctx, `DELETE FROM cron_runs WHERE job = $1 AND run_at < $2`, job, t.Add(-retain))
+	if err != nil {
+		return false, fmt.Errorf("delete old runs: %w", err)
+	}
+	tag, err := l.Pool.Exec(ctx,
+		`INSERT INTO cron_runs (job, run_at) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		job, t,
+	)
+	if err != nil {
+		return false, fmt.Errorf("claim run: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (l *PostgresLocker) LastRun(ctx context.Context, job string) (time.Time, error) {
+	var last *time.Time
+	err := l.Pool.QueryRow(ctx, `SELECT max(run_at) FROM cron_runs WHERE job = $1`, job).Scan(&last)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("get last run: %w", err)
+	}
+	if last == nil {
+		return time.Time{}, nil
+	}
+	return *last, nil
+}
@@ -0,0 +1,179 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule computes run times.
+type schedule interface {
+	// next returns the first run time after t,
+	// or the zero time if there is none.
+	next(t time.Time) time.Time
+}
+
+// parse parses a standard 5 field cron spec:
+// minute, hour, day of month, month, day of week,
+// each * or a comma separated list of values, ranges a-b, and steps */n or a-b/n.
+// Descriptors @yearly, @monthly, @weekly, @daily, @hourly,
+// and @every <duration> are also accepted.
+func parse(spec string) (schedule, error) {
+	switch spec {
+	case "@yearly", "@annually":
+		spec = "0 0 1 1 *"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@hourly":
+		spec = "0 * * * *"
+	}
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		interval, err := time.ParseDuration(d)
+		if err != nil {
+			return nil, fmt.Errorf("parse interval: %w", err)
+		}
+		if interval < time.Second {
+			return nil, fmt.Errorf("interval too short: %v", interval)
+		}
+		return every(interval), nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields, got %d: %q", len(fields), spec)
+	}
+	var s cronSchedule
+	var err error
+	for i, f := range []struct {
+		bits     *uint64
+		min, max int
+		name     string
+	}{
+		{&s.minute, 0, 59, "minute"},
+		{&s.hour, 0, 23, "hour"},
+		{&s.dom, 1, 31, "day of month"},
+		{&s.month, 1, 12, "month"},
+		{&s.dow, 0, 7, "day of week"},
+	} {
+		*f.bits, err = parseField(fields[i], f.min, f.max)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+	// 7 is also sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = fields[2] == "*"
+	s.dowStar = fields[4] == "*"
+	return s, nil
+}
+
+// parseField parses a field into a bitset of the values it matches.
+func parseField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step: %q", part)
+			}
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+			var err error
+			lo, err = strconv.Atoi(loStr)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value: %q", part)
+			}
+			hi = lo
+			if isRange {
+				hi, err = strconv.Atoi(hiStr)
+				if err != nil {
+					return 0, fmt.Errorf("invalid value: %q", part)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("out of range %d-%d: %q", min, max, part)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// cronSchedule matches times by their fields.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar record unrestricted day fields:
+	// if both are restricted, either may match.
+	domStar, dowStar bool
+}
+
+func (s cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<t.Weekday()) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func (s cronSchedule) next(t time.Time) time.Time {
+	// match fields against the wall clock in UTC,
+	// where every time exists once,
+	// then convert matches back to t's location.
+	w := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC).Add(time.Minute)
+	limit := w.Year() + 5
+	for w.Year() <= limit {
+		switch {
+		case s.month&(1<<w.Month()) == 0:
+			w = time.Date(w.Year(), w.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.dayMatches(w):
+			w = time.Date(w.Year(), w.Month(), w.Day()+1, 0, 0, 0, 0, time.UTC)
+		case s.hour&(1<<w.Hour()) == 0:
+			w = w.Truncate(time.Hour).Add(time.Hour)
+		case s.minute&(1<<w.Minute()) == 0:
+			w = w.Add(time.Minute)
+		default:
+			r := time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), 0, 0, t.Location())
+			rw := time.Date(r.Year(), r.Month(), r.Day(), r.Hour(), r.Minute(), 0, 0, time.UTC)
+			if rw.Before(w) {
+				// skipped by a daylight saving transition,
+				// normalized to before it:
+				// run at the end of the gap like standard cron
+				_, r = r.ZoneBounds()
+			} else if rw.After(w) {
+				// normalized to after it
+				r, _ = r.ZoneBounds()
+			}
+			// repeated wall times run once
+			if r.After(t) {
+				return r
+			}
+			w = w.Add(time.Minute)
+		}
+	}
+	return time.Time{}
+}
+
+// every runs at a fixed interval,
+// aligned to the wall clock so replicas agree on scheduled times.
+type every time.Duration
+
+func (e every) next(t time.Time) time.Time {
+	return t.Truncate(time.Duration(e)).Add(time.Duration(e))
+}
@@ -0,0 +1,132 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	t.Parallel()
+
+	from := time.Date(2024, time.March, 15, 10, 30, 0, 0, time.UTC) // friday
+	tcs := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 3, 15, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 3, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2024, 3, 15, 11, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 3, 15, 11, 0, 0, 0, time.UTC)},
+		{"30 9 * * *", time.Date(2024, 3, 16, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 1-5", time.Date(2024, 3, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 12 13 * 5", time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)}, // day of month or week
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"5,10 8-10/2 * * *", time.Date(2024, 3, 16, 8, 5, 0, 0, time.UTC)},
+		{"@every 90m", time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, tc := range tcs {
+		s, err := parse(tc.spec)
+		if err != nil {
+			t.Errorf("parse %q: %v", tc.spec, err)
+			continue
+		}
+		if got := s.next(from); !got.Equal(tc.want) {
+			t.Errorf("next %q = %v, want %v", tc.spec, got, tc.want)
+		}
+	}
+}
+
+func TestNextDST(t *testing.T) {
+	t.Parallel()
+
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	// 2024-03-10 02:00 EST skips to 03:00 EDT,
+	// 2024-11-03 02:00 EDT repeats 01:00 to 01:59 as EST.
+	tcs := []struct {
+		spec string
+		from time.Time
+		want []time.Time
+	}{
+		{"30 2 * * *", time.Date(2024, 3, 9, 12, 0, 0, 0, ny), []time.Time{
+			time.Date(2024, 3, 10, 3, 0, 0, 0, ny), // end of the gap
+			time.Date(2024, 3, 11, 2, 30, 0, 0, ny),
+		}},
+		{"30 3 * * *", time.Date(2024, 3, 10, 1, 0, 0, 0, ny), []time.Time{
+			time.Date(2024, 3, 10, 3, 30, 0, 0, ny),
+		}},
+		{"0 * * * *", time.Date(2024, 3, 10, 0, 30, 0, 0, ny), []time.Time{
+			time.Date(2024, 3, 10, 1, 0, 0, 0, ny),
+			time.Date(2024, 3, 10, 3, 0, 0, 0, ny), // 02:00 runs once, at 03:00
+			time.Date(2024, 3, 10, 4, 0, 0, 0, ny),
+		}},
+		{"30 1 * * *", time.Date(2024, 11, 3, 0, 0, 0, 0, ny), []time.Time{
+			time.Date(2024, 11, 3, 1, 30, 0, 0, ny),
+			time.Date(2024, 11, 4, 1, 30, 0, 0, ny),
+		}},
+	}
+	for _, tc := range tcs {
+		s, err := parse(tc.spec)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tc.spec, err)
+		}
+		from := tc.from
+		for _, want := range tc.want {
+			got := s.next(from)
+			if !got.Equal(want) {
+				t.Errorf("next %q from %v = %v, want %v", tc.spec, from, got, want)
+				break
+			}
+			from = got
+		}
+	}
+}
+
+func TestEveryAligned(t *testing.T) {
+	t.Parallel()
+
+	s, err := parse("@every 10m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// replicas starting at different times agree on the next run
+	want := time.Date(2024, 3, 15, 10, 40, 0, 0, time.UTC)
+	for _, start := range []time.Time{
+		time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC),
+		time.Date(2024, 3, 15, 10, 33, 17, 0, time.UTC),
+		time.Date(2024, 3, 15, 10, 39, 59, 0, time.UTC),
+	} {
+		if got := s.next(start); !got.Equal(want) {
+			t.Errorf("next from %v = %v, want %v", start, got, want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@every 1ms",
+		"@every soon",
+	} {
+		_, err := parse(spec)
+		if err == nil {
+			t.Errorf("parse %q: expected error", spec)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package framework
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.seankhliao.com/svcrunner/v3/basehttp"
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+// Command is an application defined command,
+// run with the observability flags in addition to its own.
+type Command struct {
+	Name          string
+	Usage         string
+	RegisterFlags func(*flag.FlagSet)
+	// Run is called with the remaining positional arguments.
+	Run func(ctx context.Context, o *observability.O, args []string) error
+}
+
+// cmdEnv is the environment commands run in.
+type cmdEnv struct {
+	args      []string
+	envPrefix string
+	lookupEnv func(string) (string, bool)
+	secrets   SecretProvider
+	stdout    io.Writer
+	stderr    io.Writer
+}
+
+// flagSet creates a flag set for a command,
+// listing the available commands in its usage.
+func (e cmdEnv) flagSet(name string, c Config) *flag.FlagSet {
+	fset := flag.NewFlagSet(os.Args[0]+" "+name, flag.ContinueOnError)
+	fset.SetOutput(e.stderr)
+	fset.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage of %s:\n", fset.Name())
+		fmt.Fprintln(e.stderr, "\nCommands:")
+		fmt.Fprintln(e.stderr, "  serve\n\trun the servers (default)")
+		fmt.Fprintln(e.stderr, "  version\n\tprint version information")
+		fmt.Fprintln(e.stderr, "  healthcheck\n\tcheck the health of a running instance")
+		for _, cmd := range c.Commands {
+			fmt.Fprintf(e.stderr, "  %s\n\t%s\n", cmd.Name, cmd.Usage)
+		}
+		fmt.Fprintln(e.stderr, "\nFlags:")
+		fset.PrintDefaults()
+	}
+	return fset
+}
+
+// envName is the environment variable for a flag.
+func envName(prefix, flagName string) string {
+	return prefix + strings.NewReplacer(".", "_", "-", "_").Replace(strings.ToUpper(flagName))
+}
+
+// parse parses environment variables, then the command arguments into fset.
+// Environment values of the form secret://name are read from e.secrets.
+// Flags in noEnv select actions instead of configuring the command,
+// and are only set by arguments,
+// so common variables such as VERSION don't change what runs.
+func (e cmdEnv) parse(ctx context.Context, fset *flag.FlagSet, noEnv ...string) error {
+	var errs []error
+	fset.VisitAll(func(f *flag.Flag) {
+		if slices.Contains(noEnv, f.Name) {
+			return
+		}
+		name := envName(e.envPrefix, f.Name)
+		v, ok := e.lookupEnv(name)
+		if !ok {
+			return
+		}
+		v, err := e.resolveSecret(ctx, v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("env %s: %w", name, err))
+			return
+		}
+		err = fset.Set(f.Name, v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid value %q for env %s: %w", v, name, err))
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		fmt.Fprintln(e.stderr, err)
+		return usageError{err}
+	}
+
+	err := fset.Parse(e.args)
+	if errors.Is(err, flag.ErrHelp) {
+		return err
+	} else if err != nil {
+		return usageError{err}
+	}
+	return nil
+}
+
+// resolveSecret returns the named secret for values of the form secret://name,
+// and other values unchanged.
+func (e cmdEnv) resolveSecret(ctx context.Context, v string) (string, error) {
+	name, ok := strings.CutPrefix(v, "secret://")
+	if !ok {
+		return v, nil
+	}
+	if e.secrets == nil {
+		return "", fmt.Errorf("no secret provider to read %s", v)
+	}
+	b, err := e.secrets.Secret(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("read secret %s: %w", name, err)
+	}
+	return string(b), nil
+}
+
+// dispatch runs the command selected by the first argument,
+// defaulting to serve.
+func dispatch(ctx context.Context, c Config, e cmdEnv) error {
+	name := "serve"
+	if len(e.args) > 0 && !strings.HasPrefix(e.args[0], "-") {
+		name, e.args = e.args[0], e.args[1:]
+	}
+	switch name {
+	case "serve":
+		return serve(ctx, c, e)
+	case "version":
+		return version(ctx, c, e)
+	case "healthcheck":
+		return healthcheck(ctx, c, e)
+	}
+	for _, cmd := range c.Commands {
+		if cmd.Name == name {
+			return runCommand(ctx, c, cmd, e)
+		}
+	}
+	err := fmt.Errorf("unknown command: %q", name)
+	fmt.Fprintln(e.stderr, err)
+	return usageError{err}
+}
+
+// runCommand runs an application defined command.
+func runCommand(ctx context.Context, c Config, cmd Command, e cmdEnv) error {
+	fset := e.flagSet(cmd.Name, c)
+	oconf := &observability.Config{}
+	oconf.SetFlags(fset)
+	if cmd.RegisterFlags != nil {
+		cmd.RegisterFlags(fset)
+	}
+	err := e.parse(ctx, fset)
+	if err != nil {
+		return err
+	}
+	if oconf.LogOutput == nil {
+		oconf.LogOutput = e.stdout
+	}
+
+	o := observability.New(oconf)
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	err = cmd.Run(ctx, o, fset.Args())
+	stop()
+	if err != nil {
+		err = o.Err(ctx, "run command", err, slog.String("command", cmd.Name))
+	}
+
+	sctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if serr := o.Shutdown(sctx); serr != nil {
+		o.Err(ctx, "shutdown observability", serr)
+	}
+	return err
+}
+
+// versionFlag selects printing the version as text or json,
+// used as -version or -version=json.
+type versionFlag string
+
+func (v *versionFlag) String() string   { return string(*v) }
+func (v *versionFlag) IsBoolFlag() bool { return true }
+func (v *versionFlag) Set(s string) error {
+	switch s {
+	case "true", "text":
+		*v = "text"
+	case "json":
+		*v = "json"
+	case "false":
+		*v = ""
+	default:
+		return fmt.Errorf("unknown version format: %q", s)
+	}
+	return nil
+}
+
+// printVersion writes the build info in the selected format.
+func printVersion(w io.Writer, format versionFlag) error {
+	bi := observability.ReadBuildInfo()
+	if format == "json" {
+		return json.NewEncoder(w).Encode(bi)
+	}
+	_, err := fmt.Fprintln(w, bi)
+	return err
+}
+
+// version prints the build info of the binary.
+func version(ctx context.Context, c Config, e cmdEnv) error {
+	fset := e.flagSet("version", c)
+	var asJSON bool
+	fset.BoolVar(&asJSON, "json", false, "print as json")
+	err := e.parse(ctx, fset, "json")
+	if err != nil {
+		return err
+	}
+	format := versionFlag("text")
+	if asJSON {
+		format = "json"
+	}
+	return printVersion(e.stdout, format)
+}
+
+// httpFlags registers the basehttp flags on fset,
+// with the default address using $PORT from the command environment.
+func (e cmdEnv) httpFlags(fset *flag.FlagSet) *basehttp.Config {
+	hconf := &basehttp.Config{}
+	hconf.SetFlags(fset)
+	if port, ok := e.lookupEnv("PORT"); ok && port != "" {
+		hconf.Address = ":" + port
+	}
+	return hconf
+}
+
+// healthcheck probes the health endpoint of a running instance,
+// returning an error if it isn't healthy.
+// The endpoint is found from the http flags as serve -healthcheck does,
+// unless given with -url.
+func healthcheck(ctx context.Context, c Config, e cmdEnv) error {
+	fset := e.flagSet("healthcheck", c)
+	hconf := e.httpFlags(fset)
+	var u string
+	var timeout time.Duration
+	fset.StringVar(&u, "url", "", "health endpoint to check, derived from the http flags if empty")
+	fset.DurationVar(&timeout, "timeout", 5*time.Second, "timeout for the check")
+	err := e.parse(ctx, fset, "url", "timeout")
+	if err != nil {
+		return err
+	}
+
+	return probeHealth(ctx, e, hconf, u, timeout)
+}
+
+// checkHealth gets the health endpoint at u,
+// returning an error if it doesn't respond with 200 OK.
+func checkHealth(ctx context.Context, e cmdEnv, client *http.Client, u string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintln(e.stderr, "unhealthy:", err)
+		return fmt.Errorf("check health: %w", err)
+	}
+	defer res.Body.Close()
+	io.Copy(e.stdout, res.Body)
+	if res.StatusCode != http.StatusOK {
+		err := fmt.Errorf("unhealthy status: %s", res.Status)
+		fmt.Fprintln(e.stderr, err)
+		return err
+	}
+	return nil
+}
+
+// probeHealth checks the health endpoint at u,
+// or if u is empty, the readiness endpoint of an instance
+// running with the http config, on the admin server if there is one.
+func probeHealth(ctx context.Context, e cmdEnv, hconf *basehttp.Config, u string, timeout time.Duration) error {
+	if u != "" {
+		return checkHealth(ctx, e, http.DefaultClient, u, timeout)
+	}
+
+	scheme := "http"
+	addr := hconf.AdminAddress
+	if addr == "" {
+		addr, _, _ = strings.Cut(hconf.Address, ",")
+		if hconf.TLSCert != "" {
+			scheme = "https"
+		}
+	}
+
+	client := &http.Client{}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// checking ourselves, not the certificate
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	if socket, ok := strings.CutPrefix(addr, "unix://"); ok {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		addr = "localhost"
+	} else {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return fmt.Errorf("parse http address %q: %w", addr, err)
+		}
+		if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+			host = "127.0.0.1"
+		}
+		addr = net.JoinHostPort(host, port)
+	}
+	client.Transport = transport
+
+	return checkHealth(ctx, e, client, scheme+"://"+addr+"/readyz", timeout)
+}
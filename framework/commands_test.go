@@ -0,0 +1,370 @@
+package framework
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+	"go.seankhliao.com/svcrunner/v3/secret"
+)
+
+func TestCommand(t *testing.T) {
+	t.Parallel()
+
+	var name string
+	var gotArgs []string
+	err := RunE(context.Background(), Config{
+		Args:   []string{"greet", "-name=world", "a", "b"},
+		Stdout: io.Discard,
+		Stderr: io.Discard,
+		Commands: []Command{{
+			Name: "greet",
+			RegisterFlags: func(fset *flag.FlagSet) {
+				fset.StringVar(&name, "name", "", "who to greet")
+			},
+			Run: func(ctx context.Context, o *observability.O, args []string) error {
+				gotArgs = args
+				return nil
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "world" || strings.Join(gotArgs, " ") != "a b" {
+		t.Errorf("name = %q, args = %v", name, gotArgs)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	t.Parallel()
+
+	tcs := []struct {
+		args     []string
+		wantJSON bool
+	}{
+		{[]string{"version"}, false},
+		{[]string{"version", "-json"}, true},
+		{[]string{"-version"}, false},
+		{[]string{"-version=json"}, true},
+	}
+	for _, tc := range tcs {
+		buf := new(bytes.Buffer)
+		err := RunE(context.Background(), Config{
+			Args:   tc.args,
+			Stdout: buf,
+			Stderr: io.Discard,
+		})
+		if err != nil {
+			t.Errorf("%v: %v", tc.args, err)
+			continue
+		}
+		if tc.wantJSON {
+			var bi observability.BuildInfo
+			err := json.Unmarshal(buf.Bytes(), &bi)
+			if err != nil || !strings.HasPrefix(bi.GoVersion, "go") {
+				t.Errorf("%v: unexpected json output %q: %v", tc.args, buf.String(), err)
+			}
+		} else if !strings.Contains(buf.String(), " go1") {
+			t.Errorf("%v: version output missing go version: %q", tc.args, buf.String())
+		}
+	}
+}
+
+func TestHealthcheck(t *testing.T) {
+	t.Parallel()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unhealthy.Close()
+
+	tcs := []struct {
+		url     string
+		wantErr bool
+	}{
+		{healthy.URL, false},
+		{unhealthy.URL, true},
+	}
+	for _, tc := range tcs {
+		err := RunE(context.Background(), Config{
+			Args:   []string{"healthcheck", "-url=" + tc.url},
+			Stdout: io.Discard,
+			Stderr: io.Discard,
+		})
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tc.url, err, tc.wantErr)
+		}
+	}
+}
+
+func TestHealthcheckPort(t *testing.T) {
+	t.Parallel()
+
+	ready := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/readyz" {
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ready.Close()
+	_, port, _ := strings.Cut(ready.Listener.Addr().String(), ":")
+
+	err := RunE(context.Background(), Config{
+		Args:   []string{"healthcheck"},
+		Stdout: io.Discard,
+		Stderr: io.Discard,
+		LookupEnv: func(k string) (string, bool) {
+			if k == "PORT" {
+				return port, true
+			}
+			return "", false
+		},
+	})
+	if err != nil {
+		t.Errorf("healthcheck with PORT from env: %v", err)
+	}
+}
+
+func TestHealthcheckHTTPFlags(t *testing.T) {
+	t.Parallel()
+
+	ready := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/readyz" {
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ready.Close()
+	_, port, _ := strings.Cut(ready.Listener.Addr().String(), ":")
+
+	// the subcommand finds the admin server as serve -healthcheck does
+	for _, args := range [][]string{
+		{"healthcheck", "-http.addr=127.0.0.1:1", "-http.admin-addr=:" + port},
+		{"-healthcheck", "-http.addr=127.0.0.1:1", "-http.admin-addr=:" + port},
+	} {
+		err := RunE(context.Background(), Config{
+			Args:   args,
+			Stdout: io.Discard,
+			Stderr: io.Discard,
+		})
+		if err != nil {
+			t.Errorf("%v: %v", args, err)
+		}
+	}
+}
+
+func TestEnv(t *testing.T) {
+	t.Parallel()
+
+	tcs := []struct {
+		name      string
+		env       map[string]string
+		args      []string
+		want      string
+		wantUsage bool
+	}{
+		{"env", map[string]string{"GREET_NAME": "env"}, nil, "env", false},
+		{"args override env", map[string]string{"GREET_NAME": "env"}, []string{"-greet.name=args"}, "args", false},
+		{"invalid env", map[string]string{"GREET_COUNT": "many"}, nil, "", true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var name string
+			err := RunE(context.Background(), Config{
+				Args: append([]string{"greet"}, tc.args...),
+				LookupEnv: func(k string) (string, bool) {
+					v, ok := tc.env[k]
+					return v, ok
+				},
+				Stdout: io.Discard,
+				Stderr: io.Discard,
+				Commands: []Command{{
+					Name: "greet",
+					RegisterFlags: func(fset *flag.FlagSet) {
+						fset.StringVar(&name, "greet.name", "", "who to greet")
+						fset.Int("greet.count", 1, "times to greet")
+					},
+					Run: func(ctx context.Context, o *observability.O, args []string) error {
+						return nil
+					},
+				}},
+			})
+			if got := errors.As(err, new(usageError)); got != tc.wantUsage {
+				t.Fatalf("usage error = %v, want %v: %v", got, tc.wantUsage, err)
+			}
+			if name != tc.want {
+				t.Errorf("name = %q, want %q", name, tc.want)
+			}
+		})
+	}
+}
+
+func TestEnvSecrets(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "greeting"), []byte("hunter2\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		name      string
+		secrets   SecretProvider
+		value     string
+		want      string
+		wantUsage bool
+	}{
+		{"secret", secret.Files{Dir: dir}, "secret://greeting", "hunter2", false},
+		{"plain value", secret.Files{Dir: dir}, "plain", "plain", false},
+		{"missing secret", secret.Files{Dir: dir}, "secret://missing", "", true},
+		{"no provider", nil, "secret://greeting", "", true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var name string
+			err := RunE(context.Background(), Config{
+				Args: []string{"greet"},
+				LookupEnv: func(k string) (string, bool) {
+					return tc.value, k == "GREET_NAME"
+				},
+				Secrets: tc.secrets,
+				Stdout:  io.Discard,
+				Stderr:  io.Discard,
+				Commands: []Command{{
+					Name: "greet",
+					RegisterFlags: func(fset *flag.FlagSet) {
+						fset.StringVar(&name, "greet.name", "", "who to greet")
+					},
+					Run: func(ctx context.Context, o *observability.O, args []string) error {
+						return nil
+					},
+				}},
+			})
+			if got := errors.As(err, new(usageError)); got != tc.wantUsage {
+				t.Fatalf("usage error = %v, want %v: %v", got, tc.wantUsage, err)
+			}
+			if name != tc.want {
+				t.Errorf("name = %q, want %q", name, tc.want)
+			}
+		})
+	}
+}
+
+func TestEnvCommandFlags(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{
+		"VERSION":     "1.2.3",
+		"HEALTHCHECK": "yes",
+		"JSON":        "true",
+		"URL":         "http://example.invalid",
+	}
+	lookupEnv := func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+
+	// serve only reaches help if the env didn't fail parsing
+	err := RunE(context.Background(), Config{
+		Args:      []string{"-help"},
+		LookupEnv: lookupEnv,
+		Stdout:    io.Discard,
+		Stderr:    io.Discard,
+	})
+	if !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("serve: err = %v, want %v", err, flag.ErrHelp)
+	}
+
+	out := new(bytes.Buffer)
+	err = RunE(context.Background(), Config{
+		Args:      []string{"version"},
+		LookupEnv: lookupEnv,
+		Stdout:    out,
+		Stderr:    io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if json.Valid(out.Bytes()) {
+		t.Errorf("version printed json from env: %s", out)
+	}
+}
+
+func TestEnvPrefix(t *testing.T) {
+	t.Parallel()
+
+	var name string
+	err := RunE(context.Background(), Config{
+		Args:      []string{"greet"},
+		EnvPrefix: "MYAPP_",
+		LookupEnv: func(k string) (string, bool) {
+			v, ok := map[string]string{"GREET_NAME": "unprefixed", "MYAPP_GREET_NAME": "prefixed"}[k]
+			return v, ok
+		},
+		Stdout: io.Discard,
+		Stderr: io.Discard,
+		Commands: []Command{{
+			Name: "greet",
+			RegisterFlags: func(fset *flag.FlagSet) {
+				fset.StringVar(&name, "greet.name", "", "who to greet")
+			},
+			Run: func(ctx context.Context, o *observability.O, args []string) error {
+				return nil
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "prefixed" {
+		t.Errorf("name = %q, want prefixed", name)
+	}
+}
+
+func TestSelfHealthcheck(t *testing.T) {
+	t.Parallel()
+
+	ready := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/readyz" {
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ready.Close()
+	_, port, _ := strings.Cut(ready.Listener.Addr().String(), ":")
+
+	tcs := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{"http addr", []string{"-healthcheck", "-http.addr=:" + port}, false},
+		{"admin addr", []string{"-healthcheck", "-http.addr=127.0.0.1:1", "-http.admin-addr=0.0.0.0:" + port}, false},
+		{"unavailable", []string{"-healthcheck", "-http.addr=127.0.0.1:1"}, true},
+	}
+	for _, tc := range tcs {
+		err := RunE(context.Background(), Config{
+			Args:   tc.args,
+			Stdout: io.Discard,
+			Stderr: io.Discard,
+		})
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
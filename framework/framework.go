@@ -1,69 +1,579 @@
 package framework
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
+	"go.seankhliao.com/svcrunner/v3/basegrpc"
 	"go.seankhliao.com/svcrunner/v3/basehttp"
 	"go.seankhliao.com/svcrunner/v3/observability"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
 )
 
+// SecretProvider looks up secrets by name,
+// matching secret.Provider.
+type SecretProvider interface {
+	Secret(ctx context.Context, name string) ([]byte, error)
+}
+
+// Config describes an application.
+// Run serves it with the flags of observability and basehttp,
+// including http.admin-addr to serve health, readiness, metrics,
+// pprof, and build info on a separate admin server.
 type Config struct {
 	RegisterFlags func(*flag.FlagSet)
 	Start         func(context.Context, *observability.O, *http.ServeMux) (cleanup func(), err error)
+	// StartRunnables is an alternative to Start,
+	// also returning functions that run alongside the servers like Workers:
+	// they start concurrently, ctx is canceled for all of them at shutdown,
+	// and their errors are returned together.
+	// An error from any of them shuts down the application.
+	StartRunnables func(context.Context, *observability.O, *http.ServeMux) (run []func(context.Context) error, cleanup func(), err error)
+	// StartGRPC registers grpc services, called after Start.
+	// The services are served on grpc.addr, or with http if it is empty.
+	StartGRPC func(context.Context, *observability.O, *grpc.Server) error
+	// Warmup functions run concurrently after Start,
+	// the servers start once they all complete.
+	// Use them to prime caches or dial connections
+	// before the application reports as ready.
+	Warmup []func(context.Context, *observability.O) error
+	// Workers run alongside the servers after Start,
+	// until ctx is canceled.
+	// An error from any worker shuts down the application.
+	Workers []func(context.Context, *observability.O) error
+	// Reload functions run in order when the process receives SIGHUP,
+	// such as to re-read config files or rotate credentials.
+	// Errors are logged and counted in the svcrunner.reloads metric,
+	// the application keeps running.
+	Reload []func(context.Context, *observability.O) error
+
+	// PreRun is called before Start, with observability set up.
+	PreRun func(context.Context, *observability.O) error
+	// PreServe is called for each http listener after it is bound,
+	// such as to discover the address when listening on port 0.
+	PreServe func(context.Context, *observability.O, net.Listener) error
+	// PostStart is called once the http server is listening,
+	// such as to register with service discovery.
+	PostStart func(context.Context, *observability.O) error
+	// OnShutdown is called when shutdown begins,
+	// concurrently with the servers draining requests,
+	// such as to deregister from service discovery.
+	// Run waits for it to return before exiting.
+	OnShutdown func(context.Context, *observability.O)
+
+	// Observability modifies the observability config after flags are parsed,
+	// such as to set in memory exporters.
+	Observability func(*observability.Config)
+
+	// Modules are composed into the application,
+	// each contributing its own flags, routes, workers, and shutdown.
+	Modules []Module
+
+	// Commands are additional commands selected by the first argument,
+	// alongside the builtin serve, version, and healthcheck.
+	Commands []Command
+
+	// Args are the command line arguments without the program name,
+	// os.Args[1:] if nil.
+	Args []string
+	// LookupEnv reads environment variables, os.LookupEnv if nil.
+	// Flags are also read from environment variables,
+	// named by EnvPrefix and the uppercased flag name with . and - replaced by _,
+	// such as HTTP_ADDR for -http.addr.
+	// Command line arguments take precedence.
+	// The flags of the builtin version command, -url and -timeout of healthcheck,
+	// and -version and -healthcheck for serve, are only read from arguments.
+	// $PORT sets the default http address.
+	LookupEnv func(string) (string, bool)
+	// EnvPrefix namespaces the environment variables flags are read from,
+	// such as MYAPP_ to read -http.addr from MYAPP_HTTP_ADDR.
+	EnvPrefix string
+	// Secrets resolves environment variables set to secret://name
+	// to the value of the named secret.
+	// It's usually a secret.Provider, such as secret.Files{Dir: "/run/secrets"},
+	// declared here so the framework doesn't depend on every provider.
+	// Secrets in environment variables are an error if nil.
+	Secrets SecretProvider
+	// Stdout receives logs, os.Stdout if nil.
+	Stdout io.Writer
+	// Stderr receives flag usage and errors, os.Stderr if nil.
+	Stderr io.Writer
+}
+
+// Exit codes of Run, classifying the error the application exited with.
+const (
+	// ExitOK is a clean shutdown, or printing help.
+	ExitOK = 0
+	// ExitError is an error while serving, or from a command.
+	ExitError = 1
+	// ExitUsage is invalid flags, environment variables, or arguments.
+	ExitUsage = 2
+	// ExitShutdownTimeout is abandoning shutdown after shutdown.timeout.
+	ExitShutdownTimeout = 3
+	// ExitStartup is an error starting the application,
+	// before it began serving.
+	ExitStartup = 4
+)
+
+// ExitCode returns the exit code for an error returned by RunE.
+func ExitCode(err error) int {
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return ExitOK
+	case errors.Is(err, ErrShutdownTimeout):
+		return ExitShutdownTimeout
+	case errors.As(err, new(usageError)):
+		return ExitUsage
+	case errors.As(err, new(startupError)):
+		return ExitStartup
+	default:
+		return ExitError
+	}
 }
 
+// Run runs the application until it receives SIGINT or SIGTERM,
+// exiting the process with ExitCode on errors.
 func Run(c Config) {
+	RunContext(context.Background(), c)
+}
+
+// RunContext is Run with a parent context,
+// canceling ctx starts the same graceful shutdown as a signal.
+func RunContext(ctx context.Context, c Config) {
+	err := RunE(ctx, c)
+	if code := ExitCode(err); code != ExitOK {
+		os.Exit(code)
+	}
+}
+
+// ErrShutdownTimeout is returned by RunE if the application
+// didn't stop within the shutdown timeout.
+// Run exits with code 3 for it.
+var ErrShutdownTimeout = errors.New("shutdown timed out")
+
+// waitShutdown waits for the result of running the application,
+// abandoning it if it doesn't complete within timeout after shutdown starts.
+func waitShutdown(ctx context.Context, o *observability.O, runErr <-chan error, shutdown <-chan struct{}, timeout time.Duration) error {
+	select {
+	case err := <-runErr:
+		return err
+	case <-shutdown:
+	}
+	if timeout <= 0 {
+		return <-runErr
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-runErr:
+		return err
+	case <-timer.C:
+	}
+
+	buf := new(bytes.Buffer)
+	pprof.Lookup("goroutine").WriteTo(buf, 2)
+	o.L.LogAttrs(ctx, slog.LevelError, "shutdown timed out, abandoning remaining work",
+		slog.Duration("timeout", timeout),
+		slog.String("goroutines", buf.String()),
+	)
+	return ErrShutdownTimeout
+}
+
+// usageError is an error in the command line arguments.
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string { return e.err.Error() }
+func (e usageError) Unwrap() error { return e.err }
+
+// startupError is an error from before the application began serving.
+type startupError struct {
+	err error
+}
+
+func (e startupError) Error() string { return e.err.Error() }
+func (e startupError) Unwrap() error { return e.err }
+
+// RunE runs the application until ctx is canceled
+// or it receives SIGINT or SIGTERM,
+// returning any error instead of exiting the process,
+// for embedding in larger programs or tests.
+// The first argument may select a command other than serve.
+// Errors from parsing arguments wrap flag.ErrHelp if help was requested.
+func RunE(ctx context.Context, c Config) error {
+	return dispatch(ctx, c, newCmdEnv(c))
+}
+
+// newCmdEnv creates the command environment from c,
+// defaulting to the process's.
+func newCmdEnv(c Config) cmdEnv {
+	e := cmdEnv{
+		args:      c.Args,
+		envPrefix: c.EnvPrefix,
+		lookupEnv: c.LookupEnv,
+		secrets:   c.Secrets,
+		stdout:    c.Stdout,
+		stderr:    c.Stderr,
+	}
+	if e.args == nil {
+		e.args = os.Args[1:]
+	}
+	if e.lookupEnv == nil {
+		e.lookupEnv = os.LookupEnv
+	}
+	if e.stdout == nil {
+		e.stdout = os.Stdout
+	}
+	if e.stderr == nil {
+		e.stderr = os.Stderr
+	}
+	return e
+}
+
+// serve runs the servers for the application.
+func serve(ctx context.Context, c Config, e cmdEnv) error {
 	// configs
-	fset := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	t0 := time.Now()
+	fset := e.flagSet("serve", c)
 	oconf := &observability.Config{}
 	oconf.SetFlags(fset)
-	hconf := &basehttp.Config{}
-	hconf.SetFlags(fset)
+	hconf := e.httpFlags(fset)
+	gconf := &basegrpc.Config{}
+	if c.StartGRPC != nil {
+		gconf.SetFlags(fset)
+	}
+	var printVer versionFlag
+	fset.Var(&printVer, "version", "print version information and exit, -version=json for json")
+	var selfCheck bool
+	fset.BoolVar(&selfCheck, "healthcheck", false, "check the readiness of an instance running with the same flags and exit, for container health checks")
+	var shutdownTimeout time.Duration
+	fset.DurationVar(&shutdownTimeout, "shutdown.timeout", 30*time.Second, "time to wait for everything to stop after shutdown starts before abandoning it, 0 for no limit")
 	if c.RegisterFlags != nil {
 		c.RegisterFlags(fset)
 	}
-	fset.Parse(os.Args[1:])
+	for _, m := range c.Modules {
+		if m.RegisterFlags != nil {
+			m.RegisterFlags(fset)
+		}
+	}
+	err := e.parse(ctx, fset, "version", "healthcheck")
+	if err != nil {
+		return err
+	}
 	if len(fset.Args()) > 0 {
-		fmt.Fprintln(os.Stderr, "unexpected arguments:", fset.Args())
-		os.Exit(1)
+		err := fmt.Errorf("unexpected arguments: %v", fset.Args())
+		fmt.Fprintln(e.stderr, err)
+		return usageError{err}
+	}
+	if printVer != "" {
+		return printVersion(e.stdout, printVer)
+	}
+	if selfCheck {
+		return probeHealth(ctx, e, hconf, "", 5*time.Second)
+	}
+	if oconf.LogOutput == nil {
+		oconf.LogOutput = e.stdout
+	}
+	if c.Observability != nil {
+		c.Observability(oconf)
 	}
 
 	// observability
 	o := observability.New(oconf)
+	o.RecordPhase(ctx, "config", time.Since(t0))
+	o.L.LogAttrs(ctx, slog.LevelInfo, "starting application",
+		slog.Any("build", observability.ReadBuildInfo()),
+	)
+
+	// context, canceled to start shutdown
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
+
+	// shutdown duration, including app cleanup
+	var shutdownStart time.Time
+	shutdown := make(chan struct{})
+	context.AfterFunc(ctx, func() {
+		shutdownStart = time.Now()
+		close(shutdown)
+	})
 
 	// run
-	ctx := context.Background()
-	err := func() error {
-		// context
-		ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
-		defer stop()
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- run(ctx, o, c, hconf, gconf, cancelRun)
+	}()
+	err = waitShutdown(ctx, o, runErr, shutdown, shutdownTimeout)
+	select {
+	case <-shutdown:
+		o.RecordPhase(ctx, "shutdown", time.Since(shutdownStart))
+	default:
+	}
 
-		h := basehttp.New(ctx, o, hconf)
+	// record the error while it can still be exported
+	if err != nil {
+		err = o.Err(ctx, "exiting with error", err)
+	}
 
-		if c.Start != nil {
-			cleanup, err := c.Start(ctx, o, h.Mux)
-			if err != nil {
-				return o.Err(ctx, "app start", err)
-			}
-			if cleanup != nil {
-				defer cleanup()
-			}
+	sctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if serr := o.Shutdown(sctx); serr != nil {
+		o.Err(ctx, "shutdown observability", serr)
+	}
+	return err
+}
+
+// reload runs the reload functions,
+// logging and recording the result.
+func reload(ctx context.Context, o *observability.O, reloads []func(context.Context, *observability.O) error) {
+	o.L.LogAttrs(ctx, slog.LevelInfo, "reloading application")
+	var errs []error
+	for _, r := range reloads {
+		if err := r(ctx, o); err != nil {
+			errs = append(errs, err)
 		}
+	}
+	err := errors.Join(errs...)
+	o.RecordReload(ctx, err)
+	if err != nil {
+		o.Err(ctx, "app reload", err)
+	}
+}
+
+// startApp runs PreRun, Start, module Start, and Warmup.
+// cleanup undoes the starts in reverse order,
+// and is always safe to call.
+func startApp(ctx context.Context, o *observability.O, c Config, h *basehttp.HTTP) (runnables []func(context.Context) error, moduleOs []*observability.O, cleanup func(), err error) {
+	var cleanups []func()
+	cleanup = func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}
+
+	if c.PreRun != nil {
+		err := c.PreRun(ctx, o)
+		if err != nil {
+			return nil, nil, cleanup, o.Err(ctx, "app pre run", err)
+		}
+	}
+
+	switch {
+	case c.Start != nil && c.StartRunnables != nil:
+		return nil, nil, cleanup, o.Err(ctx, "app start", errors.New("only one of Start and StartRunnables may be set"))
+	case c.Start != nil:
+		t0 := time.Now()
+		var appCleanup func()
+		err := protect(ctx, o, "start", func() error {
+			var err error
+			appCleanup, err = c.Start(ctx, o, h.Mux)
+			return err
+		})
+		o.RecordPhase(ctx, "start", time.Since(t0))
+		if err != nil {
+			return nil, nil, cleanup, o.Err(ctx, "app start", err)
+		}
+		if appCleanup != nil {
+			cleanups = append(cleanups, appCleanup)
+		}
+	case c.StartRunnables != nil:
+		t0 := time.Now()
+		var run []func(context.Context) error
+		var appCleanup func()
+		err := protect(ctx, o, "start", func() error {
+			var err error
+			run, appCleanup, err = c.StartRunnables(ctx, o, h.Mux)
+			return err
+		})
+		o.RecordPhase(ctx, "start", time.Since(t0))
+		if err != nil {
+			return nil, nil, cleanup, o.Err(ctx, "app start", err)
+		}
+		if appCleanup != nil {
+			cleanups = append(cleanups, appCleanup)
+		}
+		runnables = run
+	}
+
+	moduleOs = make([]*observability.O, len(c.Modules))
+	for i, m := range c.Modules {
+		moduleOs[i] = o.Component(m.Name)
+		if m.Start == nil {
+			continue
+		}
+		var appCleanup func()
+		err := protect(ctx, moduleOs[i], "start", func() error {
+			var err error
+			appCleanup, err = m.Start(ctx, moduleOs[i], h.Mux)
+			return err
+		})
+		if err != nil {
+			return nil, nil, cleanup, o.Err(ctx, "module start", err, slog.String("module", m.Name))
+		}
+		if appCleanup != nil {
+			cleanups = append(cleanups, appCleanup)
+		}
+	}
+
+	if len(c.Warmup) > 0 {
+		t0 := time.Now()
+		warmups, wctx := errgroup.WithContext(ctx)
+		for _, warmup := range c.Warmup {
+			warmups.Go(func() error {
+				return protect(wctx, o, "warmup", func() error { return warmup(wctx, o) })
+			})
+		}
+		err := warmups.Wait()
+		o.RecordPhase(ctx, "warmup", time.Since(t0))
+		if err != nil {
+			return nil, nil, cleanup, o.Err(ctx, "app warmup", err)
+		}
+	}
+	return runnables, moduleOs, cleanup, nil
+}
 
-		err := h.Run(ctx)
+// run starts the application and runs it until ctx is canceled,
+// calling shutdown if any part fails.
+func run(ctx context.Context, o *observability.O, c Config, hconf *basehttp.Config, gconf *basegrpc.Config, shutdown func()) (err error) {
+	var serving atomic.Bool
+	defer func() {
+		if err != nil && !serving.Load() {
+			err = startupError{err}
+		}
+	}()
+
+	h := basehttp.New(ctx, o, hconf)
+	ctx = withReadiness(ctx, h.Readiness)
+
+	runnables, moduleOs, cleanup, err := startApp(ctx, o, c, h)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	group, ctx := errgroup.WithContext(ctx)
+	// collect all errors, not just the first
+	var errsMu sync.Mutex
+	var errs []error
+	goRun := func(f func() error) {
+		group.Go(func() error {
+			err := f()
+			if err != nil {
+				errsMu.Lock()
+				errs = append(errs, err)
+				errsMu.Unlock()
+			}
+			return err
+		})
+	}
+	// errors from any part start the shutdown
+	context.AfterFunc(ctx, shutdown)
+	if c.StartGRPC != nil {
+		g := basegrpc.New(ctx, o, gconf)
+		t0 := time.Now()
+		err := c.StartGRPC(ctx, o, g.Server)
+		o.RecordPhase(ctx, "start_grpc", time.Since(t0))
 		if err != nil {
-			return o.Err(ctx, "app run", err)
+			return o.Err(ctx, "app start grpc", err)
+		}
+		if gconf.Address == "" {
+			g.Mount(ctx, h.Mux)
+		} else {
+			goRun(func() error { return g.Run(ctx) })
+		}
+	}
+	if c.PreServe != nil {
+		h.PreServe = func(ctx context.Context, lis net.Listener) error {
+			return c.PreServe(ctx, o, lis)
+		}
+	}
+	h.PostListen = func(ctx context.Context) error {
+		if c.PostStart != nil {
+			err := c.PostStart(ctx, o)
+			if err != nil {
+				return fmt.Errorf("app post start: %w", err)
+			}
 		}
+		serving.Store(true)
 		return nil
+	}
+	var shutdownDone []chan struct{}
+	defer func() {
+		for _, done := range shutdownDone {
+			<-done
+		}
 	}()
+	onShutdown := func(f func(context.Context, *observability.O), o *observability.O) {
+		done := make(chan struct{})
+		shutdownDone = append(shutdownDone, done)
+		context.AfterFunc(ctx, func() {
+			defer close(done)
+			f(context.WithoutCancel(ctx), o)
+		})
+	}
+	if c.OnShutdown != nil {
+		onShutdown(c.OnShutdown, o)
+	}
+	for i, m := range c.Modules {
+		if m.OnShutdown != nil {
+			onShutdown(m.OnShutdown, moduleOs[i])
+		}
+	}
+	for _, worker := range c.Workers {
+		goRun(func() error {
+			return protect(ctx, o, "worker", func() error { return worker(ctx, o) })
+		})
+	}
+	for i, m := range c.Modules {
+		for _, worker := range m.Workers {
+			goRun(func() error {
+				return protect(ctx, moduleOs[i], "worker", func() error { return worker(ctx, moduleOs[i]) })
+			})
+		}
+	}
+	for _, runnable := range runnables {
+		goRun(func() error {
+			return protect(ctx, o, "runnable", func() error { return runnable(ctx) })
+		})
+	}
+	if len(c.Reload) > 0 {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		goRun(func() error {
+			defer signal.Stop(hup)
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-hup:
+					reload(ctx, o, c.Reload)
+				}
+			}
+		})
+	}
+	goRun(func() error { return h.Run(ctx) })
+
+	group.Wait()
+	err = errors.Join(errs...)
 	if err != nil {
-		o.Err(ctx, "exiting with error", err)
-		os.Exit(1)
+		return o.Err(ctx, "app run", err)
 	}
+	return nil
 }
@@ -0,0 +1,360 @@
+package framework
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+func TestRunE(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var started, workerDone, shutdown atomic.Bool
+	err := RunE(ctx, Config{
+		Args:   []string{"-http.addr=127.0.0.1:0", "-metrics.format=prometheus"},
+		Stdout: io.Discard,
+		Stderr: io.Discard,
+		Start: func(ctx context.Context, o *observability.O, mux *http.ServeMux) (func(), error) {
+			started.Store(true)
+			return nil, nil
+		},
+		Workers: []func(context.Context, *observability.O) error{
+			func(ctx context.Context, o *observability.O) error {
+				<-ctx.Done()
+				workerDone.Store(true)
+				return nil
+			},
+		},
+		PostStart: func(ctx context.Context, o *observability.O) error {
+			cancel()
+			return nil
+		},
+		OnShutdown: func(ctx context.Context, o *observability.O) {
+			shutdown.Store(true)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !started.Load() || !workerDone.Load() || !shutdown.Load() {
+		t.Errorf("started = %v, worker done = %v, shutdown = %v", started.Load(), workerDone.Load(), shutdown.Load())
+	}
+}
+
+func TestRunEArgs(t *testing.T) {
+	t.Parallel()
+
+	tcs := []struct {
+		name      string
+		args      []string
+		wantHelp  bool
+		wantUsage bool
+	}{
+		{"help", []string{"-h"}, true, false},
+		{"unknown flag", []string{"-no.such.flag"}, false, true},
+		{"extra args", []string{"serve", "extra"}, false, true},
+		{"unknown command", []string{"migrate"}, false, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := RunE(context.Background(), Config{
+				Args:   tc.args,
+				Stdout: io.Discard,
+				Stderr: io.Discard,
+			})
+			if got := errors.Is(err, flag.ErrHelp); got != tc.wantHelp {
+				t.Errorf("help = %v, want %v: %v", got, tc.wantHelp, err)
+			}
+			if got := errors.As(err, new(usageError)); got != tc.wantUsage {
+				t.Errorf("usage error = %v, want %v: %v", got, tc.wantUsage, err)
+			}
+		})
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stuck := make(chan struct{})
+	defer close(stuck)
+	err := RunE(ctx, Config{
+		Args:   []string{"-http.addr=127.0.0.1:0", "-metrics.format=prometheus", "-shutdown.timeout=100ms"},
+		Stdout: io.Discard,
+		Stderr: io.Discard,
+		Workers: []func(context.Context, *observability.O) error{
+			func(ctx context.Context, o *observability.O) error {
+				<-stuck
+				return nil
+			},
+		},
+		PostStart: func(ctx context.Context, o *observability.O) error {
+			cancel()
+			return nil
+		},
+	})
+	if !errors.Is(err, ErrShutdownTimeout) {
+		t.Errorf("err = %v, want %v", err, ErrShutdownTimeout)
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	t.Parallel()
+
+	t.Run("before serving", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var warm atomic.Bool
+		err := RunE(ctx, Config{
+			Args:   []string{"-http.addr=127.0.0.1:0", "-metrics.format=prometheus"},
+			Stdout: io.Discard,
+			Stderr: io.Discard,
+			Warmup: []func(context.Context, *observability.O) error{
+				func(ctx context.Context, o *observability.O) error {
+					warm.Store(true)
+					return nil
+				},
+			},
+			PostStart: func(ctx context.Context, o *observability.O) error {
+				defer cancel()
+				if !warm.Load() {
+					return errors.New("serving before warmup")
+				}
+				return nil
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+
+		errWarmup := errors.New("cache unavailable")
+		err := RunE(context.Background(), Config{
+			Args:   []string{"-http.addr=127.0.0.1:0", "-metrics.format=prometheus"},
+			Stdout: io.Discard,
+			Stderr: io.Discard,
+			Warmup: []func(context.Context, *observability.O) error{
+				func(ctx context.Context, o *observability.O) error {
+					return errWarmup
+				},
+			},
+		})
+		if !errors.Is(err, errWarmup) {
+			t.Errorf("err = %v, want %v", err, errWarmup)
+		}
+	})
+}
+
+func TestReadiness(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := RunE(ctx, Config{
+		Args:   []string{"-http.addr=127.0.0.1:0", "-metrics.format=prometheus"},
+		Stdout: io.Discard,
+		Stderr: io.Discard,
+		Start: func(ctx context.Context, o *observability.O, mux *http.ServeMux) (func(), error) {
+			Readiness(ctx).Unset("migrations", "pending")
+			return nil, nil
+		},
+		PostStart: func(ctx context.Context, o *observability.O) error {
+			defer cancel()
+			r := Readiness(ctx)
+			if r.Check(ctx) == nil {
+				return errors.New("ready with pending migrations")
+			}
+			r.Set("migrations")
+			return r.Check(ctx)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var reloaded atomic.Int32
+	err := RunE(ctx, Config{
+		Args:   []string{"-http.addr=127.0.0.1:0", "-metrics.format=prometheus"},
+		Stdout: io.Discard,
+		Stderr: io.Discard,
+		Reload: []func(context.Context, *observability.O) error{
+			func(ctx context.Context, o *observability.O) error {
+				reloaded.Add(1)
+				return errors.New("bad config")
+			},
+			func(ctx context.Context, o *observability.O) error {
+				reloaded.Add(1)
+				cancel()
+				return nil
+			},
+		},
+		PostStart: func(ctx context.Context, o *observability.O) error {
+			return syscall.Kill(os.Getpid(), syscall.SIGHUP)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.Load(); got != 2 {
+		t.Errorf("reloaded = %d, want 2", got)
+	}
+}
+
+func TestStartRunnables(t *testing.T) {
+	t.Parallel()
+
+	errLoop := errors.New("loop failed")
+	errDrain := errors.New("drain failed")
+	var cleanedUp atomic.Bool
+	err := RunE(context.Background(), Config{
+		Args:   []string{"-http.addr=127.0.0.1:0", "-metrics.format=prometheus"},
+		Stdout: io.Discard,
+		Stderr: io.Discard,
+		StartRunnables: func(ctx context.Context, o *observability.O, mux *http.ServeMux) ([]func(context.Context) error, func(), error) {
+			run := []func(context.Context) error{
+				func(ctx context.Context) error {
+					return errLoop
+				},
+				func(ctx context.Context) error {
+					<-ctx.Done()
+					return errDrain
+				},
+			}
+			return run, func() { cleanedUp.Store(true) }, nil
+		},
+	})
+	if !errors.Is(err, errLoop) || !errors.Is(err, errDrain) {
+		t.Errorf("err = %v, want both %v and %v", err, errLoop, errDrain)
+	}
+	if !cleanedUp.Load() {
+		t.Errorf("cleanup not called")
+	}
+}
+
+func TestModules(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var greeting string
+	var workerDone, shutdown atomic.Bool
+	err := RunE(ctx, Config{
+		Args:   []string{"-http.addr=127.0.0.1:0", "-metrics.format=prometheus", "-greeter.greeting=hi"},
+		Stdout: io.Discard,
+		Stderr: io.Discard,
+		Modules: []Module{{
+			Name: "greeter",
+			RegisterFlags: func(fset *flag.FlagSet) {
+				fset.StringVar(&greeting, "greeter.greeting", "hello", "greeting")
+			},
+			Start: func(ctx context.Context, o *observability.O, mux *http.ServeMux) (func(), error) {
+				if greeting != "hi" {
+					return nil, errors.New("flags not parsed before start")
+				}
+				return nil, nil
+			},
+			Workers: []func(context.Context, *observability.O) error{
+				func(ctx context.Context, o *observability.O) error {
+					<-ctx.Done()
+					workerDone.Store(true)
+					return nil
+				},
+			},
+			OnShutdown: func(ctx context.Context, o *observability.O) {
+				shutdown.Store(true)
+			},
+		}},
+		PostStart: func(ctx context.Context, o *observability.O) error {
+			cancel()
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !workerDone.Load() || !shutdown.Load() {
+		t.Errorf("worker done = %v, shutdown = %v", workerDone.Load(), shutdown.Load())
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	t.Parallel()
+
+	errApp := errors.New("app failed")
+	args := []string{"-http.addr=127.0.0.1:0", "-metrics.format=prometheus"}
+	serving := func() Config {
+		started := make(chan struct{})
+		return Config{
+			Args: args,
+			Workers: []func(context.Context, *observability.O) error{
+				func(ctx context.Context, o *observability.O) error {
+					<-started
+					return errApp
+				},
+			},
+			PostStart: func(ctx context.Context, o *observability.O) error {
+				close(started)
+				return nil
+			},
+		}
+	}
+	tcs := []struct {
+		name string
+		c    Config
+		want int
+	}{
+		{"help", Config{Args: []string{"-h"}}, ExitOK},
+		{"usage", Config{Args: []string{"-no.such.flag"}}, ExitUsage},
+		{"startup", Config{
+			Args: args,
+			Start: func(ctx context.Context, o *observability.O, mux *http.ServeMux) (func(), error) {
+				return nil, errApp
+			},
+		}, ExitStartup},
+		{"post start", Config{
+			Args: args,
+			PostStart: func(ctx context.Context, o *observability.O) error {
+				return errApp
+			},
+		}, ExitStartup},
+		{"serving", serving(), ExitError},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tc.c.Stdout = io.Discard
+			tc.c.Stderr = io.Discard
+			err := RunE(context.Background(), tc.c)
+			if got := ExitCode(err); got != tc.want {
+				t.Errorf("exit code = %d, want %d: %v", got, tc.want, err)
+			}
+		})
+	}
+}
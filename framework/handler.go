@@ -0,0 +1,99 @@
+package framework
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.seankhliao.com/svcrunner/v3/basegrpc"
+	"go.seankhliao.com/svcrunner/v3/basehttp"
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+// Handler builds the application as serve would,
+// parsing flags from c.Args and environment variables,
+// setting up observability, and running PreRun, Start, modules, and Warmup,
+// but returns the http handler with the basehttp middleware
+// instead of listening,
+// for serverless adapters or mounting inside another server.
+// grpc services from StartGRPC are mounted on the handler.
+//
+// Workers, runnables, Reload, PreServe, and PostStart are not run,
+// the caller owns the server lifecycle.
+// ctx is passed to the application and should be canceled at shutdown.
+// shutdown calls OnShutdown, the cleanups from Start, and flushes telemetry.
+func Handler(ctx context.Context, c Config) (handler http.Handler, shutdown func(context.Context) error, err error) {
+	e := newCmdEnv(c)
+	fset := e.flagSet("handler", c)
+	oconf := &observability.Config{}
+	oconf.SetFlags(fset)
+	hconf := e.httpFlags(fset)
+	if c.RegisterFlags != nil {
+		c.RegisterFlags(fset)
+	}
+	for _, m := range c.Modules {
+		if m.RegisterFlags != nil {
+			m.RegisterFlags(fset)
+		}
+	}
+	err = e.parse(ctx, fset)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(fset.Args()) > 0 {
+		err := fmt.Errorf("unexpected arguments: %v", fset.Args())
+		fmt.Fprintln(e.stderr, err)
+		return nil, nil, usageError{err}
+	}
+	if oconf.LogOutput == nil {
+		oconf.LogOutput = e.stdout
+	}
+	if c.Observability != nil {
+		c.Observability(oconf)
+	}
+
+	t0 := time.Now()
+	o := observability.New(oconf)
+	o.RecordPhase(ctx, "config", time.Since(t0))
+	o.L.LogAttrs(ctx, slog.LevelInfo, "starting application handler",
+		slog.Any("build", observability.ReadBuildInfo()),
+	)
+
+	h := basehttp.New(ctx, o, hconf)
+	err = h.Init(ctx)
+	if err != nil {
+		return nil, nil, startupError{err}
+	}
+	ctx = withReadiness(ctx, h.Readiness)
+	_, moduleOs, cleanup, err := startApp(ctx, o, c, h)
+	if err != nil {
+		cleanup()
+		return nil, nil, startupError{err}
+	}
+	if c.StartGRPC != nil {
+		g := basegrpc.New(ctx, o, &basegrpc.Config{})
+		err := c.StartGRPC(ctx, o, g.Server)
+		if err != nil {
+			cleanup()
+			return nil, nil, startupError{o.Err(ctx, "app start grpc", err)}
+		}
+		g.Mount(ctx, h.Mux)
+	}
+
+	shutdown = func(sctx context.Context) error {
+		h.Readiness.Unset("shutdown", "shutting down")
+		if c.OnShutdown != nil {
+			c.OnShutdown(sctx, o)
+		}
+		for i, m := range c.Modules {
+			if m.OnShutdown != nil {
+				m.OnShutdown(sctx, moduleOs[i])
+			}
+		}
+		cleanup()
+		return o.Shutdown(sctx)
+	}
+	return h.Server.Handler, shutdown, nil
+}
@@ -0,0 +1,91 @@
+package framework
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var cleanedUp, shutdown bool
+	handler, stop, err := Handler(ctx, Config{
+		Args:   []string{"-metrics.format=prometheus"},
+		Stdout: io.Discard,
+		Stderr: io.Discard,
+		Start: func(ctx context.Context, o *observability.O, mux *http.ServeMux) (func(), error) {
+			mux.HandleFunc("GET /hello", func(rw http.ResponseWriter, r *http.Request) {
+				io.WriteString(rw, "hello")
+			})
+			return func() { cleanedUp = true }, nil
+		},
+		OnShutdown: func(ctx context.Context, o *observability.O) {
+			shutdown = true
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hello", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Errorf("GET /hello = %d %q, want 200 hello", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /readyz = %d, want 200", rec.Code)
+	}
+
+	err = stop(context.Background())
+	if err != nil {
+		t.Errorf("shutdown: %v", err)
+	}
+	if !cleanedUp || !shutdown {
+		t.Errorf("cleaned up = %v, shutdown = %v", cleanedUp, shutdown)
+	}
+}
+
+func TestHandlerMaintenancePage(t *testing.T) {
+	t.Parallel()
+
+	page := filepath.Join(t.TempDir(), "maintenance.html")
+	err := os.WriteFile(page, []byte("back soon"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, stop, err := Handler(context.Background(), Config{
+		Args:   []string{"-http.maintenance", "-http.maintenance-page=" + page},
+		Stdout: io.Discard,
+		Stderr: io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop(context.Background())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Body.String() != "back soon" {
+		t.Errorf("GET / = %d %q, want 503 back soon", rec.Code, rec.Body.String())
+	}
+
+	_, _, err = Handler(context.Background(), Config{
+		Args:   []string{"-http.maintenance-page=" + filepath.Join(t.TempDir(), "missing.html")},
+		Stdout: io.Discard,
+		Stderr: io.Discard,
+	})
+	if err == nil {
+		t.Errorf("expected error for missing maintenance page")
+	}
+}
@@ -0,0 +1,26 @@
+package framework
+
+import (
+	"context"
+	"flag"
+	"net/http"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+// Module is a reusable part of an application,
+// run alongside Config.Start with the same lifecycle.
+// Its functions receive an observability Component named after the module.
+type Module struct {
+	Name string
+	// RegisterFlags registers flags for the module,
+	// conventionally prefixed with the module name, as in name.flag.
+	RegisterFlags func(*flag.FlagSet)
+	// Start registers routes on the shared mux,
+	// called in order after Config.Start.
+	Start func(context.Context, *observability.O, *http.ServeMux) (cleanup func(), err error)
+	// Workers run alongside the servers, as Config.Workers.
+	Workers []func(context.Context, *observability.O) error
+	// OnShutdown is called when shutdown begins, as Config.OnShutdown.
+	OnShutdown func(context.Context, *observability.O)
+}
@@ -0,0 +1,48 @@
+package framework
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+// PanicError is a panic recovered from an application function,
+// returned as an error to shut down the application gracefully.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// protect calls f, converting a panic into a PanicError,
+// logged with its stack and recorded on the span in ctx.
+func protect(ctx context.Context, o *observability.O, name string, f func() error) (err error) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		perr := &PanicError{Value: v, Stack: debug.Stack()}
+		o.L.LogAttrs(ctx, slog.LevelError, "recovered panic",
+			slog.String("func", name),
+			slog.String("panic", fmt.Sprint(v)),
+			slog.String("stack", string(perr.Stack)),
+		)
+		if span := trace.SpanFromContext(ctx); span.SpanContext().IsValid() {
+			span.RecordError(perr, trace.WithAttributes(
+				attribute.String("func", name),
+				attribute.String("exception.stacktrace", string(perr.Stack)),
+			))
+		}
+		err = perr
+	}()
+	return f()
+}
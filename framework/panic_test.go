@@ -0,0 +1,61 @@
+package framework
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+func TestPanic(t *testing.T) {
+	t.Parallel()
+
+	args := []string{"-http.addr=127.0.0.1:0", "-metrics.format=prometheus"}
+
+	t.Run("start", func(t *testing.T) {
+		t.Parallel()
+
+		err := RunE(context.Background(), Config{
+			Args:   args,
+			Stdout: io.Discard,
+			Stderr: io.Discard,
+			Start: func(ctx context.Context, o *observability.O, mux *http.ServeMux) (func(), error) {
+				panic("bad start")
+			},
+		})
+		var perr *PanicError
+		if !errors.As(err, &perr) || perr.Value != "bad start" {
+			t.Errorf("err = %v, want panic bad start", err)
+		}
+	})
+
+	t.Run("worker", func(t *testing.T) {
+		t.Parallel()
+
+		var cleanedUp atomic.Bool
+		err := RunE(context.Background(), Config{
+			Args:   args,
+			Stdout: io.Discard,
+			Stderr: io.Discard,
+			Start: func(ctx context.Context, o *observability.O, mux *http.ServeMux) (func(), error) {
+				return func() { cleanedUp.Store(true) }, nil
+			},
+			Workers: []func(context.Context, *observability.O) error{
+				func(ctx context.Context, o *observability.O) error {
+					panic("bad worker")
+				},
+			},
+		})
+		var perr *PanicError
+		if !errors.As(err, &perr) || len(perr.Stack) == 0 {
+			t.Errorf("err = %v, want panic with stack", err)
+		}
+		if !cleanedUp.Load() {
+			t.Errorf("cleanup not called after panic")
+		}
+	})
+}
@@ -0,0 +1,23 @@
+package framework
+
+import (
+	"context"
+
+	"go.seankhliao.com/svcrunner/v3/basehttp"
+)
+
+type readinessKey struct{}
+
+// Readiness returns the readiness state of the application
+// from the context passed to Start and the other Config functions,
+// or nil outside of Run.
+// Conditions unset with a reason fail /readyz until they are set again,
+// and the application reports as not ready once shutdown begins.
+func Readiness(ctx context.Context) *basehttp.Readiness {
+	r, _ := ctx.Value(readinessKey{}).(*basehttp.Readiness)
+	return r
+}
+
+func withReadiness(ctx context.Context, r *basehttp.Readiness) context.Context {
+	return context.WithValue(ctx, readinessKey{}, r)
+}
@@ -0,0 +1,156 @@
+// Package frameworktest runs applications built with framework in process,
+// for black box tests over http.
+package frameworktest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.seankhliao.com/svcrunner/v3/framework"
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+// App is an application running in process.
+type App struct {
+	// URL is the base url of the http server, such as http://127.0.0.1:12345.
+	URL string
+	// Spans records all ended spans.
+	Spans *tracetest.InMemoryExporter
+	// Metrics collects metrics on demand.
+	Metrics *metric.ManualReader
+
+	logs     *syncBuffer
+	cancel   context.CancelFunc
+	done     chan struct{}
+	err      error
+	shutdown sync.Once
+	stopErr  error
+}
+
+// Start runs the serve command of the application,
+// returning once it is listening.
+// c.Args are additional flags, applied after flags to listen on a random port.
+// Environment variables are ignored unless c.LookupEnv is set.
+// The application is shut down at the end of the test.
+//
+// Telemetry is recorded through the global otel providers,
+// applications started concurrently may see each other's spans and metrics.
+func Start(t testing.TB, c framework.Config) *App {
+	t.Helper()
+
+	a := &App{
+		Spans:   tracetest.NewInMemoryExporter(),
+		Metrics: metric.NewManualReader(),
+		logs:    &syncBuffer{},
+		done:    make(chan struct{}),
+	}
+
+	c.Args = append([]string{"serve", "-http.addr=127.0.0.1:0"}, c.Args...)
+	if c.LookupEnv == nil {
+		c.LookupEnv = func(string) (string, bool) { return "", false }
+	}
+	c.Stdout = a.logs
+	c.Stderr = a.logs
+
+	configureObservability := c.Observability
+	c.Observability = func(oc *observability.Config) {
+		oc.SpanExporter = a.Spans
+		oc.MetricReader = a.Metrics
+		if configureObservability != nil {
+			configureObservability(oc)
+		}
+	}
+
+	var addr net.Addr
+	preServe := c.PreServe
+	c.PreServe = func(ctx context.Context, o *observability.O, lis net.Listener) error {
+		if addr == nil {
+			addr = lis.Addr()
+		}
+		if preServe != nil {
+			return preServe(ctx, o, lis)
+		}
+		return nil
+	}
+	ready := make(chan struct{})
+	postStart := c.PostStart
+	c.PostStart = func(ctx context.Context, o *observability.O) error {
+		if postStart != nil {
+			err := postStart(ctx, o)
+			if err != nil {
+				return err
+			}
+		}
+		close(ready)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+	go func() {
+		defer close(a.done)
+		a.err = framework.RunE(ctx, c)
+	}()
+
+	select {
+	case <-ready:
+	case <-a.done:
+		cancel()
+		t.Fatalf("application exited before serving: %v\n%s", a.err, a.Logs())
+	}
+	a.URL = "http://" + addr.String()
+
+	t.Cleanup(func() {
+		err := a.Shutdown()
+		if err != nil {
+			t.Errorf("shutdown application: %v\n%s", err, a.Logs())
+		}
+	})
+	return a
+}
+
+// Shutdown gracefully shuts down the application,
+// returning the error it exited with.
+// It is safe to call multiple times.
+func (a *App) Shutdown() error {
+	a.shutdown.Do(func() {
+		a.cancel()
+		select {
+		case <-a.done:
+			a.stopErr = a.err
+		case <-time.After(time.Minute):
+			a.stopErr = errors.New("timed out waiting for shutdown")
+		}
+	})
+	return a.stopErr
+}
+
+// Logs returns the logs written by the application so far.
+func (a *App) Logs() string {
+	return a.logs.String()
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,61 @@
+package frameworktest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.seankhliao.com/svcrunner/v3/framework"
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+func TestStart(t *testing.T) {
+	app := Start(t, framework.Config{
+		Start: func(ctx context.Context, o *observability.O, mux *http.ServeMux) (func(), error) {
+			mux.HandleFunc("GET /hello", func(rw http.ResponseWriter, r *http.Request) {
+				_, span := o.T.Start(r.Context(), "hello")
+				defer span.End()
+				o.L.InfoContext(r.Context(), "saying hello")
+				io.WriteString(rw, "hello")
+			})
+			return nil, nil
+		},
+	})
+
+	res, err := http.Get(app.URL + "/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "hello" {
+		t.Errorf("body = %q, want hello", body)
+	}
+
+	if !strings.Contains(app.Logs(), "saying hello") {
+		t.Errorf("logs missing handler message:\n%s", app.Logs())
+	}
+	var found bool
+	for _, span := range app.Spans.GetSpans() {
+		found = found || span.Name == "hello"
+	}
+	if !found {
+		t.Errorf("no span named hello in %d spans", len(app.Spans.GetSpans()))
+	}
+	var rm metricdata.ResourceMetrics
+	err = app.Metrics.Collect(context.Background(), &rm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rm.ScopeMetrics) == 0 {
+		t.Errorf("no metrics collected")
+	}
+
+	err = app.Shutdown()
+	if err != nil {
+		t.Errorf("shutdown: %v", err)
+	}
+}
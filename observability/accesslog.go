@@ -0,0 +1,76 @@
+package observability
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// AccessLog logs one record per request handled by h.
+// Trace ids are added by the log handler from the request context.
+func (o *O) AccessLog(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		extra := &accessLogAttrs{}
+		r = r.WithContext(context.WithValue(r.Context(), accessLogAttrsKey{}, extra))
+		m := httpsnoop.CaptureMetrics(h, rw, r)
+
+		// prefer the route tagged by the handler,
+		// r.Pattern is lost if middleware replaced the request
+		route := r.Pattern
+		if labeler, ok := otelhttp.LabelerFromContext(r.Context()); ok {
+			for _, attr := range labeler.Get() {
+				if attr.Key == "http.route" {
+					route = attr.Value.AsString()
+				}
+			}
+		}
+
+		clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			clientIP = r.RemoteAddr
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", m.Code),
+			slog.Int64("bytes", m.Written),
+			slog.Duration("latency", m.Duration.Round(time.Microsecond)),
+			slog.String("client_ip", clientIP),
+			slog.String("user_agent", r.UserAgent()),
+		}
+		o.L.LogAttrs(r.Context(), slog.LevelInfo, "http request", append(attrs, extra.get()...)...)
+	})
+}
+
+type accessLogAttrsKey struct{}
+
+type accessLogAttrs struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+func (a *accessLogAttrs) get() []slog.Attr {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.attrs
+}
+
+// AddAccessLogAttrs adds attrs to the access log record of the request ctx belongs to,
+// such as the identity of an authenticated client.
+// It does nothing if the request isn't access logged.
+func AddAccessLogAttrs(ctx context.Context, attrs ...slog.Attr) {
+	a, ok := ctx.Value(accessLogAttrsKey{}).(*accessLogAttrs)
+	if !ok {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.attrs = append(a.attrs, attrs...)
+}
@@ -0,0 +1,209 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Alert is an error record forwarded to an AlertSink.
+type Alert struct {
+	Time    time.Time
+	Message string
+	Attrs   []slog.Attr
+	TraceID string
+	// Suppressed is the number of alerts dropped by rate limiting
+	// since the previous alert.
+	Suppressed int
+}
+
+// Text formats the alert for chat messages.
+func (a Alert) Text(traceURL string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s", a.Time.Format(time.RFC3339), a.Message)
+	for _, attr := range a.Attrs {
+		fmt.Fprintf(&b, "\n%s", attr)
+	}
+	if a.TraceID != "" {
+		if traceURL != "" {
+			fmt.Fprintf(&b, "\ntrace: "+traceURL, a.TraceID)
+		} else {
+			fmt.Fprintf(&b, "\ntrace_id: %s", a.TraceID)
+		}
+	}
+	if a.Suppressed > 0 {
+		fmt.Fprintf(&b, "\n(%d more alerts suppressed)", a.Suppressed)
+	}
+	return b.String()
+}
+
+// AlertSink receives error level log records.
+type AlertSink interface {
+	Alert(ctx context.Context, a Alert) error
+}
+
+// GChatSink posts alerts to a Google Chat incoming webhook.
+type GChatSink struct {
+	URL string
+	// TraceURL is a format string taking the trace id, used to link to traces.
+	TraceURL string
+	Client   *http.Client
+}
+
+func (s *GChatSink) Alert(ctx context.Context, a Alert) error {
+	return postJSON(ctx, s.Client, s.URL, map[string]string{"text": a.Text(s.TraceURL)})
+}
+
+// WebhookSink posts alerts as JSON to a generic webhook.
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s *WebhookSink) Alert(ctx context.Context, a Alert) error {
+	attrs := make(map[string]string, len(a.Attrs))
+	for _, attr := range a.Attrs {
+		attrs[attr.Key] = attr.Value.String()
+	}
+	return postJSON(ctx, s.Client, s.URL, map[string]any{
+		"time":       a.Time,
+		"message":    a.Message,
+		"attrs":      attrs,
+		"trace_id":   a.TraceID,
+		"suppressed": a.Suppressed,
+	})
+}
+
+func postJSON(ctx context.Context, client *http.Client, u string, v any) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshal alert: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("create alert request: %w", err)
+	}
+	req.Header.Set("content-type", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send alert: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("send alert: unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+// alerter rate limits and asynchronously delivers alerts.
+type alerter struct {
+	sink     AlertSink
+	interval time.Duration
+	errLog   func(error)
+
+	mu         sync.Mutex
+	last       time.Time
+	suppressed int
+
+	// pending tracks alerts being delivered
+	pending sync.WaitGroup
+}
+
+func (a *alerter) send(ctx context.Context, al Alert) {
+	a.mu.Lock()
+	if !a.last.IsZero() && al.Time.Sub(a.last) < a.interval {
+		a.suppressed++
+		a.mu.Unlock()
+		return
+	}
+	a.last = al.Time
+	al.Suppressed, a.suppressed = a.suppressed, 0
+	a.mu.Unlock()
+
+	a.pending.Add(1)
+	go func() {
+		defer a.pending.Done()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		err := a.sink.Alert(ctx, al)
+		if err != nil {
+			a.errLog(err)
+		}
+	}()
+}
+
+// wait waits for pending alerts to be delivered,
+// such as one for the error an application exits with,
+// or until ctx is done.
+func (a *alerter) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		a.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("wait for pending alerts: %w", ctx.Err())
+	}
+}
+
+// alertHandler forwards error level records to an alerter.
+type alertHandler struct {
+	slog.Handler
+	alerter *alerter
+	attrs   []slog.Attr
+	group   string
+}
+
+func (h *alertHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelError {
+		al := Alert{
+			Time:    r.Time,
+			Message: r.Message,
+			Attrs:   append([]slog.Attr{}, h.attrs...),
+		}
+		r.Attrs(func(attr slog.Attr) bool {
+			if h.group != "" {
+				attr.Key = h.group + attr.Key
+			}
+			al.Attrs = append(al.Attrs, attr)
+			return true
+		})
+		if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+			al.TraceID = sc.TraceID().String()
+		}
+		h.alerter.send(ctx, al)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *alertHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.Handler = h.Handler.WithAttrs(attrs)
+	h2.attrs = append([]slog.Attr{}, h.attrs...)
+	for _, attr := range attrs {
+		attr.Key = h.group + attr.Key
+		h2.attrs = append(h2.attrs, attr)
+	}
+	return &h2
+}
+
+func (h *alertHandler) WithGroup(name string) slog.Handler {
+	h2 := *h
+	h2.Handler = h.Handler.WithGroup(name)
+	h2.group = h.group + name + "."
+	return &h2
+}
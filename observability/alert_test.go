@@ -0,0 +1,91 @@
+package observability
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+type chanSink chan Alert
+
+func (s chanSink) Alert(ctx context.Context, a Alert) error {
+	s <- a
+	return nil
+}
+
+func TestAlertHandler(t *testing.T) {
+	t.Parallel()
+
+	sink := make(chanSink, 10)
+	h := &alertHandler{
+		Handler: slog.NewTextHandler(io.Discard, nil),
+		alerter: &alerter{
+			sink:     sink,
+			interval: time.Hour,
+			errLog:   func(err error) { t.Error(err) },
+		},
+	}
+	lg := slog.New(h).WithGroup("g").With("a", 1)
+
+	ctx := context.Background()
+	lg.InfoContext(ctx, "not an alert")
+	lg.ErrorContext(ctx, "first", "b", 2)
+	lg.ErrorContext(ctx, "rate limited")
+
+	select {
+	case a := <-sink:
+		if a.Message != "first" {
+			t.Errorf("message = %q, want first", a.Message)
+		}
+		if len(a.Attrs) != 2 || a.Attrs[0].Key != "g.a" || a.Attrs[1].Key != "g.b" {
+			t.Errorf("attrs = %v, want [g.a g.b]", a.Attrs)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no alert sent")
+	}
+
+	select {
+	case a := <-sink:
+		t.Errorf("unexpected alert %q", a.Message)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if h.alerter.suppressed != 1 {
+		t.Errorf("suppressed = %d, want 1", h.alerter.suppressed)
+	}
+}
+
+// slowSink records alerts after a delay.
+type slowSink struct {
+	mu     sync.Mutex
+	alerts []string
+}
+
+func (s *slowSink) Alert(ctx context.Context, a Alert) error {
+	time.Sleep(100 * time.Millisecond)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alerts = append(s.alerts, a.Message)
+	return nil
+}
+
+func TestAlertShutdown(t *testing.T) {
+	t.Parallel()
+
+	sink := &slowSink{}
+	o := New(&Config{LogFormat: "json", LogOutput: io.Discard, AlertSink: sink})
+	ctx := context.Background()
+	o.L.LogAttrs(ctx, slog.LevelError, "exiting with error")
+
+	err := o.Shutdown(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.alerts) != 1 || sink.alerts[0] != "exiting with error" {
+		t.Errorf("alerts after shutdown = %v", sink.alerts)
+	}
+}
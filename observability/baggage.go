@@ -0,0 +1,79 @@
+package observability
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// SetBaggage returns a context with the baggage member key=value added,
+// to be propagated to downstream services.
+func (o *O) SetBaggage(ctx context.Context, key, value string) (context.Context, error) {
+	m, err := baggage.NewMemberRaw(key, value)
+	if err != nil {
+		return ctx, o.Err(ctx, "create baggage member", err, slog.String("key", key))
+	}
+	b, err := baggage.FromContext(ctx).SetMember(m)
+	if err != nil {
+		return ctx, o.Err(ctx, "set baggage member", err, slog.String("key", key))
+	}
+	return baggage.ContextWithBaggage(ctx, b), nil
+}
+
+// Baggage returns the value of the baggage member key in ctx,
+// or the empty string if it is not set.
+func (o *O) Baggage(ctx context.Context, key string) string {
+	return baggage.FromContext(ctx).Member(key).Value()
+}
+
+// withBaggage adds the selected baggage keys as log attributes.
+func (c *Config) withBaggage(h slog.Handler) slog.Handler {
+	if len(c.BaggageKeys) == 0 {
+		return h
+	}
+	return &baggageHandler{h, c.BaggageKeys}
+}
+
+type baggageHandler struct {
+	slog.Handler
+	keys []string
+}
+
+func (h *baggageHandler) Handle(ctx context.Context, r slog.Record) error {
+	b := baggage.FromContext(ctx)
+	for _, k := range h.keys {
+		if v := b.Member(k).Value(); v != "" {
+			r.AddAttrs(slog.String(k, v))
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *baggageHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &baggageHandler{h.Handler.WithAttrs(attrs), h.keys}
+}
+
+func (h *baggageHandler) WithGroup(name string) slog.Handler {
+	return &baggageHandler{h.Handler.WithGroup(name), h.keys}
+}
+
+// baggageSpanProcessor adds the selected baggage keys as span attributes.
+type baggageSpanProcessor struct {
+	keys []string
+}
+
+func (p baggageSpanProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	b := baggage.FromContext(ctx)
+	for _, k := range p.keys {
+		if v := b.Member(k).Value(); v != "" {
+			s.SetAttributes(attribute.String(k, v))
+		}
+	}
+}
+
+func (p baggageSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan)        {}
+func (p baggageSpanProcessor) Shutdown(ctx context.Context) error   { return nil }
+func (p baggageSpanProcessor) ForceFlush(ctx context.Context) error { return nil }
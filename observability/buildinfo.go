@@ -0,0 +1,71 @@
+package observability
+
+import (
+	"log/slog"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	Path      string `json:"path"`
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// ReadBuildInfo returns the module and vcs information embedded in the binary.
+func ReadBuildInfo() BuildInfo {
+	b := BuildInfo{
+		Path:      "unknown",
+		Version:   "unknown",
+		GoVersion: runtime.Version(),
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	b.Path = bi.Main.Path
+	b.Version = bi.Main.Version
+	for _, setting := range bi.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			b.Revision = setting.Value
+		case "vcs.time":
+			b.Time = setting.Value
+		case "vcs.modified":
+			b.Modified = setting.Value == "true"
+		}
+	}
+	return b
+}
+
+func (b BuildInfo) String() string {
+	parts := []string{b.Path, b.Version}
+	if b.Revision != "" {
+		rev := b.Revision
+		if b.Modified {
+			rev += "-dirty"
+		}
+		parts = append(parts, rev)
+	}
+	if b.Time != "" {
+		parts = append(parts, b.Time)
+	}
+	parts = append(parts, b.GoVersion)
+	return strings.Join(parts, " ")
+}
+
+func (b BuildInfo) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("path", b.Path),
+		slog.String("version", b.Version),
+		slog.String("revision", b.Revision),
+		slog.String("time", b.Time),
+		slog.Bool("modified", b.Modified),
+		slog.String("go_version", b.GoVersion),
+	)
+}
@@ -0,0 +1,38 @@
+package observability
+
+import (
+	"context"
+	"log/slog"
+)
+
+type ctxAttrsKey struct{}
+
+// WithLogAttrs returns a context carrying attrs,
+// added to every record logged with the context.
+func WithLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	prev, _ := ctx.Value(ctxAttrsKey{}).([]slog.Attr)
+	all := make([]slog.Attr, 0, len(prev)+len(attrs))
+	all = append(all, prev...)
+	all = append(all, attrs...)
+	return context.WithValue(ctx, ctxAttrsKey{}, all)
+}
+
+// ctxAttrsHandler adds attributes stored with WithLogAttrs.
+type ctxAttrsHandler struct {
+	slog.Handler
+}
+
+func (h *ctxAttrsHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(ctxAttrsKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *ctxAttrsHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ctxAttrsHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *ctxAttrsHandler) WithGroup(name string) slog.Handler {
+	return &ctxAttrsHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,51 @@
+package observability
+
+import (
+	"encoding/json"
+	"expvar"
+	"io"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+)
+
+// RegisterDebug mounts pprof, expvar, build info (text or ?format=json), and runtime control endpoints under /debug/ on mux.
+func RegisterDebug(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/buildinfo", func(rw http.ResponseWriter, r *http.Request) {
+		if r.FormValue("format") == "json" {
+			rw.Header().Set("content-type", "application/json")
+			json.NewEncoder(rw).Encode(ReadBuildInfo())
+			return
+		}
+		bi, ok := debug.ReadBuildInfo()
+		if !ok {
+			http.Error(rw, "no build info", http.StatusNotFound)
+			return
+		}
+		rw.Header().Set("content-type", "text/plain; charset=utf-8")
+		io.WriteString(rw, bi.String())
+	})
+	mux.HandleFunc("/debug/gc", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		runtime.GC()
+		rw.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/debug/freeosmemory", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		debug.FreeOSMemory()
+		rw.WriteHeader(http.StatusNoContent)
+	})
+}
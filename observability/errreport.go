@@ -0,0 +1,71 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newSentry(dsn, name, release string) (*sentry.Hub, error) {
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		Dsn:              dsn,
+		Release:          release,
+		ServerName:       name,
+		AttachStacktrace: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sentry.NewHub(client, sentry.NewScope()), nil
+}
+
+// reportedErr marks errors returned by O.Err,
+// so an error passed up through several layers is only reported once.
+type reportedErr struct {
+	error
+}
+
+func (e *reportedErr) Unwrap() error {
+	return e.error
+}
+
+// reportErr sends an error to sentry, if configured,
+// unless it was already reported.
+func (o *O) reportErr(ctx context.Context, msg string, err error, attrs []slog.Attr) {
+	var reported *reportedErr
+	if o.sentry == nil || errors.As(err, &reported) {
+		return
+	}
+	hub := o.sentry.Clone()
+	hub.ConfigureScope(func(scope *sentry.Scope) {
+		if o.component != "" {
+			scope.SetTag("component", o.component)
+		}
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			scope.SetTag("trace_id", sc.TraceID().String())
+			scope.SetTag("span_id", sc.SpanID().String())
+		}
+		for _, attr := range attrs {
+			scope.SetExtra(attr.Key, attr.Value.String())
+		}
+	})
+	hub.CaptureException(fmt.Errorf("%s: %w", msg, err))
+}
+
+func flushSentry(hub *sentry.Hub) func(context.Context) error {
+	return func(ctx context.Context) error {
+		timeout := 5 * time.Second
+		if deadline, ok := ctx.Deadline(); ok {
+			timeout = time.Until(deadline)
+		}
+		if !hub.Flush(timeout) {
+			return fmt.Errorf("flush sentry: timed out")
+		}
+		return nil
+	}
+}
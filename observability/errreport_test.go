@@ -0,0 +1,81 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// fakeTransport records sentry events.
+type fakeTransport struct {
+	mu     sync.Mutex
+	events []*sentry.Event
+}
+
+func (f *fakeTransport) Flush(time.Duration) bool       { return true }
+func (f *fakeTransport) Configure(sentry.ClientOptions) {}
+func (f *fakeTransport) Close()                         {}
+func (f *fakeTransport) SendEvent(e *sentry.Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, e)
+}
+
+func TestReportErrOnce(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	o := New(&Config{LogFormat: "json", LogOutput: io.Discard})
+	transport := &fakeTransport{}
+	client, err := sentry.NewClient(sentry.ClientOptions{Transport: transport})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.sentry = sentry.NewHub(client, sentry.NewScope())
+
+	errBase := errors.New("connection refused")
+	err = o.Err(ctx, "listen locally", errBase)
+	err = o.Err(ctx, "exiting with error", fmt.Errorf("run: %w", err))
+	if !errors.Is(err, errBase) {
+		t.Errorf("returned error %v doesn't wrap %v", err, errBase)
+	}
+	if err.Error() != "exiting with error: run: listen locally: connection refused" {
+		t.Errorf("error = %q", err)
+	}
+
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	if len(transport.events) != 1 {
+		t.Errorf("reported %d events, want 1", len(transport.events))
+	}
+}
+
+func TestSentryDSNFromEnv(t *testing.T) {
+	t.Setenv("SENTRY_DSN", "https://secret@sentry.example/1")
+
+	var c Config
+	fset := flag.NewFlagSet("", flag.ContinueOnError)
+	c.SetFlags(fset)
+	usage := new(bytes.Buffer)
+	fset.SetOutput(usage)
+	fset.PrintDefaults()
+	if strings.Contains(usage.String(), "secret@sentry.example") {
+		t.Errorf("sentry dsn in usage:\n%s", usage)
+	}
+
+	c.LogFormat = "json"
+	c.LogOutput = io.Discard
+	o := New(&c)
+	if o.sentry == nil {
+		t.Errorf("sentry not configured from env")
+	}
+}
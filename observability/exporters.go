@@ -0,0 +1,141 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	cloudtrace "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/trace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/api/idtoken"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/oauth"
+)
+
+// grpc common
+const serviceConfig = `{"loadBalancingConfig":[{"round_robin":{}}]}`
+
+// Headers is a repeatable flag of key=value pairs.
+type Headers map[string]string
+
+func (h Headers) String() string {
+	var ss []string
+	for k, v := range h {
+		ss = append(ss, k+"="+v)
+	}
+	sort.Strings(ss)
+	return strings.Join(ss, ",")
+}
+
+func (h Headers) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("expected key=value: %q", s)
+	}
+	h[k] = v
+	return nil
+}
+
+// otlpCredentials returns per rpc credentials for authenticating to the collector,
+// or nil if none are configured.
+func (c *Config) otlpCredentials(ctx context.Context) (credentials.PerRPCCredentials, error) {
+	if c.OTLPAudience == "" {
+		return nil, nil
+	}
+	if c.OTLPProtocol != "grpc" {
+		return nil, errors.New("otlp.audience requires the grpc protocol")
+	}
+	ts, err := idtoken.NewTokenSource(ctx, c.OTLPAudience)
+	if err != nil {
+		return nil, fmt.Errorf("create id token source: %w", err)
+	}
+	return oauth.TokenSource{TokenSource: ts}, nil
+}
+
+func (c *Config) traceExporter(ctx context.Context, creds credentials.PerRPCCredentials) (sdktrace.SpanExporter, error) {
+	switch c.TraceExport {
+	case "cloudtrace":
+		return cloudtrace.New()
+	case "stdout":
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	}
+	switch c.OTLPProtocol {
+	case "http/protobuf":
+		var opts []otlptracehttp.Option
+		if len(c.OTLPHeaders) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(c.OTLPHeaders))
+		}
+		return otlptracehttp.New(ctx, opts...)
+	default:
+		opts := []otlptracegrpc.Option{
+			otlptracegrpc.WithServiceConfig(serviceConfig),
+		}
+		if len(c.OTLPHeaders) > 0 {
+			opts = append(opts, otlptracegrpc.WithHeaders(c.OTLPHeaders))
+		}
+		if creds != nil {
+			opts = append(opts, otlptracegrpc.WithDialOption(grpc.WithPerRPCCredentials(creds)))
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	}
+}
+
+func (c *Config) metricExporter(ctx context.Context, creds credentials.PerRPCCredentials) (sdkmetric.Exporter, error) {
+	if c.MetricsFormat == "stdout" {
+		return stdoutmetric.New(stdoutmetric.WithPrettyPrint())
+	}
+	switch c.OTLPProtocol {
+	case "http/protobuf":
+		var opts []otlpmetrichttp.Option
+		if len(c.OTLPHeaders) > 0 {
+			opts = append(opts, otlpmetrichttp.WithHeaders(c.OTLPHeaders))
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	default:
+		opts := []otlpmetricgrpc.Option{
+			otlpmetricgrpc.WithServiceConfig(serviceConfig),
+		}
+		if len(c.OTLPHeaders) > 0 {
+			opts = append(opts, otlpmetricgrpc.WithHeaders(c.OTLPHeaders))
+		}
+		if creds != nil {
+			opts = append(opts, otlpmetricgrpc.WithDialOption(grpc.WithPerRPCCredentials(creds)))
+		}
+		return otlpmetricgrpc.New(ctx, opts...)
+	}
+}
+
+func (c *Config) logExporter(ctx context.Context, creds credentials.PerRPCCredentials) (sdklog.Exporter, error) {
+	switch c.OTLPProtocol {
+	case "http/protobuf":
+		var opts []otlploghttp.Option
+		if len(c.OTLPHeaders) > 0 {
+			opts = append(opts, otlploghttp.WithHeaders(c.OTLPHeaders))
+		}
+		return otlploghttp.New(ctx, opts...)
+	default:
+		opts := []otlploggrpc.Option{
+			otlploggrpc.WithServiceConfig(serviceConfig),
+		}
+		if len(c.OTLPHeaders) > 0 {
+			opts = append(opts, otlploggrpc.WithHeaders(c.OTLPHeaders))
+		}
+		if creds != nil {
+			opts = append(opts, otlploggrpc.WithDialOption(grpc.WithPerRPCCredentials(creds)))
+		}
+		return otlploggrpc.New(ctx, opts...)
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"log/slog"
 	"net/http"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -18,11 +20,50 @@ func (o *O) Err(ctx context.Context, msg string, err error, attrs ...slog.Attr)
 		span.RecordError(err)
 		span.SetStatus(codes.Error, msg)
 	}
+	o.reportErr(ctx, msg, err, attrs)
+	if o.errCount != nil {
+		o.errCount.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("component", o.component),
+			attribute.String("msg", msg),
+		))
+	}
 
-	return fmt.Errorf("%s: %w", msg, err)
+	return &reportedErr{fmt.Errorf("%s: %w", msg, err)}
 }
 
 func (o *O) HTTPErr(ctx context.Context, msg string, err error, rw http.ResponseWriter, code int, attrs ...slog.Attr) {
-	err = o.Err(ctx, msg, err, attrs...)
-	http.Error(rw, err.Error(), code)
+	err = o.Err(ctx, msg, err, append(attrs, slog.Int("http.response.status_code", code))...)
+	if span := trace.SpanFromContext(ctx); span.SpanContext().IsValid() {
+		span.SetAttributes(attribute.Int("http.response.status_code", code))
+	}
+	if o.httpErrCount != nil {
+		o.httpErrCount.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("component", o.component),
+			attribute.Int("http.response.status_code", code),
+		))
+	}
+
+	body := err.Error()
+	if o.hideHTTPErr {
+		body = o.httpErrMsg
+		if body == "" {
+			body = http.StatusText(code)
+		}
+	}
+	http.Error(rw, body, code)
+}
+
+// Span starts a span on o.T, tagged with the component name.
+func (o *O) Span(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return o.T.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// Region is like Span, but returns a function to end the span,
+// for use as:
+//
+//	ctx, end := o.Region(ctx, "work")
+//	defer end()
+func (o *O) Region(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, func()) {
+	ctx, span := o.Span(ctx, name, attrs...)
+	return ctx, func() { span.End() }
 }
@@ -0,0 +1,175 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fanoutHandler sends records to all handlers that accept them.
+type fanoutHandler struct {
+	handlers []slog.Handler
+}
+
+func (h *fanoutHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	for _, hh := range h.handlers {
+		if hh.Enabled(ctx, l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, hh := range h.handlers {
+		if hh.Enabled(ctx, r.Level) {
+			errs = append(errs, hh.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make([]slog.Handler, 0, len(h.handlers))
+	for _, hh := range h.handlers {
+		handlers = append(handlers, hh.WithAttrs(attrs))
+	}
+	return &fanoutHandler{handlers}
+}
+
+func (h *fanoutHandler) WithGroup(name string) slog.Handler {
+	handlers := make([]slog.Handler, 0, len(h.handlers))
+	for _, hh := range h.handlers {
+		handlers = append(handlers, hh.WithGroup(name))
+	}
+	return &fanoutHandler{handlers}
+}
+
+// allLevels is passed to handlers that are filtered by a levelHandler.
+const allLevels = slog.Level(math.MinInt)
+
+// LogLevels are minimum log levels keyed by dot separated group (component) names.
+// The empty name sets the default.
+type LogLevels map[string]slog.Level
+
+func (l LogLevels) String() string {
+	var ss []string
+	for k, v := range l {
+		ss = append(ss, k+"="+v.String())
+	}
+	sort.Strings(ss)
+	return strings.Join(ss, ",")
+}
+
+// Set parses comma separated name=level pairs.
+func (l LogLevels) Set(s string) error {
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok || k == "" {
+			return fmt.Errorf("expected name=level: %q", kv)
+		}
+		var lvl slog.Level
+		err := lvl.UnmarshalText([]byte(v))
+		if err != nil {
+			return fmt.Errorf("parse level for %q: %w", k, err)
+		}
+		l[k] = lvl
+	}
+	return nil
+}
+
+// logLevels holds the current levels,
+// replaced as a whole to allow changing them at runtime.
+type logLevels struct {
+	levels atomic.Pointer[LogLevels]
+}
+
+func newLogLevels(def slog.Level, levels LogLevels) *logLevels {
+	ls := make(LogLevels, len(levels)+1)
+	maps.Copy(ls, levels)
+	if _, ok := ls[""]; !ok {
+		ls[""] = def
+	}
+	l := &logLevels{}
+	l.levels.Store(&ls)
+	return l
+}
+
+// level returns the level for the closest configured parent of group.
+func (l *logLevels) level(group string) slog.Level {
+	levels := *l.levels.Load()
+	for {
+		if lvl, ok := levels[group]; ok {
+			return lvl
+		}
+		i := strings.LastIndexByte(group, '.')
+		if i < 0 {
+			return levels[""]
+		}
+		group = group[:i]
+	}
+}
+
+func (l *logLevels) set(group string, lvl slog.Level) {
+	for {
+		old := l.levels.Load()
+		levels := maps.Clone(*old)
+		levels[group] = lvl
+		if l.levels.CompareAndSwap(old, &levels) {
+			return
+		}
+	}
+}
+
+// levelHandler filters records by the level configured for its group.
+type levelHandler struct {
+	slog.Handler
+	levels *logLevels
+	group  string
+	// debugSampled drops debug records outside of sampled spans.
+	debugSampled bool
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	if l < h.levels.level(h.group) {
+		return false
+	}
+	if h.debugSampled && l < slog.LevelInfo && !trace.SpanContextFromContext(ctx).IsSampled() {
+		return false
+	}
+	return h.Handler.Enabled(ctx, l)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.Handler = h.Handler.WithAttrs(attrs)
+	return &h2
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	h2 := *h
+	h2.Handler = h.Handler.WithGroup(name)
+	h2.group = name
+	if h.group != "" {
+		h2.group = h.group + "." + name
+	}
+	return &h2
+}
+
+// SetLogLevel changes the minimum log level for a component
+// (dot separated for nested components), or the default if component is empty.
+func (o *O) SetLogLevel(component string, l slog.Level) {
+	if o.levels == nil {
+		return
+	}
+	o.levels.set(component, l)
+}
@@ -0,0 +1,54 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLevelHandler(t *testing.T) {
+	t.Parallel()
+
+	levels := make(LogLevels)
+	err := levels.Set("noisy=warn,db=debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	o := &O{levels: newLogLevels(slog.LevelInfo, levels)}
+	o.H = &levelHandler{
+		Handler: slog.NewTextHandler(buf, &slog.HandlerOptions{Level: allLevels}),
+		levels:  o.levels,
+	}
+	o.L = slog.New(o.H)
+
+	ctx := context.Background()
+	root := o.L
+	noisy := o.L.WithGroup("noisy")
+	nested := noisy.WithGroup("sub")
+	db := o.L.WithGroup("db")
+
+	root.DebugContext(ctx, "root debug")
+	root.InfoContext(ctx, "root info")
+	noisy.InfoContext(ctx, "noisy info")
+	nested.WarnContext(ctx, "nested warn")
+	db.DebugContext(ctx, "db debug")
+
+	o.SetLogLevel("", slog.LevelDebug)
+	root.DebugContext(ctx, "root debug later")
+
+	got := buf.String()
+	for _, want := range []string{"root info", "nested warn", "db debug", "root debug later"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+	for _, notWant := range []string{"root debug\"", "noisy info"} {
+		if strings.Contains(got, notWant) {
+			t.Errorf("unexpected %q in:\n%s", notWant, got)
+		}
+	}
+}
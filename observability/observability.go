@@ -2,21 +2,35 @@ package observability
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
 	"os"
 	"path"
 	"runtime/debug"
+	"strconv"
 	"strings"
+	"time"
 
+	"cloud.google.com/go/profiler"
+	"github.com/getsentry/sentry-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+	"go.opentelemetry.io/contrib/instrumentation/host"
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/contrib/propagators/autoprop"
+	"go.opentelemetry.io/contrib/zpages"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/attribute"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/metric"
-	"go.opentelemetry.io/otel/propagation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/exemplar"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/trace"
 	"go.seankhliao.com/svcrunner/v3/jsonlog"
@@ -26,6 +40,61 @@ type Config struct {
 	LogFormat string
 	LogOutput io.Writer
 	LogLevel  slog.Level
+	LogOTLP   bool
+	// LogLevels override LogLevel for components.
+	LogLevels LogLevels
+	// LogDebugSampled only emits debug logs within sampled traces.
+	LogDebugSampled bool
+
+	// AlertSink receives error level logs.
+	// If unset, it is created from the log.alert.* flags.
+	AlertSink     AlertSink
+	AlertInterval time.Duration
+	alertGChat    string
+	alertWebhook  string
+	alertTraceURL string
+
+	// SentryDSN enables reporting errors passed to O.Err to sentry,
+	// read from $SENTRY_DSN if empty.
+	SentryDSN string
+
+	// HideHTTPErrors responds to clients with a generic message in O.HTTPErr,
+	// instead of the full error.
+	// The message is HTTPErrorMessage, or the status text if empty.
+	HideHTTPErrors   bool
+	HTTPErrorMessage string
+
+	MetricsFormat    string
+	MetricsRuntime   bool
+	MetricsHost      bool
+	MetricsExemplars string
+	MetricViews      MetricViews
+	OTLPProtocol     string
+	OTLPHeaders      Headers
+	OTLPAudience     string
+
+	// ExportCheck tests that telemetry can be exported at startup.
+	ExportCheck        bool
+	ExportCheckTimeout time.Duration
+
+	TraceExport  string
+	TraceSampler string
+	TraceRatio   float64
+	TraceZPages  bool
+	Propagators  []string
+
+	ProfileExport string
+
+	// SpanExporter and MetricReader replace the exporters selected by flags,
+	// such as with in memory exporters for tests.
+	// Spans are exported synchronously as they end.
+	SpanExporter sdktrace.SpanExporter
+	MetricReader sdkmetric.Reader
+
+	ResourceTimeout time.Duration
+
+	// BaggageKeys are baggage members recorded on logs and spans.
+	BaggageKeys []string
 }
 
 func (c *Config) SetFlags(f *flag.FlagSet) {
@@ -40,6 +109,187 @@ func (c *Config) SetFlags(f *flag.FlagSet) {
 		c.LogFormat = s
 		return nil
 	})
+	c.LogLevels = make(LogLevels)
+	f.Var(c.LogLevels, "log.levels", "comma separated per component log levels: component=level")
+	f.BoolVar(&c.LogDebugSampled, "log.debug-sampled", false, "only emit debug logs within sampled traces")
+	f.BoolVar(&c.LogOTLP, "log.otlp", false, "also export logs over otlp")
+	f.StringVar(&c.alertGChat, "log.alert.gchat", "", "google chat webhook url to send error logs to")
+	f.StringVar(&c.alertWebhook, "log.alert.webhook", "", "webhook url to post error logs to as json")
+	f.StringVar(&c.alertTraceURL, "log.alert.trace-url", "", "format string taking a trace id, to link alerts to traces")
+	f.DurationVar(&c.AlertInterval, "log.alert.interval", time.Minute, "minimum interval between alerts")
+	f.StringVar(&c.SentryDSN, "error.sentry-dsn", "", "sentry dsn to report errors to, defaults to $SENTRY_DSN")
+	f.BoolVar(&c.HideHTTPErrors, "error.http-generic", false, "respond with a generic message instead of internal errors")
+	f.StringVar(&c.HTTPErrorMessage, "error.http-message", "", "generic message to respond with when hiding errors, defaults to the status text")
+	c.MetricsFormat = "otlp" // default
+	f.Func("metrics.format", "metrics export format: otlp|prometheus|stdout", func(s string) error {
+		switch s {
+		case "otlp", "prometheus", "stdout":
+		default:
+			return fmt.Errorf("unknown metrics format: %q", s)
+		}
+		c.MetricsFormat = s
+		return nil
+	})
+	f.BoolVar(&c.MetricsRuntime, "metrics.runtime", true, "record go runtime metrics")
+	f.BoolVar(&c.MetricsHost, "metrics.host", false, "record host metrics")
+	c.MetricsExemplars = "trace_based" // default
+	f.Func("metrics.exemplars", "exemplar filter for linking metrics to traces: trace_based|always_on|always_off", func(s string) error {
+		switch s {
+		case "trace_based", "always_on", "always_off":
+		default:
+			return fmt.Errorf("unknown exemplar filter: %q", s)
+		}
+		c.MetricsExemplars = s
+		return nil
+	})
+	f.Var(&c.MetricViews, "metrics.view", "override instrument aggregation, repeatable: name=drop or name=b1,b2,... (name may use * wildcards)")
+	c.OTLPProtocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	if c.OTLPProtocol == "" {
+		c.OTLPProtocol = "grpc" // default
+	}
+	f.Func("otlp.protocol", "otlp export protocol: grpc|http/protobuf", func(s string) error {
+		switch s {
+		case "grpc", "http/protobuf":
+		default:
+			return fmt.Errorf("unknown otlp protocol: %q", s)
+		}
+		c.OTLPProtocol = s
+		return nil
+	})
+	c.OTLPHeaders = make(Headers)
+	f.Var(c.OTLPHeaders, "otlp.header", "header to send with otlp exports, repeatable: key=value")
+	f.StringVar(&c.OTLPAudience, "otlp.audience", "", "audience for google id tokens to authenticate otlp grpc exports")
+	f.BoolVar(&c.ExportCheck, "otel.check", false, "check that telemetry can be exported at startup")
+	f.DurationVar(&c.ExportCheckTimeout, "otel.check-timeout", 10*time.Second, "timeout for the export check")
+	c.TraceExport = "otlp" // default
+	f.Func("trace.export", "trace export destination: otlp|cloudtrace|stdout", func(s string) error {
+		switch s {
+		case "otlp", "cloudtrace", "stdout":
+		default:
+			return fmt.Errorf("unknown trace export: %q", s)
+		}
+		c.TraceExport = s
+		return nil
+	})
+	c.Propagators = []string{"tracecontext", "baggage"} // default
+	if env := os.Getenv("OTEL_PROPAGATORS"); env != "" {
+		c.Propagators = strings.Split(env, ",")
+	}
+	f.Func("trace.propagators", "comma separated trace context propagators: tracecontext|baggage|b3|b3multi|jaeger|xray|ottrace|none", func(s string) error {
+		names := strings.Split(s, ",")
+		_, err := autoprop.TextMapPropagator(names...)
+		if err != nil {
+			return err
+		}
+		c.Propagators = names
+		return nil
+	})
+	// defaults follow the otel sdk environment variables
+	c.TraceSampler = "parentbased_always_on" // default
+	if env := os.Getenv("OTEL_TRACES_SAMPLER"); validSampler(env) {
+		c.TraceSampler = env
+	}
+	c.TraceRatio = 1 // default
+	if ratio, err := parseRatio(os.Getenv("OTEL_TRACES_SAMPLER_ARG")); err == nil {
+		c.TraceRatio = ratio
+	}
+	f.Func("trace.sampler", "trace sampler: always_on|always_off|traceidratio|parentbased_always_on|parentbased_always_off|parentbased_traceidratio, defaults to $OTEL_TRACES_SAMPLER or parentbased_always_on", func(s string) error {
+		if !validSampler(s) {
+			return fmt.Errorf("unknown trace sampler: %q", s)
+		}
+		c.TraceSampler = s
+		return nil
+	})
+	f.Func("trace.ratio", "fraction of traces to sample for traceidratio samplers, between 0 and 1, defaults to $OTEL_TRACES_SAMPLER_ARG or 1", func(s string) error {
+		ratio, err := parseRatio(s)
+		if err != nil {
+			return err
+		}
+		c.TraceRatio = ratio
+		return nil
+	})
+	f.DurationVar(&c.ResourceTimeout, "resource.timeout", 5*time.Second, "timeout for detecting resource attributes")
+	f.BoolVar(&c.TraceZPages, "trace.zpages", false, "keep recent spans in process for /debug/tracez")
+	f.Func("baggage.keys", "comma separated baggage keys to record on logs and spans", func(s string) error {
+		c.BaggageKeys = nil
+		for _, k := range strings.Split(s, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				c.BaggageKeys = append(c.BaggageKeys, k)
+			}
+		}
+		return nil
+	})
+	c.ProfileExport = "none" // default
+	f.Func("profile.export", "continuous profiling export: none|cloudprofiler", func(s string) error {
+		switch s {
+		case "none", "cloudprofiler":
+		default:
+			return fmt.Errorf("unknown profile export: %q", s)
+		}
+		c.ProfileExport = s
+		return nil
+	})
+}
+
+func (c *Config) alertSink() AlertSink {
+	switch {
+	case c.AlertSink != nil:
+		return c.AlertSink
+	case c.alertGChat != "":
+		return &GChatSink{URL: c.alertGChat, TraceURL: c.alertTraceURL}
+	case c.alertWebhook != "":
+		return &WebhookSink{URL: c.alertWebhook}
+	}
+	return nil
+}
+
+func (c *Config) exemplarFilter() exemplar.Filter {
+	switch c.MetricsExemplars {
+	case "always_on":
+		return exemplar.AlwaysOnFilter
+	case "always_off":
+		return exemplar.AlwaysOffFilter
+	default:
+		return exemplar.TraceBasedFilter
+	}
+}
+
+func validSampler(s string) bool {
+	switch s {
+	case "always_on", "always_off", "traceidratio",
+		"parentbased_always_on", "parentbased_always_off", "parentbased_traceidratio":
+		return true
+	}
+	return false
+}
+
+func parseRatio(s string) (float64, error) {
+	ratio, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse trace ratio: %w", err)
+	}
+	if ratio < 0 || ratio > 1 {
+		return 0, fmt.Errorf("trace ratio %v outside [0, 1]", ratio)
+	}
+	return ratio, nil
+}
+
+// sampler creates the sampler named by TraceSampler,
+// as described by OTEL_TRACES_SAMPLER.
+func (c *Config) sampler() sdktrace.Sampler {
+	var s sdktrace.Sampler
+	switch strings.TrimPrefix(c.TraceSampler, "parentbased_") {
+	case "always_off":
+		s = sdktrace.NeverSample()
+	case "traceidratio":
+		s = sdktrace.TraceIDRatioBased(c.TraceRatio)
+	default:
+		s = sdktrace.AlwaysSample()
+	}
+	if c.TraceSampler == "" || strings.HasPrefix(c.TraceSampler, "parentbased_") {
+		s = sdktrace.ParentBased(s)
+	}
+	return s
 }
 
 type O struct {
@@ -48,10 +298,26 @@ type O struct {
 	H slog.Handler
 	T trace.Tracer
 	M metric.Meter
+
+	scope          string
+	component      string
+	errCount       metric.Int64Counter
+	httpErrCount   metric.Int64Counter
+	hideHTTPErr    bool
+	httpErrMsg     string
+	sentry         *sentry.Hub
+	runner         *runnerMetrics
+	shutdown       []func(context.Context) error
+	metricsHandler http.Handler
+	tracez         *tracez
+	levels         *logLevels
 }
 
 func New(c *Config) *O {
-	o := &O{}
+	o := &O{
+		hideHTTPErr: c.HideHTTPErrors,
+		httpErrMsg:  c.HTTPErrorMessage,
+	}
 
 	bi, _ := debug.ReadBuildInfo()
 	fullname := bi.Main.Path
@@ -63,8 +329,16 @@ func New(c *Config) *O {
 
 	defer func() {
 		// always set instrumentation, even if they may be noops
+		o.scope = fullname
 		o.T = otel.Tracer(fullname)
 		o.M = otel.Meter(fullname)
+		o.runner = newRunnerMetrics()
+		o.errCount, _ = o.M.Int64Counter("errors",
+			metric.WithDescription("errors passed to O.Err"),
+		)
+		o.httpErrCount, _ = o.M.Int64Counter("http.errors",
+			metric.WithDescription("errors responded to with O.HTTPErr"),
+		)
 	}()
 
 	out := c.LogOutput
@@ -73,84 +347,301 @@ func New(c *Config) *O {
 	}
 	switch c.LogFormat {
 	case "json":
-		o.H = jsonlog.New(c.LogLevel, out)
+		o.H = jsonlog.New(allLevels, out)
 	case "logfmt":
 		o.H = slog.NewTextHandler(out, &slog.HandlerOptions{
-			Level: c.LogLevel,
+			Level: allLevels,
 		})
 	}
+	o.levels = newLogLevels(c.LogLevel, c.LogLevels)
+	o.H = &levelHandler{Handler: o.H, levels: o.levels, debugSampled: c.LogDebugSampled}
+	o.H = c.withBaggage(o.H)
+	o.H = &ctxAttrsHandler{o.H}
+	if sink := c.alertSink(); sink != nil {
+		errLog := slog.New(o.H).WithGroup("alert")
+		al := &alerter{
+			sink:     sink,
+			interval: c.AlertInterval,
+			errLog: func(err error) {
+				// logged below error level to not trigger more alerts
+				errLog.LogAttrs(context.Background(), slog.LevelWarn, "send alert",
+					slog.String("error", err.Error()),
+				)
+			},
+		}
+		o.H = &alertHandler{
+			Handler: o.H,
+			alerter: al,
+		}
+		o.shutdown = append(o.shutdown, al.wait)
+	}
 	o.L = slog.New(o.H)
 
-	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" {
-		ctx := context.Background()
+	ctx := context.Background()
+
+	// opentelemetry error handler
+	otelLog := o.L.WithGroup("otel")
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		otelLog.LogAttrs(ctx, slog.LevelWarn, "otel error",
+			slog.String("error", err.Error()),
+		)
+	}))
 
-		// opentelemetry error handler
-		otelLog := o.L.WithGroup("otel")
-		otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
-			otelLog.LogAttrs(ctx, slog.LevelWarn, "otel error",
+	// error reporting
+	sentryDSN := c.SentryDSN
+	if sentryDSN == "" {
+		// not the flag default, which would print it in the usage
+		sentryDSN = os.Getenv("SENTRY_DSN")
+	}
+	if sentryDSN != "" {
+		hub, err := newSentry(sentryDSN, o.N, bi.Main.Version)
+		if err != nil {
+			o.L.LogAttrs(ctx, slog.LevelError, "create sentry client",
 				slog.String("error", err.Error()),
 			)
-		}))
+		} else {
+			o.sentry = hub
+			o.shutdown = append(o.shutdown, flushSentry(hub))
+		}
+	}
 
-		// grpc common
-		serviceConfig := `{"loadBalancingConfig":[{"round_robin":{}}]}`
+	// profiling
+	switch c.ProfileExport {
+	case "cloudprofiler":
+		err := profiler.Start(profiler.Config{
+			Service:        o.N,
+			ServiceVersion: bi.Main.Version,
+			MutexProfiling: true,
+		})
+		if err != nil {
+			o.L.LogAttrs(ctx, slog.LevelError, "start cloud profiler",
+				slog.String("error", err.Error()),
+			)
+		}
+	}
 
-		// tracing
-		te, err := otlptracegrpc.New(ctx,
-			otlptracegrpc.WithServiceConfig(serviceConfig),
+	exportOTLP := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != ""
+	exportTrace := exportOTLP || c.TraceExport != "otlp" || c.SpanExporter != nil
+
+	res, err := c.newResource(ctx, o.N, bi.Main.Version)
+	if err != nil {
+		// partial resources are still usable
+		otelLog.LogAttrs(ctx, slog.LevelWarn, "detect resource",
+			slog.String("error", err.Error()),
 		)
+	}
+
+	creds, err := c.otlpCredentials(ctx)
+	if err != nil {
+		otelLog.LogAttrs(ctx, slog.LevelError, "create otlp credentials",
+			slog.String("error", err.Error()),
+		)
+		return o
+	}
+
+	var te sdktrace.SpanExporter
+	var tp *sdktrace.TracerProvider
+	var mp *sdkmetric.MeterProvider
+
+	// tracing
+	if exportTrace || c.TraceZPages {
+		tpOpts := []sdktrace.TracerProviderOption{
+			sdktrace.WithSampler(c.sampler()),
+			sdktrace.WithResource(res),
+		}
+		if len(c.BaggageKeys) > 0 {
+			tpOpts = append(tpOpts, sdktrace.WithSpanProcessor(baggageSpanProcessor{c.BaggageKeys}))
+		}
+		if c.TraceZPages {
+			o.tracez = &tracez{spans: zpages.NewSpanProcessor()}
+			tpOpts = append(tpOpts, sdktrace.WithSpanProcessor(o.tracez.spans))
+		}
+		if c.SpanExporter != nil {
+			te = c.SpanExporter
+			tpOpts = append(tpOpts, sdktrace.WithSyncer(te))
+		} else if exportTrace {
+			var err error
+			te, err = c.traceExporter(ctx, creds)
+			if err != nil {
+				otelLog.LogAttrs(ctx, slog.LevelError, "create trace exporter",
+					slog.String("error", err.Error()),
+				)
+				return o
+			}
+			if o.tracez != nil {
+				ce := &countingExporter{SpanExporter: te}
+				o.tracez.exporter = ce
+				te = ce
+			}
+			tpOpts = append(tpOpts, sdktrace.WithBatcher(te))
+		}
+		tp = sdktrace.NewTracerProvider(tpOpts...)
+		otel.SetTracerProvider(tp)
+		o.shutdown = append(o.shutdown, tp.Shutdown)
+		prop := autoprop.NewTextMapPropagator()
+		if len(c.Propagators) > 0 {
+			p, err := autoprop.TextMapPropagator(c.Propagators...)
+			if err != nil {
+				otelLog.LogAttrs(ctx, slog.LevelWarn, "create propagators",
+					slog.String("error", err.Error()),
+				)
+			} else {
+				prop = p
+			}
+		}
+		otel.SetTextMapPropagator(prop)
+	}
+
+	// logs
+	if exportOTLP && c.LogOTLP {
+		le, err := c.logExporter(ctx, creds)
 		if err != nil {
-			otelLog.LogAttrs(ctx, slog.LevelError, "create trace exporter",
+			otelLog.LogAttrs(ctx, slog.LevelError, "create log exporter",
 				slog.String("error", err.Error()),
 			)
 			return o
 		}
-		tp := sdktrace.NewTracerProvider(
-			sdktrace.WithBatcher(te),
-		)
-		otel.SetTracerProvider(tp)
-		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
-			propagation.Baggage{},
-			propagation.TraceContext{},
-		))
-
-		// metrics
-		me, err := otlpmetricgrpc.New(ctx,
-			otlpmetricgrpc.WithServiceConfig(serviceConfig),
+		lp := sdklog.NewLoggerProvider(
+			sdklog.WithProcessor(sdklog.NewBatchProcessor(le)),
+			sdklog.WithResource(res),
 		)
+		o.shutdown = append(o.shutdown, lp.Shutdown)
+		o.H = &fanoutHandler{
+			handlers: []slog.Handler{
+				o.H,
+				&ctxAttrsHandler{c.withBaggage(&levelHandler{
+					Handler:      otelslog.NewHandler(fullname, otelslog.WithLoggerProvider(lp)),
+					levels:       o.levels,
+					debugSampled: c.LogDebugSampled,
+				})},
+			},
+		}
+		o.L = slog.New(o.H)
+	}
+
+	// metrics
+	var reader sdkmetric.Reader
+	switch {
+	case c.MetricReader != nil:
+		reader = c.MetricReader
+	case c.MetricsFormat == "prometheus":
+		reg := prometheus.NewRegistry()
+		pe, err := otelprometheus.New(otelprometheus.WithRegisterer(reg))
+		if err != nil {
+			otelLog.LogAttrs(ctx, slog.LevelError, "create prometheus exporter",
+				slog.String("error", err.Error()),
+			)
+			return o
+		}
+		reader = pe
+		o.metricsHandler = promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+	default:
+		if !exportOTLP && c.MetricsFormat != "stdout" {
+			break
+		}
+		me, err := c.metricExporter(ctx, creds)
 		if err != nil {
 			otelLog.LogAttrs(ctx, slog.LevelError, "create metric exporter",
 				slog.String("error", err.Error()),
 			)
 			return o
 		}
-		mp := sdkmetric.NewMeterProvider(
-			sdkmetric.WithReader(
-				sdkmetric.NewPeriodicReader(me),
-			),
-			sdkmetric.WithView(
-				sdkmetric.NewView(sdkmetric.Instrument{
-					Kind: sdkmetric.InstrumentKindHistogram,
-				}, sdkmetric.Stream{
-					Aggregation: sdkmetric.AggregationBase2ExponentialHistogram{
-						MaxSize:  160,
-						MaxScale: 20,
-					},
-				}),
-			),
+		reader = sdkmetric.NewPeriodicReader(me)
+	}
+	if reader != nil {
+		mp = sdkmetric.NewMeterProvider(
+			sdkmetric.WithReader(reader),
+			sdkmetric.WithResource(res),
+			sdkmetric.WithExemplarFilter(c.exemplarFilter()),
+			sdkmetric.WithView(c.MetricViews.view()),
 		)
 		otel.SetMeterProvider(mp)
+		o.shutdown = append(o.shutdown, mp.Shutdown)
+	}
+
+	if c.ExportCheck {
+		if te == nil {
+			// only in process spans for tracez
+			tp = nil
+		}
+		go checkExport(ctx, otelLog, c.ExportCheckTimeout, tp, mp)
+	}
+
+	if c.MetricsRuntime {
+		err := runtime.Start()
+		if err != nil {
+			otelLog.LogAttrs(ctx, slog.LevelError, "start runtime metrics",
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+	if c.MetricsHost {
+		err := host.Start()
+		if err != nil {
+			otelLog.LogAttrs(ctx, slog.LevelError, "start host metrics",
+				slog.String("error", err.Error()),
+			)
+		}
 	}
 
 	return o
 }
 
+// Component returns an O for a subsystem,
+// grouping its logs and tagging its spans and metrics
+// with a component attribute.
 func (o *O) Component(name string) *O {
+	component := name
+	if o.component != "" {
+		component = o.component + "." + name
+	}
+	attr := attribute.String("component", component)
 	return &O{
 		N: o.N,
 		L: o.L.WithGroup(name),
 		H: o.H.WithGroup(name),
-		T: o.T,
-		M: o.M,
+		T: componentTracer{
+			Tracer: otel.Tracer(o.scope, trace.WithInstrumentationAttributes(attr)),
+			attr:   attr,
+		},
+		M: otel.Meter(o.scope, metric.WithInstrumentationAttributes(attr)),
+
+		scope:          o.scope,
+		component:      component,
+		errCount:       o.errCount,
+		httpErrCount:   o.httpErrCount,
+		hideHTTPErr:    o.hideHTTPErr,
+		httpErrMsg:     o.httpErrMsg,
+		sentry:         o.sentry,
+		runner:         o.runner,
+		shutdown:       o.shutdown,
+		metricsHandler: o.metricsHandler,
+		tracez:         o.tracez,
+		levels:         o.levels,
+	}
+}
+
+// componentTracer adds the component attribute to all spans.
+type componentTracer struct {
+	trace.Tracer
+	attr attribute.KeyValue
+}
+
+func (t componentTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return t.Tracer.Start(ctx, name, append(opts, trace.WithAttributes(t.attr))...)
+}
+
+// MetricsHandler returns a handler serving metrics in the prometheus exposition format,
+// or nil if metrics.format is not prometheus.
+func (o *O) MetricsHandler() http.Handler {
+	return o.metricsHandler
+}
+
+// Shutdown flushes and stops the installed telemetry providers.
+func (o *O) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, f := range o.shutdown {
+		errs = append(errs, f(ctx))
 	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,70 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSamplerFlags(t *testing.T) {
+	t.Setenv("OTEL_TRACES_SAMPLER", "traceidratio")
+	t.Setenv("OTEL_TRACES_SAMPLER_ARG", "0.25")
+
+	var c Config
+	fset := flag.NewFlagSet("", flag.ContinueOnError)
+	c.SetFlags(fset)
+	if c.TraceSampler != "traceidratio" || c.TraceRatio != 0.25 {
+		t.Errorf("from env: sampler = %s ratio = %v", c.TraceSampler, c.TraceRatio)
+	}
+	if got := c.sampler().Description(); got != "TraceIDRatioBased{0.25}" {
+		t.Errorf("sampler = %s", got)
+	}
+
+	err := fset.Parse([]string{"-trace.sampler=parentbased_always_off"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.sampler().Description(); got != "ParentBased{root:AlwaysOffSampler,remoteParentSampled:AlwaysOnSampler,remoteParentNotSampled:AlwaysOffSampler,localParentSampled:AlwaysOnSampler,localParentNotSampled:AlwaysOffSampler}" {
+		t.Errorf("sampler = %s", got)
+	}
+
+	for _, args := range [][]string{
+		{"-trace.sampler=ratio"},
+		{"-trace.ratio=1.5"},
+		{"-trace.ratio=-0.1"},
+	} {
+		fset := flag.NewFlagSet("", flag.ContinueOnError)
+		fset.SetOutput(io.Discard)
+		new(Config).SetFlags(fset)
+		if fset.Parse(args) == nil {
+			t.Errorf("%v: expected error", args)
+		}
+	}
+}
+
+func TestHTTPErrGeneric(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name string
+		conf Config
+		want string
+	}{
+		{"full", Config{}, "load item: database unavailable\n"},
+		{"status text", Config{HideHTTPErrors: true}, "Internal Server Error\n"},
+		{"message", Config{HideHTTPErrors: true, HTTPErrorMessage: "something went wrong"}, "something went wrong\n"},
+	} {
+		tc.conf.LogFormat = "json"
+		tc.conf.LogOutput = io.Discard
+		o := New(&tc.conf).Component("test")
+		rec := httptest.NewRecorder()
+		o.HTTPErr(context.Background(), "load item", errors.New("database unavailable"), rec, http.StatusInternalServerError)
+		if rec.Body.String() != tc.want {
+			t.Errorf("%s: body = %q, want %q", tc.name, rec.Body.String(), tc.want)
+		}
+	}
+}
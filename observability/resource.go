@@ -0,0 +1,47 @@
+package observability
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/contrib/detectors/gcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// newResource describes the running instance.
+// Attributes from OTEL_RESOURCE_ATTRIBUTES and OTEL_SERVICE_NAME take precedence
+// over detected ones.
+func (c *Config) newResource(ctx context.Context, name, version string) (*resource.Resource, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.ResourceTimeout)
+	defer cancel()
+
+	return resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithDetectors(gcp.NewDetector()),
+		resource.WithAttributes(k8sAttrs()...),
+		resource.WithAttributes(
+			semconv.ServiceName(name),
+			semconv.ServiceVersion(version),
+		),
+		resource.WithFromEnv(),
+	)
+}
+
+// k8sAttrs reads pod metadata exposed through the downward API as environment variables.
+func k8sAttrs() []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	for env, attr := range map[string]func(string) attribute.KeyValue{
+		"K8S_NAMESPACE_NAME": semconv.K8SNamespaceName,
+		"K8S_NODE_NAME":      semconv.K8SNodeName,
+		"K8S_POD_NAME":       semconv.K8SPodName,
+		"K8S_POD_UID":        semconv.K8SPodUID,
+		"K8S_CONTAINER_NAME": semconv.K8SContainerName,
+	} {
+		if v := os.Getenv(env); v != "" {
+			attrs = append(attrs, attr(v))
+		}
+	}
+	return attrs
+}
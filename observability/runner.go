@@ -0,0 +1,74 @@
+package observability
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// runnerMetrics describe svcrunner itself,
+// recorded under its own instrumentation scope.
+type runnerMetrics struct {
+	phase       metric.Float64Histogram
+	starts      metric.Int64Counter
+	connections metric.Int64UpDownCounter
+	reloads     metric.Int64Counter
+}
+
+func newRunnerMetrics() *runnerMetrics {
+	m := otel.Meter("go.seankhliao.com/svcrunner/v3")
+	r := &runnerMetrics{}
+	r.phase, _ = m.Float64Histogram("svcrunner.phase.duration",
+		metric.WithDescription("time spent in each lifecycle phase"),
+		metric.WithUnit("s"),
+	)
+	r.starts, _ = m.Int64Counter("svcrunner.starts",
+		metric.WithDescription("number of times the application was started"),
+	)
+	r.connections, _ = m.Int64UpDownCounter("svcrunner.http.connections",
+		metric.WithDescription("open http server connections"),
+	)
+	r.reloads, _ = m.Int64Counter("svcrunner.reloads",
+		metric.WithDescription("number of reloads, by whether they succeeded"),
+	)
+	return r
+}
+
+// RecordPhase records the duration of a lifecycle phase,
+// such as config, start, or shutdown.
+func (o *O) RecordPhase(ctx context.Context, phase string, d time.Duration) {
+	if o.runner == nil {
+		return
+	}
+	o.runner.phase.Record(ctx, d.Seconds(), metric.WithAttributes(attribute.String("phase", phase)))
+	if phase == "start" {
+		o.runner.starts.Add(ctx, 1)
+	}
+}
+
+// RecordReload records the result of reloading the application.
+func (o *O) RecordReload(ctx context.Context, err error) {
+	if o.runner == nil {
+		return
+	}
+	o.runner.reloads.Add(ctx, 1, metric.WithAttributes(attribute.Bool("success", err == nil)))
+}
+
+// ConnState tracks open connections,
+// for use as http.Server.ConnState.
+func (o *O) ConnState(c net.Conn, s http.ConnState) {
+	if o.runner == nil {
+		return
+	}
+	switch s {
+	case http.StateNew:
+		o.runner.connections.Add(context.Background(), 1)
+	case http.StateHijacked, http.StateClosed:
+		o.runner.connections.Add(context.Background(), -1)
+	}
+}
@@ -0,0 +1,42 @@
+package observability
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// checkExport records a test span and flushes traces and metrics,
+// warning if the exports fail within the timeout.
+// The span goes through the configured sampler,
+// and may not be exported if it isn't sampled.
+func checkExport(ctx context.Context, lg *slog.Logger, timeout time.Duration, tp *sdktrace.TracerProvider, mp *sdkmetric.MeterProvider) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if tp != nil {
+		_, span := tp.Tracer("go.seankhliao.com/svcrunner/v3").Start(ctx, "svcrunner export check")
+		span.End()
+		err := tp.ForceFlush(ctx)
+		if err != nil {
+			lg.LogAttrs(ctx, slog.LevelWarn, "trace export check failed, spans may be lost",
+				slog.String("error", err.Error()),
+			)
+		} else {
+			lg.LogAttrs(ctx, slog.LevelDebug, "trace export check succeeded")
+		}
+	}
+	if mp != nil {
+		err := mp.ForceFlush(ctx)
+		if err != nil {
+			lg.LogAttrs(ctx, slog.LevelWarn, "metric export check failed, metrics may be lost",
+				slog.String("error", err.Error()),
+			)
+		} else {
+			lg.LogAttrs(ctx, slog.LevelDebug, "metric export check succeeded")
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+type failingExporter struct {
+	spans int
+}
+
+func (e *failingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.spans += len(spans)
+	for _, span := range spans {
+		if !span.SpanContext().IsValid() || span.Resource() == nil {
+			return errors.New("invalid span")
+		}
+	}
+	return errors.New("collector unavailable")
+}
+
+func (e *failingExporter) Shutdown(ctx context.Context) error { return nil }
+
+func TestCheckExport(t *testing.T) {
+	t.Parallel()
+
+	buf := new(bytes.Buffer)
+	lg := slog.New(slog.NewTextHandler(buf, nil))
+	exp := &failingExporter{}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp))
+	defer tp.Shutdown(context.Background())
+
+	checkExport(context.Background(), lg, 5*time.Second, tp, nil)
+	if exp.spans != 1 {
+		t.Errorf("exported %d spans, want 1", exp.spans)
+	}
+	if !strings.Contains(buf.String(), "collector unavailable") {
+		t.Errorf("export failure not logged:\n%s", buf)
+	}
+}
@@ -0,0 +1,41 @@
+package observability
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/XSAM/otelsql"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// WrapDB opens a database with an instrumented driver,
+// recording spans for queries and connection pool metrics.
+func (o *O) WrapDB(driverName, dsn string) (*sql.DB, error) {
+	ctx := context.Background()
+
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", driverName),
+	}
+	if o.component != "" {
+		attrs = append(attrs, attribute.String("component", o.component))
+	}
+	opts := []otelsql.Option{
+		otelsql.WithAttributes(attrs...),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}),
+	}
+
+	db, err := otelsql.Open(driverName, dsn, opts...)
+	if err != nil {
+		return nil, o.Err(ctx, "open instrumented db", err, slog.String("driver", driverName))
+	}
+	err = otelsql.RegisterDBStatsMetrics(db, opts...)
+	if err != nil {
+		db.Close()
+		return nil, o.Err(ctx, "register db stats metrics", err, slog.String("driver", driverName))
+	}
+	return db, nil
+}
@@ -0,0 +1,67 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/contrib/zpages"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// tracez holds in process trace state for debugging.
+type tracez struct {
+	spans    *zpages.SpanProcessor
+	exporter *countingExporter
+}
+
+// countingExporter records the outcome of span exports.
+type countingExporter struct {
+	sdktrace.SpanExporter
+
+	mu       sync.Mutex
+	batches  int
+	spans    int
+	failures int
+	lastErr  error
+}
+
+func (e *countingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.batches++
+	if err != nil {
+		e.failures++
+		e.lastErr = err
+		return err
+	}
+	e.spans += len(spans)
+	return nil
+}
+
+func (e *countingExporter) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rw.Header().Set("content-type", "text/plain; charset=utf-8")
+	fmt.Fprintf(rw, "batches: %d\n", e.batches)
+	fmt.Fprintf(rw, "spans exported: %d\n", e.spans)
+	fmt.Fprintf(rw, "failed batches: %d\n", e.failures)
+	if e.lastErr != nil {
+		fmt.Fprintf(rw, "last error: %v\n", e.lastErr)
+	}
+}
+
+// RegisterTracez mounts /debug/tracez (recently sampled spans)
+// and /debug/exporterz (span export counts) on mux
+// if trace.zpages is enabled.
+func (o *O) RegisterTracez(mux *http.ServeMux) {
+	if o.tracez == nil {
+		return
+	}
+	mux.Handle("/debug/tracez", zpages.NewTracezHandler(o.tracez.spans))
+	if o.tracez.exporter != nil {
+		mux.Handle("/debug/exporterz", o.tracez.exporter)
+	}
+}
@@ -0,0 +1,101 @@
+package observability
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// MetricView overrides the aggregation for instruments with a matching name.
+type MetricView struct {
+	// Name is matched with path.Match
+	Name    string
+	Drop    bool
+	Buckets []float64
+}
+
+// MetricViews is a repeatable flag of name=drop or name=b1,b2,...
+type MetricViews []MetricView
+
+func (v *MetricViews) String() string {
+	if v == nil {
+		return ""
+	}
+	var ss []string
+	for _, mv := range *v {
+		if mv.Drop {
+			ss = append(ss, mv.Name+"=drop")
+			continue
+		}
+		var bs []string
+		for _, b := range mv.Buckets {
+			bs = append(bs, strconv.FormatFloat(b, 'g', -1, 64))
+		}
+		ss = append(ss, mv.Name+"="+strings.Join(bs, ","))
+	}
+	return strings.Join(ss, " ")
+}
+
+func (v *MetricViews) Set(s string) error {
+	name, spec, ok := strings.Cut(s, "=")
+	if !ok || name == "" || spec == "" {
+		return fmt.Errorf("expected name=drop or name=b1,b2,...: %q", s)
+	}
+	if _, err := path.Match(name, ""); err != nil {
+		return fmt.Errorf("invalid name pattern %q: %w", name, err)
+	}
+	mv := MetricView{Name: name}
+	if spec == "drop" {
+		mv.Drop = true
+	} else {
+		for _, f := range strings.Split(spec, ",") {
+			b, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+			if err != nil {
+				return fmt.Errorf("invalid bucket boundary %q: %w", f, err)
+			}
+			mv.Buckets = append(mv.Buckets, b)
+		}
+		if !slices.IsSorted(mv.Buckets) {
+			return fmt.Errorf("bucket boundaries must be increasing: %q", spec)
+		}
+	}
+	*v = append(*v, mv)
+	return nil
+}
+
+// view applies the first matching override,
+// defaulting histograms to exponential buckets.
+func (v MetricViews) view() sdkmetric.View {
+	return func(i sdkmetric.Instrument) (sdkmetric.Stream, bool) {
+		s := sdkmetric.Stream{
+			Name:        i.Name,
+			Description: i.Description,
+			Unit:        i.Unit,
+		}
+		for _, mv := range v {
+			if ok, _ := path.Match(mv.Name, i.Name); !ok {
+				continue
+			}
+			if mv.Drop {
+				s.Aggregation = sdkmetric.AggregationDrop{}
+			} else {
+				s.Aggregation = sdkmetric.AggregationExplicitBucketHistogram{
+					Boundaries: mv.Buckets,
+				}
+			}
+			return s, true
+		}
+		if i.Kind == sdkmetric.InstrumentKindHistogram {
+			s.Aggregation = sdkmetric.AggregationBase2ExponentialHistogram{
+				MaxSize:  160,
+				MaxScale: 20,
+			}
+			return s, true
+		}
+		return s, false
+	}
+}
@@ -0,0 +1,121 @@
+package observability
+
+import (
+	"reflect"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func TestMetricViewsSet(t *testing.T) {
+	t.Parallel()
+
+	tcs := []struct {
+		name    string
+		args    []string
+		want    MetricViews
+		wantErr bool
+	}{
+		{
+			name: "drop",
+			args: []string{"http.server.*=drop"},
+			want: MetricViews{{Name: "http.server.*", Drop: true}},
+		}, {
+			name: "buckets",
+			args: []string{"latency=0.1, 1,10"},
+			want: MetricViews{{Name: "latency", Buckets: []float64{0.1, 1, 10}}},
+		}, {
+			name: "multiple",
+			args: []string{"a=drop", "b=1"},
+			want: MetricViews{{Name: "a", Drop: true}, {Name: "b", Buckets: []float64{1}}},
+		}, {
+			name:    "no spec",
+			args:    []string{"latency"},
+			wantErr: true,
+		}, {
+			name:    "unsorted",
+			args:    []string{"latency=10,1"},
+			wantErr: true,
+		}, {
+			name:    "not a number",
+			args:    []string{"latency=fast"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got MetricViews
+			var err error
+			for _, arg := range tc.args {
+				err = got.Set(arg)
+				if err != nil {
+					break
+				}
+			}
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Set() err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Set() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMetricViewsView(t *testing.T) {
+	t.Parallel()
+
+	v := MetricViews{
+		{Name: "dropped", Drop: true},
+		{Name: "custom.*", Buckets: []float64{1, 2}},
+	}.view()
+
+	tcs := []struct {
+		name   string
+		inst   sdkmetric.Instrument
+		want   sdkmetric.Aggregation
+		wantOK bool
+	}{
+		{
+			name:   "drop",
+			inst:   sdkmetric.Instrument{Name: "dropped", Kind: sdkmetric.InstrumentKindCounter},
+			want:   sdkmetric.AggregationDrop{},
+			wantOK: true,
+		}, {
+			name:   "buckets",
+			inst:   sdkmetric.Instrument{Name: "custom.latency", Kind: sdkmetric.InstrumentKindHistogram},
+			want:   sdkmetric.AggregationExplicitBucketHistogram{Boundaries: []float64{1, 2}},
+			wantOK: true,
+		}, {
+			name:   "default histogram",
+			inst:   sdkmetric.Instrument{Name: "other", Kind: sdkmetric.InstrumentKindHistogram},
+			want:   sdkmetric.AggregationBase2ExponentialHistogram{MaxSize: 160, MaxScale: 20},
+			wantOK: true,
+		}, {
+			name: "unmatched counter",
+			inst: sdkmetric.Instrument{Name: "other", Kind: sdkmetric.InstrumentKindCounter},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s, ok := v(tc.inst)
+			if ok != tc.wantOK {
+				t.Fatalf("view() ok = %v, want %v", ok, tc.wantOK)
+			}
+			if ok && !reflect.DeepEqual(s.Aggregation, tc.want) {
+				t.Errorf("view() aggregation = %#v, want %#v", s.Aggregation, tc.want)
+			}
+			if ok && s.Name != tc.inst.Name {
+				t.Errorf("view() name = %q, want %q", s.Name, tc.inst.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+// Package pubsub receives messages from a GCP Pub/Sub subscription,
+// pulling through the rest api.
+//
+// A Subscriber runs as a framework worker or runnable.
+package pubsub
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.seankhliao.com/svcrunner/v3/observability"
+	"google.golang.org/api/option"
+	"google.golang.org/api/pubsub/v1"
+)
+
+type Config struct {
+	// Subscription is the full name projects/*/subscriptions/*.
+	Subscription string
+	// Concurrency is the number of messages handled at once.
+	Concurrency int
+	// Endpoint overrides the api endpoint, such as for an emulator,
+	// which is used without authentication.
+	Endpoint string
+}
+
+func (c *Config) SetFlags(fset *flag.FlagSet) {
+	fset.StringVar(&c.Subscription, "pubsub.subscription", "", "subscription to receive from: projects/*/subscriptions/*")
+	fset.IntVar(&c.Concurrency, "pubsub.concurrency", 10, "number of messages to handle concurrently")
+	fset.StringVar(&c.Endpoint, "pubsub.endpoint", "", "api endpoint override, such as http://localhost:8085/ for the emulator")
+}
+
+// Message is a received Pub/Sub message.
+type Message struct {
+	ID          string
+	Data        []byte
+	Attributes  map[string]string
+	OrderingKey string
+	PublishTime time.Time
+	// DeliveryAttempt counts from 1 if the subscription has a dead letter policy,
+	// otherwise it is 0.
+	DeliveryAttempt int
+}
+
+// Handler processes a message.
+// Returning nil acknowledges it,
+// an error nacks it for redelivery.
+// It may be called more than once for a message.
+type Handler func(ctx context.Context, m *Message) error
+
+type Subscriber struct {
+	O *observability.O
+
+	svc      *pubsub.Service
+	conf     *Config
+	handler  Handler
+	received metric.Int64Counter
+}
+
+func New(ctx context.Context, o *observability.O, c *Config, h Handler) (*Subscriber, error) {
+	o = o.Component("pubsub")
+
+	if c.Subscription == "" {
+		return nil, o.Err(ctx, "create subscriber", errors.New("no subscription"))
+	}
+	var opts []option.ClientOption
+	if c.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(c.Endpoint), option.WithoutAuthentication())
+	}
+	svc, err := pubsub.NewService(ctx, opts...)
+	if err != nil {
+		return nil, o.Err(ctx, "create pubsub client", err)
+	}
+
+	s := &Subscriber{
+		O:       o,
+		svc:     svc,
+		conf:    c,
+		handler: h,
+	}
+	s.received, _ = o.M.Int64Counter("pubsub.messages.received",
+		metric.WithDescription("messages received, by subscription and result: ack|nack"),
+	)
+	return s, nil
+}
+
+// Run pulls and handles messages until ctx is canceled,
+// for use as a framework worker.
+// On shutdown it stops pulling,
+// and waits for messages being handled to complete and be acknowledged.
+func (s *Subscriber) Run(ctx context.Context) error {
+	s.O.L.LogAttrs(ctx, slog.LevelInfo, "starting subscriber",
+		slog.String("subscription", s.conf.Subscription),
+		slog.Int("concurrency", s.conf.Concurrency),
+	)
+
+	// handlers outlive ctx so pulled messages are completed
+	handleCtx := context.WithoutCancel(ctx)
+	slots := make(chan struct{}, max(s.conf.Concurrency, 1))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	var backoff time.Duration
+	for {
+		// wait for at least one free slot, then pull for all free slots
+		select {
+		case <-ctx.Done():
+			return nil
+		case slots <- struct{}{}:
+		}
+		free := 1
+	fill:
+		for free < cap(slots) {
+			select {
+			case slots <- struct{}{}:
+				free++
+			default:
+				break fill
+			}
+		}
+
+		res, err := s.svc.Projects.Subscriptions.Pull(s.conf.Subscription, &pubsub.PullRequest{
+			MaxMessages: int64(free),
+		}).Context(ctx).Do()
+		var msgs []*pubsub.ReceivedMessage
+		if res != nil {
+			msgs = res.ReceivedMessages
+		}
+		for range free - len(msgs) {
+			<-slots
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			backoff = min(max(2*backoff, 100*time.Millisecond), 10*time.Second)
+			s.O.Err(ctx, "pull messages", err,
+				slog.String("subscription", s.conf.Subscription),
+				slog.Duration("backoff", backoff),
+			)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		backoff = 0
+
+		for _, rm := range msgs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+				s.process(handleCtx, rm)
+			}()
+		}
+	}
+}
+
+// process runs the handler for rm,
+// acknowledging it on success, or nacking it for redelivery on failure.
+func (s *Subscriber) process(ctx context.Context, rm *pubsub.ReceivedMessage) {
+	m, err := newMessage(rm)
+	if err != nil {
+		s.O.Err(ctx, "decode message", err, slog.String("message", rm.Message.MessageId))
+		s.nack(ctx, rm.AckId)
+		return
+	}
+
+	published := trace.SpanContextFromContext(
+		otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(m.Attributes)),
+	)
+	ctx, span := s.O.T.Start(ctx, "pubsub.receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(trace.Link{SpanContext: published}),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "gcp_pubsub"),
+			attribute.String("messaging.destination.subscription.name", s.conf.Subscription),
+			attribute.String("messaging.message.id", m.ID),
+			attribute.Int("messaging.gcp_pubsub.message.delivery_attempt", m.DeliveryAttempt),
+		),
+	)
+	defer span.End()
+
+	err = s.handle(ctx, m)
+	result := "ack"
+	if err == nil {
+		_, aerr := s.svc.Projects.Subscriptions.Acknowledge(s.conf.Subscription, &pubsub.AcknowledgeRequest{
+			AckIds: []string{rm.AckId},
+		}).Context(ctx).Do()
+		if aerr != nil {
+			s.O.Err(ctx, "acknowledge message", aerr, slog.String("message", m.ID))
+		}
+	} else {
+		result = "nack"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.O.L.LogAttrs(ctx, slog.LevelWarn, "message failed, nacked",
+			slog.String("message", m.ID),
+			slog.Int("delivery_attempt", m.DeliveryAttempt),
+			slog.String("error", err.Error()),
+		)
+		s.nack(ctx, rm.AckId)
+	}
+	s.received.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("subscription", s.conf.Subscription),
+		attribute.String("result", result),
+	))
+}
+
+// handle calls the handler, converting a panic into an error.
+func (s *Subscriber) handle(ctx context.Context, m *Message) (err error) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		err = s.O.Err(ctx, "recovered panic handling message", fmt.Errorf("panic: %v", v),
+			slog.String("stack", string(debug.Stack())),
+		)
+	}()
+	return s.handler(ctx, m)
+}
+
+// nack makes a message available for redelivery immediately.
+func (s *Subscriber) nack(ctx context.Context, ackID string) {
+	_, err := s.svc.Projects.Subscriptions.ModifyAckDeadline(s.conf.Subscription, &pubsub.ModifyAckDeadlineRequest{
+		AckIds:             []string{ackID},
+		AckDeadlineSeconds: 0,
+		ForceSendFields:    []string{"AckDeadlineSeconds"},
+	}).Context(ctx).Do()
+	if err != nil {
+		s.O.Err(ctx, "nack message", err)
+	}
+}
+
+func newMessage(rm *pubsub.ReceivedMessage) (*Message, error) {
+	if rm.Message == nil {
+		return nil, errors.New("no message")
+	}
+	data, err := base64.StdEncoding.DecodeString(rm.Message.Data)
+	if err != nil {
+		return nil, fmt.Errorf("decode data: %w", err)
+	}
+	m := &Message{
+		ID:              rm.Message.MessageId,
+		Data:            data,
+		Attributes:      rm.Message.Attributes,
+		OrderingKey:     rm.Message.OrderingKey,
+		DeliveryAttempt: int(rm.DeliveryAttempt),
+	}
+	if rm.Message.PublishTime != "" {
+		m.PublishTime, err = time.Parse(time.RFC3339Nano, rm.Message.PublishTime)
+		if err != nil {
+			return nil, fmt.Errorf("parse publish time: %w", err)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,208 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+	"google.golang.org/api/pubsub/v1"
+)
+
+const testSubscription = "projects/p/subscriptions/s"
+
+// fakePubsub serves the pull, acknowledge, and modifyAckDeadline methods
+// for a single subscription.
+type fakePubsub struct {
+	mu      sync.Mutex
+	pending []*pubsub.ReceivedMessage
+	acked   []string
+	nacked  []string
+}
+
+func (f *fakePubsub) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	sub, method, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/"), ":")
+	if sub != testSubscription {
+		http.Error(rw, "unknown subscription "+sub, http.StatusNotFound)
+		return
+	}
+	switch method {
+	case "pull":
+		var req pubsub.PullRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		n := min(int(req.MaxMessages), len(f.pending))
+		msgs := f.pending[:n]
+		f.pending = f.pending[n:]
+		f.mu.Unlock()
+		if n == 0 {
+			// long poll
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		json.NewEncoder(rw).Encode(&pubsub.PullResponse{ReceivedMessages: msgs})
+	case "acknowledge":
+		var req pubsub.AcknowledgeRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		f.acked = append(f.acked, req.AckIds...)
+		f.mu.Unlock()
+		io.WriteString(rw, "{}")
+	case "modifyAckDeadline":
+		var req pubsub.ModifyAckDeadlineRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.AckDeadlineSeconds != 0 {
+			http.Error(rw, "unexpected deadline", http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.nacked = append(f.nacked, req.AckIds...)
+		f.mu.Unlock()
+		io.WriteString(rw, "{}")
+	default:
+		http.Error(rw, "unknown method "+method, http.StatusNotFound)
+	}
+}
+
+func (f *fakePubsub) add(id, data string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pending = append(f.pending, &pubsub.ReceivedMessage{
+		AckId: "ack-" + id,
+		Message: &pubsub.PubsubMessage{
+			MessageId:   id,
+			Data:        base64.StdEncoding.EncodeToString([]byte(data)),
+			PublishTime: "2024-01-02T03:04:05.123Z",
+		},
+	})
+}
+
+func (f *fakePubsub) results() (acked, nacked []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.acked...), append([]string(nil), f.nacked...)
+}
+
+func newTestSubscriber(t *testing.T, f *fakePubsub, concurrency int, h Handler) *Subscriber {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+	s, err := New(context.Background(), o, &Config{
+		Subscription: testSubscription,
+		Concurrency:  concurrency,
+		Endpoint:     srv.URL + "/",
+	}, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSubscriber(t *testing.T) {
+	t.Parallel()
+
+	f := &fakePubsub{}
+	f.add("1", "hello")
+	f.add("2", "fail")
+	f.add("3", "panic")
+
+	var mu sync.Mutex
+	got := map[string]string{}
+	s := newTestSubscriber(t, f, 2, func(ctx context.Context, m *Message) error {
+		mu.Lock()
+		got[m.ID] = string(m.Data)
+		mu.Unlock()
+		if m.PublishTime.IsZero() {
+			t.Errorf("message %s: no publish time", m.ID)
+		}
+		switch string(m.Data) {
+		case "fail":
+			return errors.New("oops")
+		case "panic":
+			panic("oops")
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		acked, nacked := f.results()
+		if len(acked)+len(nacked) == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("messages not handled: acked %v, nacked %v", acked, nacked)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("run: %v", err)
+	}
+
+	if got["1"] != "hello" {
+		t.Errorf("message data = %q, want hello", got["1"])
+	}
+	acked, nacked := f.results()
+	if len(acked) != 1 || acked[0] != "ack-1" {
+		t.Errorf("acked = %v, want [ack-1]", acked)
+	}
+	if len(nacked) != 2 {
+		t.Errorf("nacked = %v, want ack-2 and ack-3", nacked)
+	}
+}
+
+func TestSubscriberDrain(t *testing.T) {
+	t.Parallel()
+
+	f := &fakePubsub{}
+	f.add("1", "slow")
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s := newTestSubscriber(t, f, 1, func(ctx context.Context, m *Message) error {
+		close(started)
+		<-release
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	<-started
+
+	// in flight messages complete after shutdown starts
+	cancel()
+	select {
+	case <-done:
+		t.Fatal("run returned before in flight messages completed")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("run: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("run didn't return after messages drained")
+	}
+	acked, nacked := f.results()
+	if len(acked) != 1 || len(nacked) != 0 {
+		t.Errorf("acked = %v, nacked = %v, want drained message acked", acked, nacked)
+	}
+}
@@ -0,0 +1,433 @@
+// Package queue is a durable task queue stored in SQLite,
+// processing tasks at least once with retries and dead letters.
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS queue_tasks (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	queue        TEXT    NOT NULL,
+	payload      BLOB    NOT NULL,
+	trace        TEXT    NOT NULL DEFAULT '',
+	attempts     INTEGER NOT NULL DEFAULT 0,
+	run_at       INTEGER NOT NULL,
+	leased_until INTEGER NOT NULL DEFAULT 0,
+	dead         INTEGER NOT NULL DEFAULT 0,
+	last_error   TEXT    NOT NULL DEFAULT '',
+	created_at   INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS queue_tasks_ready ON queue_tasks (dead, queue, run_at);
+`
+
+type Config struct {
+	Workers      int
+	PollInterval time.Duration
+	// Lease is how long a task may run before it is given to another worker,
+	// such as after the process crashed.
+	// Handlers are canceled when their lease expires.
+	Lease       time.Duration
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+}
+
+func (c *Config) SetFlags(fset *flag.FlagSet) {
+	fset.IntVar(&c.Workers, "queue.workers", 4, "number of concurrent task workers")
+	fset.DurationVar(&c.PollInterval, "queue.poll-interval", time.Second, "interval to check for ready tasks when idle")
+	fset.DurationVar(&c.Lease, "queue.lease", 5*time.Minute, "time a task may run before it is retried by another worker")
+	fset.IntVar(&c.MaxAttempts, "queue.max-attempts", 10, "attempts before a task is moved to the dead letters")
+	fset.DurationVar(&c.MinBackoff, "queue.min-backoff", time.Second, "delay before the first retry, doubled for each attempt")
+	fset.DurationVar(&c.MaxBackoff, "queue.max-backoff", time.Hour, "maximum delay between retries")
+}
+
+// Task is a unit of work from a queue.
+type Task struct {
+	ID      int64
+	Queue   string
+	Payload []byte
+	// Attempt counts from 1 for the first run.
+	Attempt int
+	// LastError is the error from the previous attempt, if any.
+	LastError string
+
+	// leasedUntil with Attempt identifies the worker's lease,
+	// so it doesn't update a task claimed by another worker after it expired.
+	leasedUntil int64
+}
+
+// Handler processes a task, returning an error to retry it.
+// It may be called more than once for a task.
+type Handler func(ctx context.Context, t *Task) error
+
+type Queue struct {
+	O  *observability.O
+	DB *sql.DB
+
+	conf      *Config
+	now       func() time.Time
+	processed metric.Int64Counter
+	wake      chan struct{}
+
+	mu       sync.Mutex
+	handlers map[string]Handler
+}
+
+// New creates the queue table in db if it doesn't exist.
+// db is usually from storage/sqlite.
+func New(ctx context.Context, o *observability.O, db *sql.DB, c *Config) (*Queue, error) {
+	o = o.Component("queue")
+
+	_, err := db.ExecContext(ctx, schema)
+	if err != nil {
+		return nil, o.Err(ctx, "create queue table", err)
+	}
+
+	q := &Queue{
+		O:        o,
+		DB:       db,
+		conf:     c,
+		now:      time.Now,
+		wake:     make(chan struct{}, 1),
+		handlers: make(map[string]Handler),
+	}
+
+	q.processed, _ = o.M.Int64Counter("queue.tasks.processed",
+		metric.WithDescription("tasks processed, by queue and result: success|retry|dead"),
+	)
+	depth, _ := o.M.Int64ObservableGauge("queue.depth",
+		metric.WithDescription("tasks waiting in the queue, by queue and whether they are dead letters"),
+	)
+	_, err = o.M.RegisterCallback(func(ctx context.Context, obs metric.Observer) error {
+		return q.observeDepth(ctx, obs, depth)
+	}, depth)
+	if err != nil {
+		return nil, o.Err(ctx, "register queue depth metric", err)
+	}
+	return q, nil
+}
+
+func (q *Queue) observeDepth(ctx context.Context, obs metric.Observer, depth metric.Int64ObservableGauge) error {
+	rows, err := q.DB.QueryContext(ctx, `SELECT queue, dead, count(*) FROM queue_tasks GROUP BY queue, dead`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var dead bool
+		var n int64
+		err := rows.Scan(&name, &dead, &n)
+		if err != nil {
+			return err
+		}
+		obs.ObserveInt64(depth, n, metric.WithAttributes(
+			attribute.String("queue", name),
+			attribute.Bool("dead", dead),
+		))
+	}
+	return rows.Err()
+}
+
+// Handle registers the handler for tasks in the named queue.
+// Only queues with handlers are processed by Run.
+func (q *Queue) Handle(name string, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[name] = h
+}
+
+// Enqueue adds a task to the named queue,
+// linking its processing to the trace in ctx.
+func (q *Queue) Enqueue(ctx context.Context, name string, payload []byte) (id int64, err error) {
+	ctx, span := q.O.T.Start(ctx, "queue.enqueue", trace.WithAttributes(
+		attribute.String("queue", name),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	tc, _ := json.Marshal(carrier)
+
+	now := q.now().UnixMilli()
+	err = q.DB.QueryRowContext(ctx,
+		`INSERT INTO queue_tasks (queue, payload, trace, run_at, created_at) VALUES (?, ?, ?, ?, ?) RETURNING id`,
+		name, payload, string(tc), now, now,
+	).Scan(&id)
+	if err != nil {
+		return 0, q.O.Err(ctx, "enqueue task", err, slog.String("queue", name))
+	}
+	span.SetAttributes(attribute.Int64("task.id", id))
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return id, nil
+}
+
+// Run processes tasks with the registered handlers until ctx is canceled,
+// for use as a framework worker.
+// Tasks interrupted by shutdown are retried.
+func (q *Queue) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for range max(q.conf.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// work processes tasks until ctx is canceled,
+// waiting for new tasks when the queue is empty.
+func (q *Queue) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		t, tc, err := q.claim(ctx)
+		if err != nil && ctx.Err() == nil {
+			q.O.Err(ctx, "claim task", err)
+		}
+		if t == nil {
+			select {
+			case <-ctx.Done():
+			case <-q.wake:
+			case <-time.After(q.conf.PollInterval):
+			}
+			continue
+		}
+		q.process(ctx, t, tc)
+	}
+}
+
+// claim leases the next ready task from the queues with handlers.
+// It returns a nil task if there are none.
+func (q *Queue) claim(ctx context.Context) (*Task, string, error) {
+	q.mu.Lock()
+	names := make([]any, 0, len(q.handlers))
+	for name := range q.handlers {
+		names = append(names, name)
+	}
+	q.mu.Unlock()
+	if len(names) == 0 {
+		return nil, "", nil
+	}
+
+	now := q.now()
+	args := append([]any{now.Add(q.conf.Lease).UnixMilli()}, names...)
+	args = append(args, now.UnixMilli(), now.UnixMilli())
+	query := `UPDATE queue_tasks SET leased_until = ?, attempts = attempts + 1
+WHERE id = (
+	SELECT id FROM queue_tasks
+	WHERE dead = 0 AND queue IN (?` + strings.Repeat(", ?", len(names)-1) + `) AND run_at <= ? AND leased_until <= ?
+	ORDER BY run_at, id LIMIT 1
+)
+RETURNING id, queue, payload, trace, attempts, last_error, leased_until`
+
+	var t Task
+	var tc string
+	err := q.DB.QueryRowContext(ctx, query, args...).Scan(&t.ID, &t.Queue, &t.Payload, &tc, &t.Attempt, &t.LastError, &t.leasedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+	return &t, tc, nil
+}
+
+// process runs the handler for t within its lease,
+// deleting it on success, or scheduling a retry or dead lettering it on failure.
+// The outcome is discarded if the lease expired and the task was claimed again.
+// Tasks failing because shutdown canceled ctx are released for another worker,
+// without counting the attempt.
+func (q *Queue) process(ctx context.Context, t *Task, tc string) {
+	var carrier propagation.MapCarrier
+	json.Unmarshal([]byte(tc), &carrier)
+	enqueued := trace.SpanContextFromContext(otel.GetTextMapPropagator().Extract(context.Background(), carrier))
+	ctx, span := q.O.T.Start(ctx, "queue.process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(trace.Link{SpanContext: enqueued}),
+		trace.WithAttributes(
+			attribute.String("queue", t.Queue),
+			attribute.Int64("task.id", t.ID),
+			attribute.Int("task.attempt", t.Attempt),
+		),
+	)
+	defer span.End()
+
+	q.mu.Lock()
+	h := q.handlers[t.Queue]
+	q.mu.Unlock()
+	hctx, cancel := context.WithTimeout(ctx, q.conf.Lease)
+	err := h(hctx, t)
+	cancel()
+
+	if err != nil && ctx.Err() != nil {
+		// interrupted by shutdown, release the task without counting the attempt
+		ctx = context.WithoutCancel(ctx)
+		_, rerr := q.update(ctx, t, `UPDATE queue_tasks SET leased_until = 0, attempts = attempts - 1 WHERE id = ?`, t.ID)
+		if rerr != nil {
+			q.O.Err(ctx, "release interrupted task", rerr, slog.Int64("task", t.ID))
+		}
+		q.O.L.LogAttrs(ctx, slog.LevelInfo, "task interrupted by shutdown, released",
+			slog.String("queue", t.Queue),
+			slog.Int64("task", t.ID),
+			slog.Int("attempt", t.Attempt),
+		)
+		return
+	}
+
+	// record the outcome even if shutdown canceled ctx
+	ctx = context.WithoutCancel(ctx)
+	result := "success"
+	var lost bool
+	if err == nil {
+		lost, err = q.update(ctx, t, `DELETE FROM queue_tasks WHERE id = ?`, t.ID)
+		if err != nil {
+			q.O.Err(ctx, "delete completed task", err, slog.Int64("task", t.ID))
+		}
+	} else {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if t.Attempt >= q.conf.MaxAttempts {
+			result = "dead"
+			var derr error
+			lost, derr = q.update(ctx, t,
+				`UPDATE queue_tasks SET dead = 1, leased_until = 0, last_error = ? WHERE id = ?`,
+				err.Error(), t.ID,
+			)
+			if derr != nil {
+				q.O.Err(ctx, "dead letter task", derr, slog.Int64("task", t.ID))
+			}
+			q.O.Err(ctx, "task failed permanently", err,
+				slog.String("queue", t.Queue),
+				slog.Int64("task", t.ID),
+				slog.Int("attempt", t.Attempt),
+			)
+		} else {
+			result = "retry"
+			backoff := q.backoff(t.Attempt)
+			var rerr error
+			lost, rerr = q.update(ctx, t,
+				`UPDATE queue_tasks SET run_at = ?, leased_until = 0, last_error = ? WHERE id = ?`,
+				q.now().Add(backoff).UnixMilli(), err.Error(), t.ID,
+			)
+			if rerr != nil {
+				q.O.Err(ctx, "schedule task retry", rerr, slog.Int64("task", t.ID))
+			}
+			q.O.L.LogAttrs(ctx, slog.LevelWarn, "task failed, retrying",
+				slog.String("queue", t.Queue),
+				slog.Int64("task", t.ID),
+				slog.Int("attempt", t.Attempt),
+				slog.Duration("backoff", backoff),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+	if lost {
+		q.O.L.LogAttrs(ctx, slog.LevelWarn, "task lease expired, outcome discarded",
+			slog.String("queue", t.Queue),
+			slog.Int64("task", t.ID),
+			slog.Int("attempt", t.Attempt),
+		)
+	}
+	q.processed.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("queue", t.Queue),
+		attribute.String("result", result),
+	))
+}
+
+// update runs query, which should match the task by id,
+// only if t is still leased by this worker,
+// reporting whether the lease was lost.
+func (q *Queue) update(ctx context.Context, t *Task, query string, args ...any) (lost bool, err error) {
+	res, err := q.DB.ExecContext(ctx, query+` AND attempts = ? AND leased_until = ?`, append(args, t.Attempt, t.leasedUntil)...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 0, err
+}
+
+// backoff is the delay before retrying after attempt,
+// doubling from MinBackoff up to MaxBackoff.
+func (q *Queue) backoff(attempt int) time.Duration {
+	d := q.conf.MinBackoff
+	for range attempt - 1 {
+		d *= 2
+		if d >= q.conf.MaxBackoff {
+			return q.conf.MaxBackoff
+		}
+	}
+	return min(d, q.conf.MaxBackoff)
+}
+
+// DeadLetters returns the tasks in the named queue that failed permanently.
+func (q *Queue) DeadLetters(ctx context.Context, name string) ([]Task, error) {
+	rows, err := q.DB.QueryContext(ctx,
+		`SELECT id, queue, payload, attempts, last_error FROM queue_tasks WHERE dead = 1 AND queue = ? ORDER BY id`,
+		name,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query dead letters: %w", err)
+	}
+	defer rows.Close()
+	var tasks []Task
+	for rows.Next() {
+		var t Task
+		err := rows.Scan(&t.ID, &t.Queue, &t.Payload, &t.Attempt, &t.LastError)
+		if err != nil {
+			return nil, fmt.Errorf("scan dead letter: %w", err)
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// Requeue moves a dead letter back into its queue,
+// resetting its attempts.
+func (q *Queue) Requeue(ctx context.Context, id int64) error {
+	res, err := q.DB.ExecContext(ctx,
+		`UPDATE queue_tasks SET dead = 0, attempts = 0, run_at = ? WHERE id = ? AND dead = 1`,
+		q.now().UnixMilli(), id,
+	)
+	if err != nil {
+		return fmt.Errorf("requeue task %d: %w", id, err)
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return fmt.Errorf("requeue task %d: not a dead letter", id)
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
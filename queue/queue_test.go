@@ -0,0 +1,280 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+	"go.seankhliao.com/svcrunner/v3/storage/sqlite"
+)
+
+func newQueue(t *testing.T) *Queue {
+	t.Helper()
+	ctx := context.Background()
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+	db, err := sqlite.New(ctx, o, &sqlite.Config{
+		Path:        filepath.Join(t.TempDir(), "queue.sqlite"),
+		JournalMode: "wal",
+		BusyTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	q, err := New(ctx, o, db.DB, &Config{
+		Workers:      2,
+		PollInterval: 10 * time.Millisecond,
+		Lease:        time.Minute,
+		MaxAttempts:  3,
+		MinBackoff:   time.Millisecond,
+		MaxBackoff:   10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestQueue(t *testing.T) {
+	t.Parallel()
+
+	q := newQueue(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	done := make(chan struct{})
+	var got []string
+	attempts := map[string]int{}
+	q.Handle("email", func(ctx context.Context, task *Task) error {
+		mu.Lock()
+		defer mu.Unlock()
+		p := string(task.Payload)
+		attempts[p]++
+		switch p {
+		case "flaky":
+			if task.Attempt == 1 {
+				return errors.New("temporary")
+			}
+		case "broken":
+			if task.Attempt == 3 {
+				defer close(done)
+			}
+			return errors.New("permanent")
+		}
+		got = append(got, p)
+		return nil
+	})
+
+	for _, p := range []string{"ok", "flaky", "broken"} {
+		_, err := q.Enqueue(ctx, "email", []byte(p))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := q.Enqueue(ctx, "unhandled", []byte("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runDone := make(chan error)
+	go func() { runDone <- q.Run(ctx) }()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for tasks")
+	}
+	// wait for the flaky retry and the dead letter to be recorded
+	var dead []Task
+	for range 100 {
+		dead, err = q.DeadLetters(ctx, "email")
+		if err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		n := len(got)
+		mu.Unlock()
+		if len(dead) == 1 && n == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-runDone
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts["ok"] != 1 || attempts["flaky"] != 2 || attempts["broken"] != 3 {
+		t.Errorf("attempts = %v", attempts)
+	}
+	if len(dead) != 1 || string(dead[0].Payload) != "broken" || dead[0].LastError != "permanent" {
+		t.Fatalf("dead letters = %+v", dead)
+	}
+
+	err = q.Requeue(context.Background(), dead[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead, _ = q.DeadLetters(context.Background(), "email")
+	if len(dead) != 0 {
+		t.Errorf("dead letters after requeue = %+v", dead)
+	}
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	t.Parallel()
+
+	q := newQueue(t)
+	ctx := context.Background()
+	q.Handle("jobs", func(ctx context.Context, task *Task) error { return nil })
+	_, err := q.Enqueue(ctx, "jobs", []byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task, _, err := q.claim(ctx)
+	if err != nil || task == nil {
+		t.Fatalf("claim = %v, %v", task, err)
+	}
+	// leased tasks aren't given to other workers
+	again, _, err := q.claim(ctx)
+	if err != nil || again != nil {
+		t.Fatalf("claim leased = %v, %v", again, err)
+	}
+	// until the lease expires, as after a crash
+	q.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	again, _, err = q.claim(ctx)
+	if err != nil || again == nil || again.ID != task.ID || again.Attempt != 2 {
+		t.Fatalf("claim expired = %+v, %v", again, err)
+	}
+}
+
+func TestLeaseLost(t *testing.T) {
+	t.Parallel()
+
+	q := newQueue(t)
+	ctx := context.Background()
+	q.Handle("jobs", func(ctx context.Context, task *Task) error { return nil })
+	_, err := q.Enqueue(ctx, "jobs", []byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stale, tc, err := q.claim(ctx)
+	if err != nil || stale == nil {
+		t.Fatalf("claim = %v, %v", stale, err)
+	}
+	q.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	current, _, err := q.claim(ctx)
+	if err != nil || current == nil {
+		t.Fatalf("claim expired = %v, %v", current, err)
+	}
+
+	// the first worker finishing doesn't complete the reclaimed task
+	q.process(ctx, stale, tc)
+	var leasedUntil int64
+	err = q.DB.QueryRowContext(ctx, `SELECT leased_until FROM queue_tasks WHERE id = ?`, current.ID).Scan(&leasedUntil)
+	if err != nil {
+		t.Fatalf("task after stale completion: %v", err)
+	}
+	if leasedUntil != current.leasedUntil {
+		t.Errorf("leased_until = %d, want %d", leasedUntil, current.leasedUntil)
+	}
+}
+
+func TestHandlerLease(t *testing.T) {
+	t.Parallel()
+
+	q := newQueue(t)
+	q.conf.Lease = 10 * time.Millisecond
+	ctx := context.Background()
+	q.Handle("jobs", func(ctx context.Context, task *Task) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	_, err := q.Enqueue(ctx, "jobs", []byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, tc, err := q.claim(ctx)
+	if err != nil || task == nil {
+		t.Fatalf("claim = %v, %v", task, err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.process(ctx, task, tc)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("handler not canceled after lease")
+	}
+}
+
+func TestShutdownRelease(t *testing.T) {
+	t.Parallel()
+
+	q := newQueue(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	q.Handle("jobs", func(ctx context.Context, task *Task) error {
+		cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	_, err := q.Enqueue(ctx, "jobs", []byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, tc, err := q.claim(ctx)
+	if err != nil || task == nil {
+		t.Fatalf("claim = %v, %v", task, err)
+	}
+	var runAt int64
+	err = q.DB.QueryRowContext(ctx, `SELECT run_at FROM queue_tasks WHERE id = ?`, task.ID).Scan(&runAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.process(ctx, task, tc)
+
+	// the task is immediately available again, as its first attempt
+	again, _, err := q.claim(context.Background())
+	if err != nil || again == nil {
+		t.Fatalf("claim released = %v, %v", again, err)
+	}
+	if again.Attempt != 1 || again.LastError != "" {
+		t.Errorf("released task = %+v, want attempt 1 without error", again)
+	}
+	var gotRunAt int64
+	err = q.DB.QueryRowContext(context.Background(), `SELECT run_at FROM queue_tasks WHERE id = ?`, task.ID).Scan(&gotRunAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotRunAt != runAt {
+		t.Errorf("run_at = %d, want unchanged %d", gotRunAt, runAt)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+
+	q := &Queue{conf: &Config{MinBackoff: time.Second, MaxBackoff: 10 * time.Second}}
+	for attempt, want := range map[int]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		4: 8 * time.Second,
+		5: 10 * time.Second,
+		9: 10 * time.Second,
+	} {
+		if got := q.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/secretmanager/v1"
+)
+
+// Env reads secrets from environment variables,
+// named by Prefix followed by the secret name.
+type Env struct {
+	Prefix string
+}
+
+func (e Env) Secret(ctx context.Context, name string) ([]byte, error) {
+	v, ok := os.LookupEnv(e.Prefix + name)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return []byte(v), nil
+}
+
+// Files reads secrets from files in Dir,
+// such as mounted kubernetes secrets.
+// A single trailing newline is removed.
+type Files struct {
+	Dir string
+}
+
+func (f Files) Secret(ctx context.Context, name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, fmt.Errorf("invalid secret name: %q", name)
+	}
+	b, err := os.ReadFile(filepath.Join(f.Dir, filepath.FromSlash(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	b = bytes.TrimSuffix(b, []byte("\n"))
+	return b, nil
+}
+
+// GCP reads secrets from GCP Secret Manager.
+type GCP struct {
+	Project string
+
+	svc *secretmanager.Service
+}
+
+func NewGCP(ctx context.Context, project string) (*GCP, error) {
+	svc, err := secretmanager.NewService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create secret manager client: %w", err)
+	}
+	return &GCP{
+		Project: project,
+		svc:     svc,
+	}, nil
+}
+
+// Secret accesses a secret version,
+// name is either a full resource name
+// projects/*/secrets/*/versions/*,
+// or a secret in Project, using the latest version.
+func (g *GCP) Secret(ctx context.Context, name string) ([]byte, error) {
+	if !strings.HasPrefix(name, "projects/") {
+		name = "projects/" + g.Project + "/secrets/" + name + "/versions/latest"
+	}
+	res, err := g.svc.Projects.Secrets.Versions.Access(name).Context(ctx).Do()
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) && gerr.Code == http.StatusNotFound {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(res.Payload.Data)
+}
@@ -0,0 +1,176 @@
+// Package secret reads secrets from the environment, files,
+// or GCP Secret Manager, caching them and notifying on rotation.
+package secret
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+// ErrNotFound is returned for secrets that don't exist.
+var ErrNotFound = errors.New("secret not found")
+
+// Provider looks up the current value of secrets by name.
+// Set as framework.Config.Secrets,
+// it resolves flags from environment variables set to secret://name.
+type Provider interface {
+	Secret(ctx context.Context, name string) ([]byte, error)
+}
+
+type Config struct {
+	// Source selects the provider:
+	//
+	//	env
+	//	file:///path/to/dir
+	//	gcp://project
+	Source string
+	// Refresh is how often cached secrets are read again
+	// to detect rotation.
+	Refresh time.Duration
+}
+
+func (c *Config) SetFlags(fset *flag.FlagSet) {
+	fset.StringVar(&c.Source, "secret.source", "env", "secret provider: env, file:///dir, or gcp://project")
+	fset.DurationVar(&c.Refresh, "secret.refresh", 5*time.Minute, "interval to refresh cached secrets, 0 to cache forever")
+}
+
+// Cache caches secrets from a Provider.
+// Run refreshes them, calling the OnRotate callbacks for changed values.
+type Cache struct {
+	O        *observability.O
+	Provider Provider
+
+	refresh time.Duration
+
+	mu      sync.Mutex
+	values  map[string][]byte
+	rotated map[string][]func(context.Context, []byte)
+}
+
+// New creates the provider selected by c.Source, wrapped in a Cache.
+func New(ctx context.Context, o *observability.O, c *Config) (*Cache, error) {
+	o = o.Component("secret")
+
+	u, err := url.Parse(c.Source)
+	if err != nil {
+		return nil, o.Err(ctx, "parse secret source", err)
+	}
+	var p Provider
+	switch u.Scheme {
+	case "":
+		if u.Path != "env" {
+			err = fmt.Errorf("unknown secret source: %q", c.Source)
+		}
+		p = Env{}
+	case "file":
+		p = Files{Dir: u.Path}
+	case "gcp":
+		p, err = NewGCP(ctx, u.Host)
+	default:
+		err = fmt.Errorf("unsupported scheme: %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, o.Err(ctx, "create secret provider", err, slog.String("source", c.Source))
+	}
+	return NewCache(o, p, c.Refresh), nil
+}
+
+// NewCache caches secrets from p,
+// refreshed every refresh by Run.
+func NewCache(o *observability.O, p Provider, refresh time.Duration) *Cache {
+	return &Cache{
+		O:        o,
+		Provider: p,
+		refresh:  refresh,
+		values:   make(map[string][]byte),
+		rotated:  make(map[string][]func(context.Context, []byte)),
+	}
+}
+
+// Secret returns the cached value of name,
+// reading it from the provider on first use.
+func (c *Cache) Secret(ctx context.Context, name string) ([]byte, error) {
+	c.mu.Lock()
+	v, ok := c.values[name]
+	c.mu.Unlock()
+	if ok {
+		return v, nil
+	}
+
+	v, err := c.Provider.Secret(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("get secret %s: %w", name, err)
+	}
+	c.mu.Lock()
+	c.values[name] = v
+	c.mu.Unlock()
+	return v, nil
+}
+
+// OnRotate registers f to be called with the new value
+// when Run finds name has changed,
+// such as to recreate clients with rotated credentials.
+func (c *Cache) OnRotate(name string, f func(ctx context.Context, value []byte)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rotated[name] = append(c.rotated[name], f)
+}
+
+// Run refreshes cached secrets until ctx is canceled,
+// for use as a framework worker.
+// Errors are logged, keeping the previous value.
+func (c *Cache) Run(ctx context.Context) error {
+	if c.refresh <= 0 {
+		return nil
+	}
+	ticker := time.NewTicker(c.refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			c.Refresh(ctx)
+		}
+	}
+}
+
+// Refresh reads all cached secrets again,
+// calling the OnRotate callbacks for changed values.
+func (c *Cache) Refresh(ctx context.Context) {
+	c.mu.Lock()
+	names := make([]string, 0, len(c.values))
+	for name := range c.values {
+		names = append(names, name)
+	}
+	c.mu.Unlock()
+
+	for _, name := range names {
+		v, err := c.Provider.Secret(ctx, name)
+		if err != nil {
+			c.O.Err(ctx, "refresh secret", err, slog.String("secret", name))
+			continue
+		}
+		c.mu.Lock()
+		changed := !bytes.Equal(c.values[name], v)
+		c.values[name] = v
+		callbacks := c.rotated[name]
+		c.mu.Unlock()
+		if !changed {
+			continue
+		}
+		c.O.L.LogAttrs(ctx, slog.LevelInfo, "secret rotated", slog.String("secret", name))
+		for _, f := range callbacks {
+			f(ctx, v)
+		}
+	}
+}
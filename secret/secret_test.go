@@ -0,0 +1,85 @@
+package secret
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "token"), []byte("one\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(ctx, o, &Config{Source: "file://" + dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := c.Secret(ctx, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(v) != "one" {
+		t.Errorf("secret = %q, want one", v)
+	}
+	_, err = c.Secret(ctx, "missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing secret = %v, want %v", err, ErrNotFound)
+	}
+
+	var rotated []string
+	c.OnRotate("token", func(ctx context.Context, v []byte) {
+		rotated = append(rotated, string(v))
+	})
+	c.Refresh(ctx)
+	if len(rotated) != 0 {
+		t.Errorf("rotated unchanged secret: %v", rotated)
+	}
+	err = os.WriteFile(filepath.Join(dir, "token"), []byte("two"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Refresh(ctx)
+	if len(rotated) != 1 || rotated[0] != "two" {
+		t.Errorf("rotated = %v, want [two]", rotated)
+	}
+	v, _ = c.Secret(ctx, "token")
+	if string(v) != "two" {
+		t.Errorf("secret after refresh = %q, want two", v)
+	}
+
+	// errors keep the previous value
+	os.Remove(filepath.Join(dir, "token"))
+	c.Refresh(ctx)
+	v, _ = c.Secret(ctx, "token")
+	if string(v) != "two" {
+		t.Errorf("secret after failed refresh = %q, want two", v)
+	}
+}
+
+func TestEnv(t *testing.T) {
+	t.Setenv("APP_DB_PASSWORD", "hunter2")
+
+	v, err := Env{Prefix: "APP_"}.Secret(context.Background(), "DB_PASSWORD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(v) != "hunter2" {
+		t.Errorf("secret = %q, want hunter2", v)
+	}
+	_, err = Env{Prefix: "APP_"}.Secret(context.Background(), "MISSING")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing secret = %v, want %v", err, ErrNotFound)
+	}
+}
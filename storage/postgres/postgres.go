@@ -0,0 +1,144 @@
+// Package postgres connects to PostgreSQL with an instrumented pgx pool.
+package postgres
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/exaring/otelpgx"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+type Config struct {
+	// DSN is a connection string or url, read from $DATABASE_URL if empty,
+	// see https://pkg.go.dev/github.com/jackc/pgx/v5/pgxpool#ParseConfig
+	DSN             string
+	MaxConns        int
+	MinConns        int
+	ConnectTimeout  time.Duration
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+	// StartupTimeout limits retrying the first ping,
+	// such as while a database starts alongside the application.
+	StartupTimeout time.Duration
+}
+
+func (c *Config) SetFlags(fset *flag.FlagSet) {
+	fset.StringVar(&c.DSN, "postgres.dsn", "", "postgres connection string or url, defaults to $DATABASE_URL")
+	fset.IntVar(&c.MaxConns, "postgres.max-conns", 0, "maximum pool connections, 0 for the pgx default")
+	fset.IntVar(&c.MinConns, "postgres.min-conns", 0, "minimum idle pool connections")
+	fset.DurationVar(&c.ConnectTimeout, "postgres.connect-timeout", 5*time.Second, "timeout for establishing a connection")
+	fset.DurationVar(&c.MaxConnLifetime, "postgres.max-conn-lifetime", time.Hour, "close connections after this age")
+	fset.DurationVar(&c.MaxConnIdleTime, "postgres.max-conn-idle-time", 30*time.Minute, "close connections idle for this long")
+	fset.DurationVar(&c.StartupTimeout, "postgres.startup-timeout", 30*time.Second, "time to retry connecting at startup")
+}
+
+// poolConfig parses the DSN and applies the pool settings.
+func (c *Config) poolConfig() (*pgxpool.Config, error) {
+	dsn := c.DSN
+	if dsn == "" {
+		// not the flag default, which would print the password in the usage
+		dsn = os.Getenv("DATABASE_URL")
+	}
+	pc, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if c.MaxConns > 0 {
+		pc.MaxConns = int32(c.MaxConns)
+	}
+	if c.MinConns > 0 {
+		pc.MinConns = int32(c.MinConns)
+	}
+	if c.ConnectTimeout > 0 {
+		pc.ConnConfig.ConnectTimeout = c.ConnectTimeout
+	}
+	if c.MaxConnLifetime > 0 {
+		pc.MaxConnLifetime = c.MaxConnLifetime
+	}
+	if c.MaxConnIdleTime > 0 {
+		pc.MaxConnIdleTime = c.MaxConnIdleTime
+	}
+	pc.ConnConfig.Tracer = otelpgx.NewTracer()
+	return pc, nil
+}
+
+type Pool struct {
+	O    *observability.O
+	Pool *pgxpool.Pool
+}
+
+// New creates the pool with spans for queries and pool metrics,
+// retrying the first ping until StartupTimeout.
+// Close it in the cleanup returned from framework.Config.Start,
+// after the servers have stopped.
+func New(ctx context.Context, o *observability.O, c *Config) (*Pool, error) {
+	o = o.Component("postgres")
+
+	pc, err := c.poolConfig()
+	if err != nil {
+		return nil, o.Err(ctx, "parse postgres config", err)
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, pc)
+	if err != nil {
+		return nil, o.Err(ctx, "create postgres pool", err)
+	}
+	err = otelpgx.RecordStats(pool)
+	if err != nil {
+		pool.Close()
+		return nil, o.Err(ctx, "record postgres pool stats", err)
+	}
+
+	err = ping(ctx, o, pool, c.StartupTimeout)
+	if err != nil {
+		pool.Close()
+		return nil, o.Err(ctx, "connect to postgres", err,
+			slog.String("host", pc.ConnConfig.Host),
+			slog.String("database", pc.ConnConfig.Database),
+		)
+	}
+	o.L.LogAttrs(ctx, slog.LevelInfo, "connected to postgres",
+		slog.String("host", pc.ConnConfig.Host),
+		slog.String("database", pc.ConnConfig.Database),
+	)
+
+	return &Pool{
+		O:    o,
+		Pool: pool,
+	}, nil
+}
+
+// ping pings the database until it succeeds or timeout passes,
+// backing off between attempts.
+func ping(ctx context.Context, o *observability.O, pool *pgxpool.Pool, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	backoff := 100 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := pool.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+		o.L.LogAttrs(ctx, slog.LevelWarn, "ping postgres",
+			slog.Int("attempt", attempt),
+			slog.Duration("backoff", backoff),
+			slog.String("error", err.Error()),
+		)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, 5*time.Second)
+	}
+}
+
+// Close closes all connections in the pool.
+func (p *Pool) Close() {
+	p.Pool.Close()
+}
@@ -0,0 +1,125 @@
+// Package sqlite opens instrumented SQLite databases,
+// configured for concurrent use by a server.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+	_ "modernc.org/sqlite"
+)
+
+type Config struct {
+	// Path to the database file, or :memory: for an in memory database.
+	Path        string
+	JournalMode string
+	Synchronous string
+	BusyTimeout time.Duration
+	// Pragmas are additional name=value pragmas set on every connection.
+	Pragmas []string
+	// MaxOpenConns limits open connections, 0 for no limit.
+	MaxOpenConns int
+}
+
+func (c *Config) SetFlags(fset *flag.FlagSet) {
+	fset.StringVar(&c.Path, "sqlite.path", "data.sqlite", "path to the sqlite database file")
+	fset.StringVar(&c.JournalMode, "sqlite.journal-mode", "wal", "sqlite journal mode")
+	fset.StringVar(&c.Synchronous, "sqlite.synchronous", "normal", "sqlite synchronous setting")
+	fset.DurationVar(&c.BusyTimeout, "sqlite.busy-timeout", 5*time.Second, "time to wait for locks held by other connections")
+	fset.Func("sqlite.pragma", "additional pragma set on connections, repeatable: name=value", func(s string) error {
+		name, value, ok := strings.Cut(s, "=")
+		if !ok || name == "" || value == "" {
+			return fmt.Errorf("expected name=value: %q", s)
+		}
+		c.Pragmas = append(c.Pragmas, s)
+		return nil
+	})
+	fset.IntVar(&c.MaxOpenConns, "sqlite.max-open-conns", 0, "maximum open connections, 0 for no limit")
+}
+
+// dsn is the connection string for the modernc.org/sqlite driver,
+// setting pragmas on each new connection.
+func (c *Config) dsn() string {
+	q := url.Values{}
+	if c.JournalMode != "" {
+		q.Add("_pragma", "journal_mode("+c.JournalMode+")")
+	}
+	if c.Synchronous != "" {
+		q.Add("_pragma", "synchronous("+c.Synchronous+")")
+	}
+	if c.BusyTimeout > 0 {
+		q.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", c.BusyTimeout.Milliseconds()))
+	}
+	q.Add("_pragma", "foreign_keys(1)")
+	for _, p := range c.Pragmas {
+		name, value, _ := strings.Cut(p, "=")
+		q.Add("_pragma", name+"("+value+")")
+	}
+	// take the write lock at the start of transactions,
+	// instead of failing to upgrade later
+	q.Set("_txlock", "immediate")
+	// sqlite decodes the path as a uri,
+	// so escape characters such as ? # and %
+	u := url.URL{
+		Scheme:   "file",
+		Opaque:   (&url.URL{Path: c.Path}).EscapedPath(),
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
+
+type DB struct {
+	O  *observability.O
+	DB *sql.DB
+
+	conf *Config
+}
+
+// New opens and pings the database,
+// with spans for queries and connection pool metrics.
+// Close it in the cleanup returned from framework.Config.Start,
+// after the servers have stopped.
+func New(ctx context.Context, o *observability.O, c *Config) (*DB, error) {
+	o = o.Component("sqlite")
+
+	db, err := o.WrapDB("sqlite", c.dsn())
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(c.MaxOpenConns)
+	if c.Path == ":memory:" {
+		// each connection would be its own database
+		db.SetMaxOpenConns(1)
+	}
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, o.Err(ctx, "ping sqlite", err, slog.String("path", c.Path))
+	}
+	o.L.LogAttrs(ctx, slog.LevelInfo, "opened sqlite database",
+		slog.String("path", c.Path),
+		slog.String("journal_mode", c.JournalMode),
+	)
+
+	return &DB{
+		O:    o,
+		DB:   db,
+		conf: c,
+	}, nil
+}
+
+// Close closes the database.
+func (d *DB) Close() error {
+	err := d.DB.Close()
+	if err != nil {
+		return d.O.Err(context.Background(), "close sqlite", err, slog.String("path", d.conf.Path))
+	}
+	return nil
+}
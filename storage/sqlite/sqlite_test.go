@@ -0,0 +1,120 @@
+package sqlite
+
+import (
+	"context"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+
+	c := &Config{}
+	fset := flag.NewFlagSet("", flag.ContinueOnError)
+	c.SetFlags(fset)
+	err := fset.Parse([]string{
+		"-sqlite.path=" + filepath.Join(t.TempDir(), "test.sqlite"),
+		"-sqlite.pragma=cache_size=-2000",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := New(ctx, o, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, tc := range []struct {
+		pragma string
+		want   string
+	}{
+		{"journal_mode", "wal"},
+		{"busy_timeout", "5000"},
+		{"cache_size", "-2000"},
+		{"foreign_keys", "1"},
+	} {
+		var got string
+		err := db.DB.QueryRowContext(ctx, "PRAGMA "+tc.pragma).Scan(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("%s = %q, want %q", tc.pragma, got, tc.want)
+		}
+	}
+
+	_, err = db.DB.ExecContext(ctx, `CREATE TABLE kv (k TEXT PRIMARY KEY, v TEXT)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO kv VALUES (?, ?)`, "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v string
+	err = db.DB.QueryRowContext(ctx, `SELECT v FROM kv WHERE k = ?`, "a").Scan(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "b" {
+		t.Errorf("v = %q, want b", v)
+	}
+}
+
+func TestInvalidPragma(t *testing.T) {
+	t.Parallel()
+
+	fset := flag.NewFlagSet("", flag.ContinueOnError)
+	fset.SetOutput(io.Discard)
+	(&Config{}).SetFlags(fset)
+	err := fset.Parse([]string{"-sqlite.pragma=cache_size"})
+	if err == nil {
+		t.Errorf("expected error for pragma without value")
+	}
+}
+
+func TestPathEscaping(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+
+	for _, name := range []string{
+		"a?mode=ro.sqlite",
+		"b#frag.sqlite",
+		"c%20d e.sqlite",
+	} {
+		path := filepath.Join(t.TempDir(), name)
+		db, err := New(ctx, o, &Config{Path: path, JournalMode: "wal"})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		_, err = db.DB.ExecContext(ctx, `CREATE TABLE kv (k TEXT PRIMARY KEY, v TEXT)`)
+		db.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		_, err = os.Stat(path)
+		if err != nil {
+			t.Errorf("%s: database not created at path: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package tshttp
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// origin is where a connection was accepted from.
+type origin int
+
+const (
+	// originLocal connections were accepted on a local address outside the tailnet,
+	// and connections from unknown listeners are treated the same.
+	originLocal origin = iota
+	// originTailnet connections came from another node on the tailnet.
+	originTailnet
+	// originFunnel connections came from the public internet through funnel.
+	originFunnel
+)
+
+type originKey struct{}
+
+// FromFunnel reports whether the request context belongs to a connection
+// from the public internet through tailscale funnel.
+func FromFunnel(ctx context.Context) bool {
+	o, _ := ctx.Value(originKey{}).(origin)
+	return o == originFunnel
+}
+
+// FromTailnet reports whether the request context belongs to a connection
+// from another node on the tailnet.
+func FromTailnet(ctx context.Context) bool {
+	o, _ := ctx.Value(originKey{}).(origin)
+	return o == originTailnet
+}
+
+// originListener records the origin of the connections it accepts,
+// to be looked up by withOrigin.
+type originListener struct {
+	net.Listener
+	tailnet bool
+	origins *sync.Map
+}
+
+func (l *originListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	o := originLocal
+	if l.tailnet {
+		// funnel listeners also accept connections from the tailnet
+		o = originTailnet
+		if isFunnel(c) {
+			o = originFunnel
+		}
+	}
+	l.origins.Store(c, o)
+	return c, nil
+}
+
+// withOrigin marks where a connection was accepted from.
+func withOrigin(ctx context.Context, origins *sync.Map, c net.Conn) context.Context {
+	v, _ := origins.LoadAndDelete(c)
+	o, _ := v.(origin)
+	return context.WithValue(ctx, originKey{}, o)
+}
+
+// routeFunnel serves requests from outside the tailnet,
+// through funnel or a local listener, only from public.
+// Tailnet requests are served from public if they match a route there,
+// and private otherwise.
+func routeFunnel(public *http.ServeMux, private http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !FromTailnet(r.Context()) {
+			public.ServeHTTP(rw, r)
+			return
+		}
+		if _, pattern := public.Handler(r); pattern != "" {
+			public.ServeHTTP(rw, r)
+			return
+		}
+		private.ServeHTTP(rw, r)
+	})
+}
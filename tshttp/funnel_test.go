@@ -0,0 +1,101 @@
+package tshttp
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestRouteFunnel(t *testing.T) {
+	t.Parallel()
+
+	public := http.NewServeMux()
+	public.HandleFunc("/webhook", func(rw http.ResponseWriter, r *http.Request) {
+		io.WriteString(rw, "public")
+	})
+	private := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		io.WriteString(rw, "private")
+	})
+	h := routeFunnel(public, private)
+
+	tcs := []struct {
+		name     string
+		origin   origin
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"funnel public", originFunnel, "/webhook", http.StatusOK, "public"},
+		{"funnel private", originFunnel, "/admin", http.StatusNotFound, ""},
+		{"local public", originLocal, "/webhook", http.StatusOK, "public"},
+		{"local private", originLocal, "/admin", http.StatusNotFound, ""},
+		{"tailnet public", originTailnet, "/webhook", http.StatusOK, "public"},
+		{"tailnet private", originTailnet, "/admin", http.StatusOK, "private"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.WithValue(context.Background(), originKey{}, tc.origin)
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil).WithContext(ctx)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tc.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantCode)
+			}
+			if tc.wantBody != "" && rec.Body.String() != tc.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tc.wantBody)
+			}
+		})
+	}
+}
+
+func TestOriginListener(t *testing.T) {
+	t.Parallel()
+
+	origins := &sync.Map{}
+	for _, tc := range []struct {
+		name    string
+		tailnet bool
+		want    bool
+	}{
+		{"tailnet", true, true},
+		{"local", false, false},
+	} {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer lis.Close()
+		ol := &originListener{Listener: lis, tailnet: tc.tailnet, origins: origins}
+
+		go func() {
+			c, err := net.Dial("tcp", lis.Addr().String())
+			if err == nil {
+				c.Close()
+			}
+		}()
+		c, err := ol.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Close()
+
+		ctx := withOrigin(context.Background(), origins, c)
+		if got := FromTailnet(ctx); got != tc.want {
+			t.Errorf("%s: FromTailnet = %v, want %v", tc.name, got, tc.want)
+		}
+		if FromFunnel(ctx) {
+			t.Errorf("%s: FromFunnel = true", tc.name)
+		}
+	}
+
+	// connections from unknown listeners are not trusted
+	if FromTailnet(withOrigin(context.Background(), origins, &net.TCPConn{})) {
+		t.Errorf("unknown connection: FromTailnet = true")
+	}
+}
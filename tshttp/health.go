@@ -0,0 +1,62 @@
+package tshttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"tailscale.com/ipn"
+)
+
+// Ready reports whether the node can accept tailnet traffic:
+// it is serving, connected and logged in,
+// and has a certificate if any listener serves https.
+// Use it as a readiness check:
+//
+//	h.Health.AddCheck("tailscale", ts.Ready)
+func (s *Server) Ready(ctx context.Context) error {
+	if !s.serving.Load() {
+		return errors.New("not serving")
+	}
+	lc, err := s.TS.LocalClient()
+	if err != nil {
+		return fmt.Errorf("get local client: %w", err)
+	}
+	st, err := lc.StatusWithoutPeers(ctx)
+	if err != nil {
+		return fmt.Errorf("get status: %w", err)
+	}
+	if st.BackendState != ipn.Running.String() {
+		return fmt.Errorf("backend state is %s", st.BackendState)
+	}
+	if st.Self == nil || !st.Self.Online {
+		return errors.New("node is offline")
+	}
+
+	if !s.needsCert() || s.haveCert.Load() {
+		return nil
+	}
+	if len(st.CertDomains) == 0 {
+		return errors.New("no certificate domains, enable https for the tailnet")
+	}
+	// fetched once, then renewed in the background by tailscale
+	_, _, err = lc.CertPair(ctx, st.CertDomains[0])
+	if err != nil {
+		return fmt.Errorf("get certificate: %w", err)
+	}
+	s.haveCert.Store(true)
+	return nil
+}
+
+// needsCert reports whether any listener serves https.
+func (s *Server) needsCert() bool {
+	if s.conf.LocalTLSAddress != "" {
+		return true
+	}
+	for _, l := range s.conf.Listeners {
+		if l.Mode != "tailnet" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package tshttp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Listener is a port to serve on the tailnet.
+type Listener struct {
+	// Mode is one of:
+	// tailnet for plain http,
+	// tls for https with a certificate issued by tailscale,
+	// funnel for https that is also reachable from the internet.
+	Mode string
+	Port uint16
+}
+
+func (l Listener) String() string {
+	return l.Mode + ":" + strconv.Itoa(int(l.Port))
+}
+
+// Listeners is a flag.Value of comma separated mode:port listeners.
+type Listeners []Listener
+
+func (l *Listeners) String() string {
+	if l == nil {
+		return ""
+	}
+	var parts []string
+	for _, lis := range *l {
+		parts = append(parts, lis.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *Listeners) Set(s string) error {
+	var listeners Listeners
+	seen := make(map[uint16]bool)
+	for _, part := range strings.Split(s, ",") {
+		mode, portStr, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return fmt.Errorf("invalid listener %q, expected mode:port", part)
+		}
+		switch mode {
+		case "tailnet", "tls", "funnel":
+		default:
+			return fmt.Errorf("unknown listener mode: %q", mode)
+		}
+		port, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil || port == 0 {
+			return fmt.Errorf("invalid listener port: %q", portStr)
+		}
+		if seen[uint16(port)] {
+			return fmt.Errorf("duplicate listener port: %d", port)
+		}
+		seen[uint16(port)] = true
+		listeners = append(listeners, Listener{Mode: mode, Port: uint16(port)})
+	}
+	*l = listeners
+	return nil
+}
+
+// listenTailnet listens on the tailnet according to the listener mode.
+func (s *Server) listenTailnet(l Listener) (net.Listener, error) {
+	addr := ":" + strconv.Itoa(int(l.Port))
+	switch l.Mode {
+	case "tailnet":
+		return s.TS.Listen("tcp", addr)
+	case "funnel":
+		return s.TS.ListenFunnel("tcp", addr)
+	default:
+		return s.TS.ListenTLS("tcp", addr)
+	}
+}
+
+type portKey struct{}
+
+// HandlePort serves connections to a tailnet port with h
+// instead of the default handler.
+// Funnel and local connections are still only served Public routes.
+// It must be called before Run or Start.
+func (s *Server) HandlePort(port uint16, h http.Handler) {
+	s.ports[port] = h
+}
+
+// routePort serves requests with the handler for the port
+// their connection arrived on, or the default handler.
+func routePort(ports map[uint16]http.Handler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		port, _ := r.Context().Value(portKey{}).(uint16)
+		if h, ok := ports[port]; ok {
+			h.ServeHTTP(rw, r)
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// withPort records the local port of a connection.
+func withPort(ctx context.Context, c net.Conn) context.Context {
+	_, portStr, err := net.SplitHostPort(c.LocalAddr().String())
+	if err != nil {
+		return ctx
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, portKey{}, uint16(port))
+}
@@ -0,0 +1,78 @@
+package tshttp
+
+import (
+	"context"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListeners(t *testing.T) {
+	t.Parallel()
+
+	tcs := []struct {
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{nil, "tls:443", false},
+		{[]string{"-tailscale.listen=tailnet:80,tls:443,funnel:8443"}, "tailnet:80,tls:443,funnel:8443", false},
+		{[]string{"-tailscale.listen=funnel:443"}, "funnel:443", false},
+		{[]string{"-tailscale.listen=public:443"}, "", true},
+		{[]string{"-tailscale.listen=tls"}, "", true},
+		{[]string{"-tailscale.listen=tls:0"}, "", true},
+		{[]string{"-tailscale.listen=tls:443,tailnet:443"}, "", true},
+	}
+	for _, tc := range tcs {
+		fset := flag.NewFlagSet("test", flag.ContinueOnError)
+		fset.SetOutput(io.Discard)
+		c := &Config{}
+		c.SetFlags(fset)
+		err := fset.Parse(tc.args)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%v: expected error", tc.args)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%v: unexpected error: %v", tc.args, err)
+			continue
+		}
+		if got := c.Listeners.String(); got != tc.want {
+			t.Errorf("%v: listeners = %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestRoutePort(t *testing.T) {
+	t.Parallel()
+
+	named := func(name string) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			io.WriteString(rw, name)
+		})
+	}
+	h := routePort(map[uint16]http.Handler{8443: named("admin")}, named("default"))
+
+	tcs := []struct {
+		port uint16
+		want string
+	}{
+		{443, "default"},
+		{8443, "admin"},
+		{0, "default"},
+	}
+	for _, tc := range tcs {
+		ctx := context.Background()
+		if tc.port != 0 {
+			ctx = context.WithValue(ctx, portKey{}, tc.port)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		if got := rec.Body.String(); got != tc.want {
+			t.Errorf("port %d: served by %q, want %q", tc.port, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package tshttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"tailscale.com/ipn"
+)
+
+// metrics describe tailnet traffic,
+// which tsnet otherwise only reports in debug logs.
+type metrics struct {
+	connections     metric.Int64UpDownCounter
+	requests        metric.Int64Counter
+	handshakeErrors metric.Int64Counter
+}
+
+func newMetrics(m metric.Meter) *metrics {
+	t := &metrics{}
+	t.connections, _ = m.Int64UpDownCounter("tshttp.connections",
+		metric.WithDescription("open connections to the tailscale server"),
+	)
+	t.requests, _ = m.Int64Counter("tshttp.requests",
+		metric.WithDescription("requests to the tailscale server"),
+	)
+	t.handshakeErrors, _ = m.Int64Counter("tshttp.tls.handshake_errors",
+		metric.WithDescription("failed tls handshakes with the tailscale server"),
+	)
+	return t
+}
+
+func funnelAttr(funnel bool) metric.MeasurementOption {
+	return metric.WithAttributes(attribute.Bool("funnel", funnel))
+}
+
+// isFunnel reports whether c arrived through funnel.
+func isFunnel(c net.Conn) bool {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+	_, funnel := c.(*ipn.FunnelConn)
+	return funnel
+}
+
+// connState tracks open connections by whether they came through funnel.
+func (t *metrics) connState(c net.Conn, s http.ConnState) {
+	switch s {
+	case http.StateNew:
+		t.connections.Add(context.Background(), 1, funnelAttr(isFunnel(c)))
+	case http.StateHijacked, http.StateClosed:
+		t.connections.Add(context.Background(), -1, funnelAttr(isFunnel(c)))
+	}
+}
+
+// countRequests counts requests by whether they came through funnel.
+func (t *metrics) countRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		t.requests.Add(r.Context(), 1, funnelAttr(FromFunnel(r.Context())))
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// handshakeErrors counts tls handshake errors logged by http.Server,
+// passing all logs through to w.
+type handshakeErrors struct {
+	w     io.Writer
+	count metric.Int64Counter
+}
+
+func (h *handshakeErrors) Write(b []byte) (int, error) {
+	if bytes.Contains(b, []byte("TLS handshake error")) {
+		h.count.Add(context.Background(), 1)
+	}
+	return h.w.Write(b)
+}
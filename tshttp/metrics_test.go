@@ -0,0 +1,60 @@
+package tshttp
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	reader := sdkmetric.NewManualReader()
+	m := newMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test"))
+
+	h := m.countRequests(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	for _, o := range []origin{originFunnel, originTailnet, originTailnet} {
+		ctx := context.WithValue(context.Background(), originKey{}, o)
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	}
+
+	buf := new(bytes.Buffer)
+	l := log.New(&handshakeErrors{w: buf, count: m.handshakeErrors}, "", 0)
+	l.Printf("http: TLS handshake error from 100.64.0.1:1234: EOF")
+	l.Printf("http: superfluous response.WriteHeader call")
+	if got := bytes.Count(buf.Bytes(), []byte("\n")); got != 2 {
+		t.Errorf("forwarded %d log lines, want 2", got)
+	}
+
+	var rm metricdata.ResourceMetrics
+	err := reader.Collect(context.Background(), &rm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sums := make(map[string]map[bool]int64)
+	for _, sm := range rm.ScopeMetrics {
+		for _, metric := range sm.Metrics {
+			data, ok := metric.Data.(metricdata.Sum[int64])
+			if !ok {
+				continue
+			}
+			sums[metric.Name] = make(map[bool]int64)
+			for _, dp := range data.DataPoints {
+				funnel, _ := dp.Attributes.Value("funnel")
+				sums[metric.Name][funnel.AsBool()] += dp.Value
+			}
+		}
+	}
+	if got := sums["tshttp.requests"]; got[true] != 1 || got[false] != 2 {
+		t.Errorf("requests = %v, want 1 funnel and 2 tailnet", got)
+	}
+	if got := sums["tshttp.tls.handshake_errors"][false]; got != 1 {
+		t.Errorf("handshake errors = %d, want 1", got)
+	}
+}
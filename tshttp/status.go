@@ -0,0 +1,63 @@
+package tshttp
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"tailscale.com/client/tailscale"
+	"tailscale.com/ipn/ipnstate"
+)
+
+// Status describes the node on the tailnet.
+type Status struct {
+	// Name is the MagicDNS name of the node, such as host.tailnet.ts.net.
+	Name string
+	// IPs are the tailnet addresses of the node.
+	IPs []netip.Addr
+	// CertDomains are the domains the node can get certificates for,
+	// empty if https isn't enabled for the tailnet.
+	CertDomains []string
+	// Funnel reports whether any listener is exposed to the internet through funnel.
+	Funnel bool
+	// Online reports whether the node is connected to the tailnet.
+	Online bool
+}
+
+// LocalClient returns the client for the embedded node,
+// starting it if necessary.
+func (s *Server) LocalClient() (*tailscale.LocalClient, error) {
+	return s.TS.LocalClient()
+}
+
+// Status returns the current status of the node,
+// for use in status pages or identity aware features.
+func (s *Server) Status(ctx context.Context) (Status, error) {
+	lc, err := s.TS.LocalClient()
+	if err != nil {
+		return Status{}, fmt.Errorf("get local client: %w", err)
+	}
+	st, err := lc.StatusWithoutPeers(ctx)
+	if err != nil {
+		return Status{}, fmt.Errorf("get status: %w", err)
+	}
+	return newStatus(st, s.conf.Listeners), nil
+}
+
+func newStatus(st *ipnstate.Status, listeners Listeners) Status {
+	status := Status{
+		IPs:         st.TailscaleIPs,
+		CertDomains: st.CertDomains,
+	}
+	if st.Self != nil {
+		status.Name = strings.TrimSuffix(st.Self.DNSName, ".")
+		status.Online = st.Self.Online
+	}
+	for _, l := range listeners {
+		if l.Mode == "funnel" {
+			status.Funnel = true
+		}
+	}
+	return status
+}
@@ -0,0 +1,37 @@
+package tshttp
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"tailscale.com/ipn/ipnstate"
+)
+
+func TestNewStatus(t *testing.T) {
+	t.Parallel()
+
+	st := &ipnstate.Status{
+		TailscaleIPs: []netip.Addr{netip.MustParseAddr("100.64.0.1")},
+		CertDomains:  []string{"host.tailnet.ts.net"},
+		Self: &ipnstate.PeerStatus{
+			DNSName: "host.tailnet.ts.net.",
+			Online:  true,
+		},
+	}
+	got := newStatus(st, Listeners{{Mode: "tls", Port: 443}, {Mode: "funnel", Port: 8443}})
+	want := Status{
+		Name:        "host.tailnet.ts.net",
+		IPs:         []netip.Addr{netip.MustParseAddr("100.64.0.1")},
+		CertDomains: []string{"host.tailnet.ts.net"},
+		Funnel:      true,
+		Online:      true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("status = %+v, want %+v", got, want)
+	}
+
+	if newStatus(&ipnstate.Status{}, Listeners{{Mode: "tls", Port: 443}}).Funnel {
+		t.Errorf("funnel reported without a funnel listener")
+	}
+}
@@ -0,0 +1,42 @@
+package tshttp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+)
+
+// listenLocalTLS listens on a local tcp address,
+// serving tls with certificates issued to the node by tailscale.
+func (s *Server) listenLocalTLS(ctx context.Context, addr string) (net.Listener, error) {
+	lc, err := s.TS.LocalClient()
+	if err != nil {
+		return nil, fmt.Errorf("get local client: %w", err)
+	}
+	domains := s.TS.CertDomains()
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("no certificate domains, enable https for the tailnet")
+	}
+
+	s.O.L.LogAttrs(ctx, slog.LevelInfo, "starting local tls listen",
+		slog.String("address", addr),
+		slog.String("domain", domains[0]),
+	)
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return tls.NewListener(lis, &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(hi *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			// clients connecting by ip address don't send a server name
+			if hi.ServerName == "" {
+				hi.ServerName = domains[0]
+			}
+			return lc.GetCertificate(hi)
+		},
+	}), nil
+}
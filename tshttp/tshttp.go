@@ -0,0 +1,368 @@
+// Package tshttp serves http over a tailnet with an embedded tailscale node.
+package tshttp
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.seankhliao.com/svcrunner/v3/observability"
+	"tailscale.com/tsnet"
+	"tailscale.com/types/logger"
+)
+
+type Config struct {
+	// Hostname is the machine name on the tailnet.
+	Hostname string
+	// Dir holds the node state, a directory under the user config dir if empty.
+	Dir string
+	// Listeners are the tailnet ports to serve on.
+	Listeners Listeners
+	AccessLog bool
+
+	// AuthKey registers a new node without interactive login,
+	// read from $TS_AUTHKEY if empty,
+	// unused if the node state already exists.
+	AuthKey string
+	// Ephemeral nodes are removed from the tailnet when they go offline,
+	// persistent nodes keep their identity across restarts through Dir.
+	Ephemeral bool
+	// ControlURL is the coordination server, such as a headscale instance,
+	// the tailscale default if empty.
+	ControlURL string
+
+	// AllowUsers and AllowTags restrict the clients allowed by WhoIs
+	// to the listed login names and node tags,
+	// any tailnet client is allowed if both are empty.
+	AllowUsers []string
+	AllowTags  []string
+
+	// LocalAddress also serves plain http on a local tcp address,
+	// such as for health checks from the orchestrator or a sidecar.
+	// It is outside the tailnet, only Public routes are served on it,
+	// so health checks meant for it should be registered there.
+	LocalAddress string
+	// LocalTLSAddress also serves https on a local tcp address,
+	// using certificates issued to the node by tailscale.
+	// It is outside the tailnet, only Public routes are served on it.
+	LocalTLSAddress string
+
+	// ShutdownTimeout bounds waiting for requests to complete
+	// and the node to log out on shutdown.
+	ShutdownTimeout time.Duration
+}
+
+func (c *Config) SetFlags(fset *flag.FlagSet) {
+	fset.StringVar(&c.Hostname, "tailscale.hostname", filepath.Base(os.Args[0]), "machine name on the tailnet")
+	fset.StringVar(&c.Dir, "tailscale.dir", "", "directory to store tailscale state, defaults to a directory under the user config dir")
+	c.Listeners = Listeners{{Mode: "tls", Port: 443}} // default
+	fset.Var(&c.Listeners, "tailscale.listen", "comma separated tailnet listeners as mode:port, mode is one of tailnet (http)|tls (https)|funnel (public https)")
+	fset.StringVar(&c.AuthKey, "tailscale.auth-key", "", "auth key to register the node without interactive login, defaults to $TS_AUTHKEY")
+	fset.BoolVar(&c.Ephemeral, "tailscale.ephemeral", false, "register as an ephemeral node, removed from the tailnet when offline")
+	fset.StringVar(&c.ControlURL, "tailscale.control-url", "", "coordination server url, such as a headscale instance, defaults to tailscale")
+	fset.Func("tailscale.allow-users", "comma separated login names allowed by the WhoIs middleware", func(s string) error {
+		c.AllowUsers = splitList(s)
+		return nil
+	})
+	fset.Func("tailscale.allow-tags", "comma separated node tags allowed by the WhoIs middleware, such as tag:server", func(s string) error {
+		c.AllowTags = splitList(s)
+		return nil
+	})
+	fset.StringVar(&c.LocalAddress, "tailscale.local-addr", "", "local address to also serve public routes over http on, such as :8080 for health checks, disabled if empty")
+	fset.StringVar(&c.LocalTLSAddress, "tailscale.local-tls-addr", "", "local address to also serve public routes over https on with tailscale issued certificates, disabled if empty")
+	fset.DurationVar(&c.ShutdownTimeout, "tailscale.shutdown-timeout", 10*time.Second, "time to wait for requests to complete and the node to log out on shutdown")
+	fset.BoolVar(&c.AccessLog, "tailscale.access-log", false, "log every http request served over the tailnet")
+}
+
+type Server struct {
+	O *observability.O
+	// TS is the embedded tailscale node,
+	// use it for dialing other nodes, see also LocalClient and Status.
+	TS     *tsnet.Server
+	Server *http.Server
+	// Public routes are served to the internet on funnel listeners,
+	// on local listeners, and to the tailnet.
+	// All other routes are only served to the tailnet.
+	Public *http.ServeMux
+
+	ports     map[uint16]http.Handler
+	origins   *sync.Map
+	conf      *Config
+	closeOnce sync.Once
+	serving   atomic.Bool
+	haveCert  atomic.Bool
+}
+
+// New creates a server for handler on the tailnet.
+// Routes registered on Server.Public are additionally served through funnel.
+// The node is started by Run or Start.
+func New(ctx context.Context, o *observability.O, c *Config, handler http.Handler) *Server {
+	o = o.Component("tshttp")
+	authKey := c.AuthKey
+	if authKey == "" {
+		// not the flag default, which would print it in the usage
+		authKey = os.Getenv("TS_AUTHKEY")
+	}
+	ts := &tsnet.Server{
+		Dir:        c.Dir,
+		Hostname:   c.Hostname,
+		AuthKey:    authKey,
+		Ephemeral:  c.Ephemeral,
+		ControlURL: c.ControlURL,
+		UserLogf:   logf(ctx, o.L, slog.LevelInfo),
+		Logf:       logf(ctx, o.L, slog.LevelDebug),
+	}
+	public := http.NewServeMux()
+	ports := make(map[uint16]http.Handler)
+	origins := &sync.Map{}
+	handler = routeFunnel(public, routePort(ports, handler))
+	if c.AccessLog {
+		handler = o.AccessLog(handler)
+	}
+	m := newMetrics(o.M)
+	handler = m.countRequests(handler)
+	errLog := slog.NewLogLogger(o.H, slog.LevelWarn)
+	server := &http.Server{
+		Handler:           otelhttp.NewHandler(handler, "serve tailscale"),
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          log.New(&handshakeErrors{w: errLog.Writer(), count: m.handshakeErrors}, "", 0),
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return withPort(withOrigin(ctx, origins, c), c)
+		},
+		ConnState: func(c net.Conn, s http.ConnState) {
+			o.ConnState(c, s)
+			m.connState(c, s)
+		},
+	}
+	return &Server{
+		O:       o,
+		TS:      ts,
+		Server:  server,
+		Public:  public,
+		ports:   ports,
+		origins: origins,
+		conf:    c,
+	}
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// logf adapts tsnet logging to a structured logger.
+func logf(ctx context.Context, l *slog.Logger, level slog.Level) logger.Logf {
+	return func(format string, args ...any) {
+		if !l.Enabled(ctx, level) {
+			return
+		}
+		l.LogAttrs(ctx, level, fmt.Sprintf(format, args...))
+	}
+}
+
+// listen brings up the node and listens on the configured ports.
+func (s *Server) listen(ctx context.Context) ([]net.Listener, error) {
+	s.O.L.LogAttrs(ctx, slog.LevelInfo, "starting tailscale",
+		slog.String("hostname", s.conf.Hostname),
+		slog.String("listeners", s.conf.Listeners.String()),
+		slog.Bool("ephemeral", s.conf.Ephemeral),
+		slog.Bool("auth_key", s.TS.AuthKey != ""),
+	)
+	_, err := s.TS.Up(ctx)
+	if err != nil {
+		s.TS.Close()
+		return nil, s.O.Err(ctx, "start tailscale", err)
+	}
+
+	var listeners []net.Listener
+	for _, l := range s.conf.Listeners {
+		lis, err := s.listenTailnet(l)
+		if err != nil {
+			closeAll(listeners)
+			s.TS.Close()
+			return nil, s.O.Err(ctx, "listen on tailnet", err, slog.String("listener", l.String()))
+		}
+		listeners = append(listeners, &originListener{Listener: lis, tailnet: true, origins: s.origins})
+	}
+
+	if s.conf.LocalAddress != "" {
+		s.O.L.LogAttrs(ctx, slog.LevelInfo, "starting local listen", slog.String("address", s.conf.LocalAddress))
+		lis, err := net.Listen("tcp", s.conf.LocalAddress)
+		if err != nil {
+			closeAll(listeners)
+			s.TS.Close()
+			return nil, s.O.Err(ctx, "listen local", err, slog.String("address", s.conf.LocalAddress))
+		}
+		listeners = append(listeners, &originListener{Listener: lis, origins: s.origins})
+	}
+
+	if s.conf.LocalTLSAddress != "" {
+		lis, err := s.listenLocalTLS(ctx, s.conf.LocalTLSAddress)
+		if err != nil {
+			closeAll(listeners)
+			s.TS.Close()
+			return nil, s.O.Err(ctx, "listen local tls", err, slog.String("address", s.conf.LocalTLSAddress))
+		}
+		listeners = append(listeners, &originListener{Listener: lis, origins: s.origins})
+	}
+	return listeners, nil
+}
+
+func closeAll(listeners []net.Listener) {
+	for _, lis := range listeners {
+		lis.Close()
+	}
+}
+
+// serve serves on all listeners in the background,
+// sending the result of each to the returned channel.
+func (s *Server) serve(ctx context.Context, listeners []net.Listener) <-chan error {
+	s.serving.Store(true)
+	serveErr := make(chan error, len(listeners))
+	for _, lis := range listeners {
+		s.O.L.LogAttrs(ctx, slog.LevelInfo, "starting tailscale server", slog.String("address", lis.Addr().String()))
+		go func() {
+			err := s.Server.Serve(lis)
+			if errors.Is(err, http.ErrServerClosed) {
+				err = nil
+			}
+			serveErr <- err
+		}()
+	}
+	return serveErr
+}
+
+// shutdown gracefully stops the server,
+// closing any remaining connections after the shutdown timeout,
+// then stops the node.
+func (s *Server) shutdown(ctx context.Context) {
+	s.serving.Store(false)
+	sctx := context.WithoutCancel(ctx)
+	if s.conf.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		sctx, cancel = context.WithTimeout(sctx, s.conf.ShutdownTimeout)
+		defer cancel()
+	}
+
+	s.O.L.LogAttrs(ctx, slog.LevelInfo, "shutting down tailscale server",
+		slog.Duration("timeout", s.conf.ShutdownTimeout),
+	)
+	err := s.Server.Shutdown(sctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = s.Server.Close()
+		s.O.L.LogAttrs(ctx, slog.LevelWarn, "shutdown timed out, force closed connections")
+	}
+	if err != nil {
+		s.O.Err(ctx, "error closing tailscale server", err)
+	}
+
+	s.closeNode(sctx)
+}
+
+// closeNode logs out ephemeral nodes so they're removed from the tailnet immediately,
+// then stops the node, flushing its state and logs.
+// Only the first call has any effect.
+func (s *Server) closeNode(ctx context.Context) {
+	s.closeOnce.Do(func() { s.doCloseNode(ctx) })
+}
+
+func (s *Server) doCloseNode(ctx context.Context) {
+	if s.conf.Ephemeral {
+		lc, err := s.TS.LocalClient()
+		if err == nil {
+			err = lc.Logout(ctx)
+		}
+		if err != nil {
+			s.O.Err(ctx, "log out ephemeral node", err)
+		} else {
+			s.O.L.LogAttrs(ctx, slog.LevelInfo, "logged out ephemeral node")
+		}
+	}
+
+	err := s.TS.Close()
+	if err != nil {
+		s.O.Err(ctx, "error closing tailscale node", err)
+		return
+	}
+	s.O.L.LogAttrs(ctx, slog.LevelInfo, "closed tailscale node")
+}
+
+// Run serves on the tailnet and any local addresses until ctx is canceled,
+// then shuts them all down together.
+// An error serving on any listener stops all of them.
+func (s *Server) Run(ctx context.Context) error {
+	listeners, err := s.listen(ctx)
+	if err != nil {
+		return err
+	}
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		s.shutdown(ctx)
+	}()
+
+	serveErr := s.serve(ctx, listeners)
+	for range listeners {
+		err := <-serveErr
+		if err != nil {
+			s.Server.Close()
+			s.closeNode(context.WithoutCancel(ctx))
+			return s.O.Err(ctx, "error serving tailscale", err)
+		}
+	}
+	<-shutdownDone
+	return nil
+}
+
+// Start brings up the node and serves in the background,
+// returning a function to stop serving.
+// It fits the cleanup returned by framework.Config.Start:
+//
+//	Start: func(ctx context.Context, o *observability.O, mux *http.ServeMux) (func(), error) {
+//		return tshttp.New(ctx, o, tsconf, mux).Start(ctx)
+//	}
+func (s *Server) Start(ctx context.Context) (stop func(), err error) {
+	listeners, err := s.listen(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	serveErr := s.serve(ctx, listeners)
+	go func() {
+		defer close(done)
+		for range listeners {
+			err := <-serveErr
+			if err != nil {
+				s.O.Err(ctx, "error serving tailscale", err)
+			}
+		}
+	}()
+	return func() {
+		s.shutdown(ctx)
+		<-done
+	}, nil
+}
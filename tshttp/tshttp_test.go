@@ -0,0 +1,53 @@
+package tshttp
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+)
+
+func TestLogf(t *testing.T) {
+	t.Parallel()
+
+	buf := new(bytes.Buffer)
+	l := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	ctx := context.Background()
+
+	logf(ctx, l, slog.LevelDebug)("hidden %d", 1)
+	logf(ctx, l, slog.LevelInfo)("auth url %s", "https://login")
+
+	out := buf.String()
+	if strings.Contains(out, "hidden") {
+		t.Errorf("debug log emitted: %s", out)
+	}
+	if !strings.Contains(out, `msg="auth url https://login"`) {
+		t.Errorf("info log missing: %s", out)
+	}
+}
+
+func TestAuthKeyFromEnv(t *testing.T) {
+	t.Setenv("TS_AUTHKEY", "tskey-auth-secret")
+
+	var c Config
+	fset := flag.NewFlagSet("", flag.ContinueOnError)
+	c.SetFlags(fset)
+	usage := new(bytes.Buffer)
+	fset.SetOutput(usage)
+	fset.PrintDefaults()
+	if strings.Contains(usage.String(), "tskey-auth-secret") {
+		t.Errorf("auth key in usage:\n%s", usage)
+	}
+
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+	s := New(context.Background(), o, &c, http.NotFoundHandler())
+	if s.TS.AuthKey != "tskey-auth-secret" {
+		t.Errorf("auth key = %q, want from env", s.TS.AuthKey)
+	}
+}
@@ -0,0 +1,147 @@
+package tshttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.seankhliao.com/svcrunner/v3/observability"
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/tailcfg"
+)
+
+type whoIsKey struct{}
+
+// WhoIs returns the tailnet identity of the client
+// if it was looked up by an earlier middleware.
+func WhoIs(ctx context.Context) (*apitype.WhoIsResponse, bool) {
+	who, ok := ctx.Value(whoIsKey{}).(*apitype.WhoIsResponse)
+	return who, ok
+}
+
+// CapabilityValues decodes the values granted to the client for a capability,
+// from the app capabilities in the tailnet policy file.
+func CapabilityValues[T any](ctx context.Context, capability string) ([]T, error) {
+	who, ok := WhoIs(ctx)
+	if !ok {
+		return nil, errors.New("no tailnet identity")
+	}
+	return tailcfg.UnmarshalCapJSON[T](who.CapMap, tailcfg.PeerCapability(capability))
+}
+
+// whoIs looks up the tailnet identity of the client,
+// reusing a previous lookup for the request.
+func (s *Server) whoIs(r *http.Request) (*apitype.WhoIsResponse, error) {
+	if who, ok := WhoIs(r.Context()); ok {
+		return who, nil
+	}
+	if !FromTailnet(r.Context()) {
+		return nil, errors.New("client is not on the tailnet")
+	}
+	lc, err := s.TS.LocalClient()
+	if err != nil {
+		return nil, fmt.Errorf("get local client: %w", err)
+	}
+	return lc.WhoIs(r.Context(), r.RemoteAddr)
+}
+
+// WhoIs returns a middleware identifying tailnet clients,
+// only allowing those listed in Config.AllowUsers or Config.AllowTags if either is set.
+// Funnel and local clients have no tailnet identity and are always rejected.
+// The identity is available to next through WhoIs,
+// and recorded on its logs, span, and the access log.
+func (s *Server) WhoIs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		who, ok := s.identify(rw, r)
+		if !ok {
+			return
+		}
+		if !s.allowed(who) {
+			s.forbid(r.Context(), rw, "tailnet client not allowed", identityAttrs(who)...)
+			return
+		}
+		next.ServeHTTP(rw, withIdentity(r, who))
+	})
+}
+
+// RequireCapability returns a middleware only allowing clients
+// granted capability in the tailnet policy file.
+// The client identity is available to next through WhoIs.
+func (s *Server) RequireCapability(capability string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		who, ok := s.identify(rw, r)
+		if !ok {
+			return
+		}
+		if !who.CapMap.HasCapability(tailcfg.PeerCapability(capability)) {
+			s.forbid(r.Context(), rw, "tailnet client missing capability",
+				append(identityAttrs(who), slog.String("capability", capability))...,
+			)
+			return
+		}
+		next.ServeHTTP(rw, withIdentity(r, who))
+	})
+}
+
+// identify looks up the client identity,
+// responding with forbidden if it has none.
+func (s *Server) identify(rw http.ResponseWriter, r *http.Request) (*apitype.WhoIsResponse, bool) {
+	who, err := s.whoIs(r)
+	if err != nil {
+		s.forbid(r.Context(), rw, "identify tailnet client", slog.String("error", err.Error()))
+		return nil, false
+	}
+	return who, true
+}
+
+// allowed reports whether who matches the configured allowlists.
+// Tagged nodes are identified by their tags instead of the user that created them.
+func (s *Server) allowed(who *apitype.WhoIsResponse) bool {
+	if len(s.conf.AllowUsers) == 0 && len(s.conf.AllowTags) == 0 {
+		return true
+	}
+	if who.Node.IsTagged() {
+		for _, tag := range who.Node.Tags {
+			if slices.Contains(s.conf.AllowTags, tag) {
+				return true
+			}
+		}
+		return false
+	}
+	return slices.Contains(s.conf.AllowUsers, who.UserProfile.LoginName)
+}
+
+// forbid rejects a client,
+// logged as a warning as it isn't a server error.
+func (s *Server) forbid(ctx context.Context, rw http.ResponseWriter, msg string, attrs ...slog.Attr) {
+	s.O.L.LogAttrs(ctx, slog.LevelWarn, msg,
+		append(attrs, slog.Int("http.response.status_code", http.StatusForbidden))...,
+	)
+	http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+}
+
+func identityAttrs(who *apitype.WhoIsResponse) []slog.Attr {
+	return []slog.Attr{
+		slog.String("tailscale.user", who.UserProfile.LoginName),
+		slog.String("tailscale.node", who.Node.ComputedName),
+	}
+}
+
+// withIdentity records the client identity on the request context,
+// its logs, span, and access log.
+func withIdentity(r *http.Request, who *apitype.WhoIsResponse) *http.Request {
+	ctx := r.Context()
+	attrs := identityAttrs(who)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("tailscale.user", who.UserProfile.LoginName),
+		attribute.String("tailscale.node", who.Node.ComputedName),
+	)
+	observability.AddAccessLogAttrs(ctx, attrs...)
+	ctx = observability.WithLogAttrs(ctx, attrs...)
+	return r.WithContext(context.WithValue(ctx, whoIsKey{}, who))
+}
@@ -0,0 +1,133 @@
+package tshttp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.seankhliao.com/svcrunner/v3/observability"
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/tailcfg"
+)
+
+func TestRequireCapability(t *testing.T) {
+	t.Parallel()
+
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: io.Discard})
+	s := &Server{O: o}
+	h := s.RequireCapability("example.com/cap/admin", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		roles, err := CapabilityValues[struct{ Role string }](r.Context(), "example.com/cap/admin")
+		if err != nil || len(roles) != 1 {
+			t.Errorf("capability values = %v, %v", roles, err)
+			return
+		}
+		io.WriteString(rw, roles[0].Role)
+	}))
+
+	who := func(capMap tailcfg.PeerCapMap) *apitype.WhoIsResponse {
+		return &apitype.WhoIsResponse{
+			Node:        &tailcfg.Node{ComputedName: "laptop"},
+			UserProfile: &tailcfg.UserProfile{LoginName: "user@example.com"},
+			CapMap:      capMap,
+		}
+	}
+	tcs := []struct {
+		name     string
+		ctx      context.Context
+		wantCode int
+		wantBody string
+	}{
+		{
+			"granted",
+			context.WithValue(context.Background(), whoIsKey{}, who(tailcfg.PeerCapMap{
+				"example.com/cap/admin": {`{"Role":"owner"}`},
+			})),
+			http.StatusOK, "owner",
+		}, {
+			"not granted",
+			context.WithValue(context.Background(), whoIsKey{}, who(tailcfg.PeerCapMap{
+				"example.com/cap/read": {`{}`},
+			})),
+			http.StatusForbidden, "",
+		}, {
+			"funnel",
+			context.WithValue(context.Background(), originKey{}, originFunnel),
+			http.StatusForbidden, "",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(tc.ctx))
+			if rec.Code != tc.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantCode)
+			}
+			if tc.wantBody != "" && rec.Body.String() != tc.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tc.wantBody)
+			}
+		})
+	}
+}
+
+func TestWhoIs(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	o := observability.New(&observability.Config{LogFormat: "json", LogOutput: &buf})
+	s := &Server{O: o, conf: &Config{
+		AllowUsers: []string{"user@example.com"},
+		AllowTags:  []string{"tag:server"},
+	}}
+	h := o.AccessLog(s.WhoIs(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		who, ok := WhoIs(r.Context())
+		if !ok {
+			t.Error("no identity in context")
+			return
+		}
+		io.WriteString(rw, who.Node.ComputedName)
+	})))
+
+	tcs := []struct {
+		name     string
+		who      *apitype.WhoIsResponse
+		wantCode int
+	}{
+		{"allowed user", &apitype.WhoIsResponse{
+			Node:        &tailcfg.Node{ComputedName: "laptop"},
+			UserProfile: &tailcfg.UserProfile{LoginName: "user@example.com"},
+		}, http.StatusOK},
+		{"other user", &apitype.WhoIsResponse{
+			Node:        &tailcfg.Node{ComputedName: "desktop"},
+			UserProfile: &tailcfg.UserProfile{LoginName: "other@example.com"},
+		}, http.StatusForbidden},
+		{"allowed tag", &apitype.WhoIsResponse{
+			Node:        &tailcfg.Node{ComputedName: "server", Tags: []string{"tag:server"}},
+			UserProfile: &tailcfg.UserProfile{LoginName: "tagged-devices"},
+		}, http.StatusOK},
+		{"other tag", &apitype.WhoIsResponse{
+			Node:        &tailcfg.Node{ComputedName: "ci", Tags: []string{"tag:ci"}},
+			UserProfile: &tailcfg.UserProfile{LoginName: "tagged-devices"},
+		}, http.StatusForbidden},
+	}
+	for _, tc := range tcs {
+		ctx := context.WithValue(context.Background(), whoIsKey{}, tc.who)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		if rec.Code != tc.wantCode {
+			t.Errorf("%s: status = %d, want %d", tc.name, rec.Code, tc.wantCode)
+		}
+		if tc.wantCode == http.StatusOK && rec.Body.String() != tc.who.Node.ComputedName {
+			t.Errorf("%s: body = %q", tc.name, rec.Body.String())
+		}
+	}
+
+	if !strings.Contains(buf.String(), `"tailscale.user":"user@example.com","tailscale.node":"laptop"`) {
+		t.Errorf("access log missing identity:\n%s", buf.String())
+	}
+}